@@ -13,6 +13,16 @@ const (
 	DefaultTTL        = 86400 //默认缓存时间
 )
 
+//未设置DriverType的缓存使用的驱动
+var defaultDriverType = DefaultDriverType
+
+//设置未设置DriverType的缓存使用的驱动，如按配置切换为memory驱动，需要在获取缓存前设置
+func SetDefaultDriverType(driverType string) {
+	if driverType != "" {
+		defaultDriverType = driverType
+	}
+}
+
 //缓存基类
 type BaseCache struct {
 	cache      Cache
@@ -63,7 +73,7 @@ func (m *BaseCache) GetDriverTypeOrDefault() string {
 	if m.DriverType != "" {
 		return m.DriverType
 	} else {
-		return DefaultDriverType
+		return defaultDriverType
 	}
 }
 
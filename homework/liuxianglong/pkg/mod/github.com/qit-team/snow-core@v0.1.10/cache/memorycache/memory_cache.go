@@ -0,0 +1,232 @@
+package memorycache
+
+import (
+	"context"
+	"fmt"
+	"github.com/qit-team/snow-core/cache"
+	"github.com/qit-team/snow-core/utils"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//清理过期缓存的最小间隔
+const gcInterval = time.Minute
+
+var (
+	mp map[string]cache.Cache
+	mu sync.RWMutex
+)
+
+//缓存项，expireAt为过期的毫秒时间戳，0表示不过期
+type memoryItem struct {
+	value    string
+	expireAt int64
+}
+
+func (item *memoryItem) expired(now int64) bool {
+	return item.expireAt > 0 && item.expireAt <= now
+}
+
+/**
+ * 基于进程内存的缓存，用于单元测试和本地开发，多进程之间不共享
+ * 值与redis驱动一致转换为字符串保存，过期的缓存在访问时删除，并在写入时定期清理
+ */
+type MemoryCache struct {
+	lock  sync.RWMutex
+	items map[string]*memoryItem
+	//最近一次清理过期缓存的时间
+	gcAt time.Time
+}
+
+//实例模式
+func newMemoryCache(diName string) cache.Cache {
+	m := new(MemoryCache)
+	m.items = make(map[string]*memoryItem)
+	m.gcAt = time.Now()
+	return m
+}
+
+//单例模式，相同diName的缓存共享数据
+func GetMemoryCache(diName string) cache.Cache {
+	key := diName
+	mu.RLock()
+	q, ok := mp[key]
+	mu.RUnlock()
+	if ok {
+		return q
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if q, ok = mp[key]; ok {
+		return q
+	}
+	q = newMemoryCache(diName)
+	mp[key] = q
+	return q
+}
+
+/**
+ * 获取缓存key的数据
+ * 注意事项，如果key值不存在的话，返回的是空字符串，而不是nil
+ */
+func (c *MemoryCache) Get(ctx context.Context, key string) (interface{}, error) {
+	now := utils.GetCurrentMilliTime()
+	c.lock.RLock()
+	item, ok := c.items[key]
+	c.lock.RUnlock()
+	if !ok || item.expired(now) {
+		return "", nil
+	}
+	return item.value, nil
+}
+
+/**
+ * 批量获取缓存，不存在的key值为空字符串
+ */
+func (c *MemoryCache) GetMulti(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+	now := utils.GetCurrentMilliTime()
+	arr := make(map[string]interface{})
+	c.lock.RLock()
+	for _, key := range keys {
+		item, ok := c.items[key]
+		if !ok || item.expired(now) {
+			arr[key] = ""
+		} else {
+			arr[key] = item.value
+		}
+	}
+	c.lock.RUnlock()
+	return arr, nil
+}
+
+/**
+ * 设置缓存，ttl单位秒，小于等于0时不过期
+ */
+func (c *MemoryCache) Set(ctx context.Context, key string, value interface{}, ttl ...int) (bool, error) {
+	return c.SetMulti(ctx, map[string]interface{}{key: value}, ttl...)
+}
+
+/**
+ * 批量设置缓存，ttl单位秒，小于等于0时不过期
+ */
+func (c *MemoryCache) SetMulti(ctx context.Context, items map[string]interface{}, ttl ...int) (bool, error) {
+	now := utils.GetCurrentMilliTime()
+	expireAt := getExpireAt(now, cache.GetTTLOrDefault(ttl...))
+	c.lock.Lock()
+	c.gc(now)
+	for key, value := range items {
+		c.items[key] = &memoryItem{value: toString(value), expireAt: expireAt}
+	}
+	c.lock.Unlock()
+	return true, nil
+}
+
+/**
+ * 删除缓存，key不存在时返回false
+ */
+func (c *MemoryCache) Delete(ctx context.Context, key string) (bool, error) {
+	return c.DeleteMulti(ctx, key)
+}
+
+/**
+ * 批量删除缓存，全部key都不存在时返回false
+ */
+func (c *MemoryCache) DeleteMulti(ctx context.Context, keys ...string) (bool, error) {
+	now := utils.GetCurrentMilliTime()
+	n := 0
+	c.lock.Lock()
+	for _, key := range keys {
+		if item, ok := c.items[key]; ok {
+			if !item.expired(now) {
+				n++
+			}
+			delete(c.items, key)
+		}
+	}
+	c.lock.Unlock()
+	return n > 0, nil
+}
+
+/**
+ * 重新设置缓存的过期时间，ttl小于等于0时与redis一致直接删除，key不存在时返回false
+ */
+func (c *MemoryCache) Expire(ctx context.Context, key string, ttl ...int) (bool, error) {
+	now := utils.GetCurrentMilliTime()
+	t := cache.GetTTLOrDefault(ttl...)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	item, ok := c.items[key]
+	if !ok || item.expired(now) {
+		delete(c.items, key)
+		return false, nil
+	}
+	if t <= 0 {
+		delete(c.items, key)
+	} else {
+		item.expireAt = getExpireAt(now, t)
+	}
+	return true, nil
+}
+
+/**
+ * key是否存在
+ */
+func (c *MemoryCache) IsExist(ctx context.Context, key string) (bool, error) {
+	now := utils.GetCurrentMilliTime()
+	c.lock.RLock()
+	item, ok := c.items[key]
+	c.lock.RUnlock()
+	return ok && !item.expired(now), nil
+}
+
+//距离上次清理超过间隔时间时删除全部过期的缓存，调用方需要持有写锁
+func (c *MemoryCache) gc(now int64) {
+	if time.Since(c.gcAt) < gcInterval {
+		return
+	}
+	c.gcAt = time.Now()
+	for key, item := range c.items {
+		if item.expired(now) {
+			delete(c.items, key)
+		}
+	}
+}
+
+//过期的毫秒时间戳，ttl小于等于0时不过期
+func getExpireAt(now int64, ttl int) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return now + int64(ttl)*1000
+}
+
+//按redis写入时的规则将值转换为字符串，保证切换驱动后读取到的值一致
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func init() {
+	mp = make(map[string]cache.Cache)
+	cache.Register(cache.DriverTypeMemory, GetMemoryCache)
+}
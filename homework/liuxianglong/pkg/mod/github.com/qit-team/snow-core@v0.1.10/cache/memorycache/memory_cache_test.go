@@ -0,0 +1,151 @@
+package memorycache
+
+import (
+	"context"
+	"github.com/qit-team/snow-core/cache"
+	"testing"
+	"time"
+)
+
+var c cache.Cache
+
+func init() {
+	c = cache.GetCache("memory", cache.DriverTypeMemory)
+}
+
+func TestGetSetDelete(t *testing.T) {
+	ctx := context.TODO()
+	key := "test-cache"
+	value := "111"
+	ok, err := c.Set(ctx, key, value)
+	if err != nil || !ok {
+		t.Error("set is not ok", err)
+		return
+	}
+
+	v, err := c.Get(ctx, key)
+	if err != nil || v != value {
+		t.Error("get is not same", v, err)
+		return
+	}
+
+	ok, err = c.Delete(ctx, key)
+	if err != nil || !ok {
+		t.Error("delete is not ok", err)
+		return
+	}
+	ok, _ = c.Delete(ctx, key)
+	if ok {
+		t.Error("delete of a missing key must not be ok")
+		return
+	}
+
+	v, _ = c.Get(ctx, key)
+	if v != "" {
+		t.Errorf("delete %s failed", key)
+	}
+}
+
+func TestSetMultiAndGetMulti(t *testing.T) {
+	ctx := context.TODO()
+	items := map[string]interface{}{
+		"test-key1": "111",
+		"test-key2": 222,
+	}
+	_, err := c.SetMulti(ctx, items, 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	m, err := c.GetMulti(ctx, "test-key1", "test-key2", "test-key-missing")
+	if err != nil || len(m) != 3 {
+		t.Error("get values's length is not enough", m, err)
+		return
+	}
+	//与redis驱动一致，值转换为字符串，不存在的key为空字符串
+	if m["test-key1"] != "111" || m["test-key2"] != "222" || m["test-key-missing"] != "" {
+		t.Error("get multi error", m)
+		return
+	}
+
+	time.Sleep(time.Millisecond * 1100)
+	m, _ = c.GetMulti(ctx, "test-key1", "test-key2")
+	for k, v := range m {
+		if v != "" {
+			t.Errorf("key %s is not expired", k)
+			return
+		}
+	}
+}
+
+func TestDeleteMulti(t *testing.T) {
+	ctx := context.TODO()
+	c.SetMulti(ctx, map[string]interface{}{
+		"test-key3": "111",
+		"test-key4": "222",
+	})
+
+	ok, err := c.DeleteMulti(ctx, "test-key3", "test-key4")
+	if err != nil || !ok {
+		t.Error("delete multi is not ok", err)
+		return
+	}
+	for _, key := range []string{"test-key3", "test-key4"} {
+		if ok, _ = c.IsExist(ctx, key); ok {
+			t.Errorf("key %s is exist", key)
+			return
+		}
+	}
+}
+
+func TestExpireExist(t *testing.T) {
+	ctx := context.TODO()
+	key := "test-expire"
+	c.Set(ctx, key, "222")
+
+	ok, err := c.IsExist(ctx, key)
+	if err != nil || !ok {
+		t.Errorf("key %s is not exist", key)
+		return
+	}
+
+	ok, _ = c.Expire(ctx, key, 1)
+	if !ok {
+		t.Error("expire is not ok")
+		return
+	}
+	time.Sleep(time.Millisecond * 1100)
+	if ok, _ = c.IsExist(ctx, key); ok {
+		t.Errorf("key %s is exist", key)
+		return
+	}
+	if ok, _ = c.Expire(ctx, key, 1); ok {
+		t.Error("expire of a missing key must not be ok")
+	}
+}
+
+func TestSet_noExpire(t *testing.T) {
+	ctx := context.TODO()
+	key := "test-forever"
+	c.Set(ctx, key, true, 0)
+	if v, _ := c.Get(ctx, key); v != "1" {
+		t.Error("value must be converted like redis", v)
+		return
+	}
+
+	//ttl小于等于0时与redis一致直接删除
+	c.Expire(ctx, key, 0)
+	if ok, _ := c.IsExist(ctx, key); ok {
+		t.Errorf("key %s is exist", key)
+	}
+}
+
+func TestGetMemoryCache(t *testing.T) {
+	if GetMemoryCache("memory") != c {
+		t.Error("same diName must share the cache")
+	}
+	if GetMemoryCache("other") == c {
+		t.Error("different diName must not share the cache")
+	}
+}
@@ -0,0 +1,307 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	//默认的保存间隔
+	defaultSaveInterval = 5 * time.Second
+	//默认的进度输出间隔
+	defaultReportInterval = 10 * time.Second
+)
+
+//命令的执行进度
+type State struct {
+	//游标，如已处理的最大id、分页的offset等，由命令自行解析
+	Cursor string `json:"cursor"`
+	//已处理的数量
+	Done int64 `json:"done"`
+	//总数量，未知时为0
+	Total     int64     `json:"total"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+/**
+ * 进度存储接口，可以使用redis或者数据库实现
+ */
+type Store interface {
+	//读取进度，不存在时返回nil
+	Load(ctx context.Context, name string) (state *State, err error)
+	//保存进度
+	Save(ctx context.Context, name string, state State) error
+	//删除进度
+	Delete(ctx context.Context, name string) error
+}
+
+//保存进度的间隔，作为Open的可选参数使用，小于等于0时每次Advance都保存
+type SaveInterval time.Duration
+
+//输出进度的间隔，作为Open的可选参数使用，小于等于0时不输出
+type ReportInterval time.Duration
+
+//忽略已保存的进度，从头开始执行，作为Open的可选参数使用
+type Restart bool
+
+//进度快照
+type Progress struct {
+	Done  int64
+	Total int64
+	//本次执行的耗时
+	Elapsed time.Duration
+	//本次执行的处理速度，每秒处理数
+	Rate float64
+	//预计剩余时间，总数量未知或者无法估算时为-1
+	ETA time.Duration
+}
+
+//百分比，总数量未知时为-1
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return float64(p.Done) * 100 / float64(p.Total)
+}
+
+func (p Progress) String() string {
+	s := fmt.Sprintf("%d", p.Done)
+	if p.Total > 0 {
+		s += fmt.Sprintf("/%d (%.1f%%)", p.Total, p.Percent())
+	}
+	s += fmt.Sprintf(", %.1f/s, elapsed %s", p.Rate, p.Elapsed.Round(time.Second))
+	if p.ETA >= 0 {
+		s += fmt.Sprintf(", eta %s", p.ETA.Round(time.Second))
+	}
+	return s
+}
+
+/**
+ * 可恢复的执行进度
+ * 命令每处理一批数据后调用Advance记录游标，进度按间隔持久化到Store，重新执行时从上次保存的游标继续
+ */
+type Checkpoint struct {
+	store Store
+	name  string
+
+	saveInterval   time.Duration
+	reportInterval time.Duration
+	out            io.Writer
+
+	mu      sync.Mutex
+	state   State
+	resumed bool
+	//本次执行开始的时间和已处理的数量，用于计算速度
+	start     time.Time
+	startDone int64
+	saved     time.Time
+	reported  time.Time
+	dirty     bool
+}
+
+/**
+ * 读取已保存的进度
+ * @param store 进度存储
+ * @param name 进度名称，一般为命令名加上参数，不同参数的执行互不影响
+ * @param args 可选参数按类型识别：SaveInterval为保存间隔，默认5秒；ReportInterval为进度输出间隔，默认10秒；
+ *             Restart为是否忽略已保存的进度；io.Writer为进度的输出，默认标准输出
+ */
+func Open(ctx context.Context, store Store, name string, args ...interface{}) (*Checkpoint, error) {
+	c := &Checkpoint{
+		store:          store,
+		name:           name,
+		saveInterval:   defaultSaveInterval,
+		reportInterval: defaultReportInterval,
+		out:            os.Stdout,
+	}
+	restart := false
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case SaveInterval:
+			c.saveInterval = time.Duration(v)
+		case ReportInterval:
+			c.reportInterval = time.Duration(v)
+		case Restart:
+			restart = bool(v)
+		case io.Writer:
+			c.out = v
+		}
+	}
+
+	if restart {
+		if err := store.Delete(ctx, name); err != nil {
+			return nil, err
+		}
+	} else {
+		state, err := store.Load(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if state != nil {
+			c.state = *state
+			c.resumed = true
+		}
+	}
+
+	now := time.Now()
+	c.start = now
+	c.startDone = c.state.Done
+	c.saved = now
+	c.reported = now
+	if c.resumed {
+		fmt.Fprintf(c.out, "[%s] resume from cursor %q, %s\n", name, c.state.Cursor, c.Progress())
+	}
+	return c, nil
+}
+
+//是否从已保存的进度继续执行
+func (c *Checkpoint) Resumed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed
+}
+
+//当前的游标，首次执行时为空
+func (c *Checkpoint) Cursor() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Cursor
+}
+
+//当前的进度
+func (c *Checkpoint) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+//设置总数量，用于输出百分比和预计剩余时间
+func (c *Checkpoint) SetTotal(total int64) {
+	c.mu.Lock()
+	c.state.Total = total
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+/**
+ * 记录处理进度，距上次保存超过保存间隔时持久化，超过输出间隔时输出进度
+ * @param cursor 已处理到的游标，重新执行时从此游标继续
+ * @param n 本次处理的数量
+ */
+func (c *Checkpoint) Advance(ctx context.Context, cursor string, n int64) error {
+	c.mu.Lock()
+	c.state.Cursor = cursor
+	c.state.Done += n
+	c.dirty = true
+	now := time.Now()
+	save := now.Sub(c.saved) >= c.saveInterval
+	report := c.reportInterval > 0 && now.Sub(c.reported) >= c.reportInterval
+	if report {
+		c.reported = now
+	}
+	c.mu.Unlock()
+
+	if report {
+		c.report("progress")
+	}
+	if save {
+		return c.Save(ctx)
+	}
+	return nil
+}
+
+//立即保存进度，进度未变化时不保存
+func (c *Checkpoint) Save(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	state := c.state
+	state.UpdatedAt = time.Now()
+	c.mu.Unlock()
+
+	if err := c.store.Save(ctx, c.name, state); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.saved = state.UpdatedAt
+	//保存期间没有新的进度
+	if c.state.Cursor == state.Cursor && c.state.Done == state.Done && c.state.Total == state.Total {
+		c.dirty = false
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+//执行完成，删除已保存的进度
+func (c *Checkpoint) Finish(ctx context.Context) error {
+	if err := c.store.Delete(ctx, c.name); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.dirty = false
+	c.mu.Unlock()
+	c.report("finished")
+	return nil
+}
+
+//当前的进度快照
+func (c *Checkpoint) Progress() Progress {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := Progress{
+		Done:    c.state.Done,
+		Total:   c.state.Total,
+		Elapsed: time.Since(c.start),
+		ETA:     -1,
+	}
+	if p.Elapsed > 0 {
+		p.Rate = float64(p.Done-c.startDone) / p.Elapsed.Seconds()
+	}
+	if p.Total > 0 && p.Rate > 0 {
+		remain := p.Total - p.Done
+		if remain < 0 {
+			remain = 0
+		}
+		p.ETA = time.Duration(float64(remain) / p.Rate * float64(time.Second))
+	}
+	return p
+}
+
+func (c *Checkpoint) report(event string) {
+	fmt.Fprintf(c.out, "[%s] %s %s\n", c.name, event, c.Progress())
+}
+
+/**
+ * 执行可恢复的命令
+ * fn成功返回时删除进度；返回错误或者ctx被取消(如收到SIGINT/SIGTERM)时保存进度，下次执行时从保存的游标继续
+ * @param args 同Open
+ */
+func Run(ctx context.Context, store Store, name string, fn func(ctx context.Context, c *Checkpoint) error, args ...interface{}) error {
+	c, err := Open(ctx, store, name, args...)
+	if err != nil {
+		return err
+	}
+
+	err = fn(ctx, c)
+	if err == nil && ctx.Err() == nil {
+		return c.Finish(context.Background())
+	}
+
+	//ctx可能已经取消，使用新的ctx保存进度
+	if saveErr := c.Save(context.Background()); saveErr != nil {
+		fmt.Fprintf(c.out, "[%s] save checkpoint error: %v\n", name, saveErr)
+	} else {
+		c.report("stopped")
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
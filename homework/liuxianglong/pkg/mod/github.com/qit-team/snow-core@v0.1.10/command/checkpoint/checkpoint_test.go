@@ -0,0 +1,174 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mapStore struct {
+	mu sync.Mutex
+	mp map[string]State
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{mp: make(map[string]State)}
+}
+
+func (s *mapStore) Load(ctx context.Context, name string) (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.mp[name]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (s *mapStore) Save(ctx context.Context, name string, state State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mp[name] = state
+	return nil
+}
+
+func (s *mapStore) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.mp, name)
+	return nil
+}
+
+func TestCheckpoint_Advance(t *testing.T) {
+	ctx := context.TODO()
+	store := newMapStore()
+	out := new(bytes.Buffer)
+
+	c, err := Open(ctx, store, "test", SaveInterval(time.Hour), out)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if c.Resumed() || c.Cursor() != "" {
+		t.Error("first run must not resume")
+		return
+	}
+
+	c.Advance(ctx, "10", 10)
+	if state, _ := store.Load(ctx, "test"); state != nil {
+		t.Error("checkpoint must not be saved before the interval", state)
+		return
+	}
+	if err = c.Save(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	state, _ := store.Load(ctx, "test")
+	if state == nil || state.Cursor != "10" || state.Done != 10 {
+		t.Error("checkpoint must be saved", state)
+		return
+	}
+
+	c2, _ := Open(ctx, store, "test", out)
+	if !c2.Resumed() || c2.Cursor() != "10" || c2.State().Done != 10 {
+		t.Error("second run must resume", c2.State())
+		return
+	}
+	if !strings.Contains(out.String(), `resume from cursor "10"`) {
+		t.Error("resume must be printed", out.String())
+	}
+
+	c3, _ := Open(ctx, store, "test", Restart(true), out)
+	if c3.Resumed() {
+		t.Error("restart must ignore the checkpoint")
+	}
+	if state, _ := store.Load(ctx, "test"); state != nil {
+		t.Error("restart must delete the checkpoint", state)
+	}
+}
+
+func TestCheckpoint_Progress(t *testing.T) {
+	ctx := context.TODO()
+	store := newMapStore()
+	store.Save(ctx, "test", State{Cursor: "50", Done: 50, Total: 200})
+
+	c, _ := Open(ctx, store, "test", new(bytes.Buffer))
+	p := c.Progress()
+	if p.ETA != -1 {
+		t.Error("eta must be unknown before any progress", p)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	c.Advance(ctx, "100", 50)
+	p = c.Progress()
+	if p.Percent() != 50 {
+		t.Error("percent error", p.Percent())
+	}
+	//本次执行的速度约为500/s，剩余100约0.2秒
+	if p.ETA <= 0 || p.ETA > time.Second {
+		t.Error("eta error", p)
+	}
+
+	c.SetTotal(0)
+	if p = c.Progress(); p.ETA != -1 || p.Percent() != -1 {
+		t.Error("eta must be unknown without total", p)
+	}
+}
+
+func TestRun(t *testing.T) {
+	store := newMapStore()
+	out := new(bytes.Buffer)
+	process := func(ctx context.Context, c *Checkpoint) error {
+		start, _ := strconv.Atoi(c.Cursor())
+		for i := start; i < 10; i++ {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if i == 5 && start == 0 {
+				return errors.New("failed at 5")
+			}
+			c.Advance(ctx, strconv.Itoa(i+1), 1)
+		}
+		return nil
+	}
+
+	err := Run(context.TODO(), store, "test", process, SaveInterval(time.Hour), out)
+	if err == nil {
+		t.Error("error must be returned")
+		return
+	}
+	state, _ := store.Load(context.TODO(), "test")
+	if state == nil || state.Cursor != "5" || state.Done != 5 {
+		t.Error("checkpoint must be saved on error", state)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	err = Run(ctx, store, "test", process, out)
+	if err != context.Canceled {
+		t.Error("canceled run must return ctx error", err)
+		return
+	}
+	if state, _ := store.Load(context.TODO(), "test"); state == nil || state.Cursor != "5" {
+		t.Error("checkpoint must be kept on cancel", state)
+		return
+	}
+
+	err = Run(context.TODO(), store, "test", process, out)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if state, _ := store.Load(context.TODO(), "test"); state != nil {
+		t.Error("checkpoint must be deleted on finish", state)
+	}
+	if !strings.Contains(out.String(), "finished 10") {
+		t.Error("finish must be printed", out.String())
+	}
+}
@@ -0,0 +1,116 @@
+package checkpoint
+
+import (
+	"context"
+	"github.com/go-xorm/xorm"
+	"github.com/qit-team/snow-core/db"
+	"sync"
+	"time"
+)
+
+var (
+	dmp map[string]*DbStore
+	dmu sync.RWMutex
+)
+
+/**
+ * 进度表的实体，name为主键，同一进度只有一条记录
+ */
+type checkpointRow struct {
+	Name      string    `xorm:"varchar(191) pk 'name'"`
+	Cursor    string    `xorm:"text 'cursor'"`
+	Done      int64     `xorm:"bigint 'done'"`
+	Total     int64     `xorm:"bigint 'total'"`
+	UpdatedAt time.Time `xorm:"'updated_at'"`
+}
+
+func (m *checkpointRow) TableName() string {
+	return "command_checkpoint"
+}
+
+//基于数据库的进度存储，使用前需要调用Sync创建command_checkpoint表
+type DbStore struct {
+	diName string
+}
+
+//单例模式
+func GetDbStore(diName string) *DbStore {
+	key := diName
+	dmu.RLock()
+	s, ok := dmp[key]
+	dmu.RUnlock()
+	if ok {
+		return s
+	}
+
+	s = &DbStore{diName: diName}
+	dmu.Lock()
+	dmp[key] = s
+	dmu.Unlock()
+	return s
+}
+
+func (m *DbStore) getDb() *xorm.EngineGroup {
+	return db.GetDb(m.diName)
+}
+
+//同步进度表的结构，表不存在时创建
+func (m *DbStore) Sync() error {
+	return m.getDb().Sync2(new(checkpointRow))
+}
+
+func (m *DbStore) Load(ctx context.Context, name string) (*State, error) {
+	row := new(checkpointRow)
+	has, err := m.getDb().Master().Where("name = ?", name).Get(row)
+	if err != nil || !has {
+		return nil, err
+	}
+	return &State{
+		Cursor:    row.Cursor,
+		Done:      row.Done,
+		Total:     row.Total,
+		UpdatedAt: row.UpdatedAt,
+	}, nil
+}
+
+func (m *DbStore) Save(ctx context.Context, name string, state State) error {
+	row := &checkpointRow{
+		Name:      name,
+		Cursor:    state.Cursor,
+		Done:      state.Done,
+		Total:     state.Total,
+		UpdatedAt: state.UpdatedAt,
+	}
+	engine := m.getDb().Master()
+	n, err := m.update(engine, row)
+	if err != nil || n > 0 {
+		return err
+	}
+
+	//记录不存在时插入，并发插入同一name时主键冲突，改为更新
+	_, err = engine.Insert(row)
+	if err == nil {
+		return nil
+	}
+	if _, uerr := m.update(engine, row); uerr != nil {
+		return err
+	}
+	//进度未变化时更新的行数为0，记录存在即保存成功
+	if has, _ := engine.Where("name = ?", name).Exist(new(checkpointRow)); has {
+		return nil
+	}
+	return err
+}
+
+func (m *DbStore) update(engine *xorm.Engine, row *checkpointRow) (int64, error) {
+	return engine.Where("name = ?", row.Name).AllCols().Update(row)
+}
+
+func (m *DbStore) Delete(ctx context.Context, name string) error {
+	_, err := m.getDb().Master().Where("name = ?", name).Delete(new(checkpointRow))
+	return err
+}
+
+func init() {
+	dmp = make(map[string]*DbStore)
+}
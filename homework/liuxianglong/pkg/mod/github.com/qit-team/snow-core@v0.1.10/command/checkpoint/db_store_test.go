@@ -0,0 +1,104 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"github.com/qit-team/snow-core/config"
+	"github.com/qit-team/snow-core/db"
+	//go test时需要开启
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func init() {
+	m := config.DbBaseConfig{
+		Host:     "127.0.0.1",
+		Port:     3306,
+		User:     "root",
+		Password: "123456",
+		DBName:   "test",
+	}
+	dbConf := config.DbConfig{
+		Driver: "mysql",
+		Master: m,
+	}
+
+	err := db.Pr.Register("db", dbConf, true)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+//创建进度表，数据库不可用时跳过
+func prepareDbStore(t *testing.T, name string) *DbStore {
+	s := GetDbStore("db")
+	if err := s.Sync(); err != nil {
+		t.Skip("database is not available", err)
+	}
+	s.Delete(context.TODO(), name)
+	return s
+}
+
+func TestDbStore(t *testing.T) {
+	ctx := context.TODO()
+	name := "test-db-store"
+	s := prepareDbStore(t, name)
+
+	err := s.Save(ctx, name, State{Cursor: "100", Done: 100, Total: 1000})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//进度未变化时重复保存不报错
+	err = s.Save(ctx, name, State{Cursor: "100", Done: 100, Total: 1000})
+	if err != nil {
+		t.Error("save unchanged state error", err)
+		return
+	}
+	err = s.Save(ctx, name, State{Cursor: "200", Done: 200, Total: 1000})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	state, err := s.Load(ctx, name)
+	if err != nil || state == nil || state.Cursor != "200" || state.Done != 200 {
+		t.Error("load error", state, err)
+		return
+	}
+
+	s.Delete(ctx, name)
+	if state, _ = s.Load(ctx, name); state != nil {
+		t.Error("checkpoint must be deleted", state)
+	}
+}
+
+func TestDbStore_concurrentSave(t *testing.T) {
+	ctx := context.TODO()
+	name := "test-db-store-concurrent"
+	s := prepareDbStore(t, name)
+
+	//并发首次保存同一进度时不会因主键冲突失败
+	errs := make(chan error, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.Save(ctx, name, State{Cursor: strconv.Itoa(i), Done: int64(i)})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error("concurrent save error", err)
+			return
+		}
+	}
+	if state, _ := s.Load(ctx, name); state == nil {
+		t.Error("checkpoint must be saved")
+	}
+	s.Delete(ctx, name)
+}
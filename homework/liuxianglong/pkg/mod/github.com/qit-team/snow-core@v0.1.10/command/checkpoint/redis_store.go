@@ -0,0 +1,80 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	redis_pool "github.com/hetiansu5/go-redis-pool"
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/snow-core/utils"
+	"sync"
+)
+
+//进度key的前缀，完整key为 <prefix><name>
+const redisKeyPrefix = "snow:checkpoint:"
+
+var (
+	rmp map[string]*RedisStore
+	rmu sync.RWMutex
+)
+
+//基于redis的进度存储，进度不过期，执行完成时删除
+type RedisStore struct {
+	client *redis_pool.ReplicaPool
+}
+
+//new实例，读写都走主库
+func newRedisStore(diName string) *RedisStore {
+	m := new(RedisStore)
+	m.client = redis.GetRedis(diName).WithMaster()
+	return m
+}
+
+//单例模式
+func GetRedisStore(diName string) *RedisStore {
+	key := diName
+	rmu.RLock()
+	s, ok := rmp[key]
+	rmu.RUnlock()
+	if ok {
+		return s
+	}
+
+	s = newRedisStore(diName)
+	rmu.Lock()
+	rmp[key] = s
+	rmu.Unlock()
+	return s
+}
+
+func (m *RedisStore) Load(ctx context.Context, name string) (*State, error) {
+	value, err := m.client.Get(redisKeyPrefix + name)
+	if err == redis_pool.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := new(State)
+	if err = json.Unmarshal([]byte(value), state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (m *RedisStore) Save(ctx context.Context, name string, state State) error {
+	value, err := utils.JsonEncode(state)
+	if err != nil {
+		return err
+	}
+	_, err = m.client.Set(redisKeyPrefix+name, value)
+	return err
+}
+
+func (m *RedisStore) Delete(ctx context.Context, name string) error {
+	_, err := m.client.Del(redisKeyPrefix + name)
+	return err
+}
+
+func init() {
+	rmp = make(map[string]*RedisStore)
+}
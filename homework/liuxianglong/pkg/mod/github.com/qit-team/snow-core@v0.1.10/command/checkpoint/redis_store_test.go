@@ -0,0 +1,54 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"github.com/qit-team/snow-core/config"
+	"github.com/qit-team/snow-core/redis"
+)
+
+func init() {
+	redisConf := config.RedisConfig{
+		Master: config.RedisBaseConfig{
+			Host: "127.0.0.1",
+			Port: 6379,
+		},
+	}
+
+	//注册redis类
+	err := redis.Pr.Register("redis", redisConf, true)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.TODO()
+	s := GetRedisStore("redis")
+	name := "test-redis-store"
+	s.Delete(ctx, name)
+
+	state, err := s.Load(ctx, name)
+	if err != nil || state != nil {
+		t.Error("checkpoint must not exist", state, err)
+		return
+	}
+
+	err = s.Save(ctx, name, State{Cursor: "100", Done: 100, Total: 1000})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	state, err = s.Load(ctx, name)
+	if err != nil || state == nil || state.Cursor != "100" || state.Done != 100 || state.Total != 1000 {
+		t.Error("load error", state, err)
+		return
+	}
+
+	s.Delete(ctx, name)
+	state, _ = s.Load(ctx, name)
+	if state != nil {
+		t.Error("checkpoint must be deleted", state)
+	}
+}
@@ -1,43 +1,198 @@
 package command
 
 import (
-	"sync"
+	"context"
 	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+//帮助命令的名称
+const HelpName = "help"
+
+//退出码
+const (
+	ExitOk = 0
+	//命令执行失败
+	ExitFailed = 1
+	//命令不存在或者参数错误
+	ExitUsage = 2
 )
 
 var (
 	ErrUnknownName = errors.New("unknown name")
+	ErrUsage       = errors.New("invalid arguments")
 )
 
+/**
+ * 命令定义
+ * 参数通过Flags定义到flag.FlagSet，Run中通过fs.Args()获取位置参数
+ */
+type Cmd struct {
+	Name string
+	//命令说明，help中展示
+	Description string
+	//位置参数的说明，如 "<start_id> <end_id>"
+	Usage string
+	//定义命令的参数，可选
+	Flags func(fs *flag.FlagSet)
+	//位置参数的最少个数
+	MinArgs int
+	//执行函数，返回的错误会转换为进程的退出码，见ExitCode
+	Run func(ctx context.Context, fs *flag.FlagSet) error
+}
+
 //一次性任务脚本
 type Command struct {
 	mu        sync.RWMutex
-	container map[string]func()
+	container map[string]*Cmd
+	//帮助信息的输出
+	out io.Writer
 }
 
 //new实例
 func New() *Command {
 	c := new(Command)
-	c.container = make(map[string]func())
+	c.container = make(map[string]*Cmd)
+	c.out = os.Stdout
 	return c
 }
 
+//设置帮助信息的输出，默认为标准输出
+func (c *Command) SetOutput(w io.Writer) {
+	c.out = w
+}
+
 //绑定name与函数的关系
 func (c *Command) AddFunc(name string, f func()) {
+	c.Add(&Cmd{
+		Name: name,
+		Run: func(ctx context.Context, fs *flag.FlagSet) error {
+			f()
+			return nil
+		},
+	})
+}
+
+//注册命令，同名的命令会被覆盖
+func (c *Command) Add(cmd *Cmd) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.container[name] = f
+	c.container[cmd.Name] = cmd
 }
 
 //通过name执行函数
-func (c *Command) Execute(name string) (err error) {
+func (c *Command) Execute(name string, args ...string) error {
+	return c.ExecuteContext(context.Background(), name, args...)
+}
+
+/**
+ * 通过name执行命令，args为命令的参数
+ * name为help或者为空时输出全部命令；args包含-h时输出命令的用法
+ */
+func (c *Command) ExecuteContext(ctx context.Context, name string, args ...string) error {
+	if name == "" || name == HelpName {
+		c.PrintHelp()
+		return nil
+	}
+
+	c.mu.RLock()
+	cmd, ok := c.container[name]
+	c.mu.RUnlock()
+	if !ok {
+		fmt.Fprintf(c.out, "unknown command %q\n\n", name)
+		c.PrintHelp()
+		return ErrUnknownName
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.out)
+	fs.Usage = func() {
+		c.printUsage(cmd, fs)
+	}
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return ErrUsage
+	}
+	if fs.NArg() < cmd.MinArgs {
+		fmt.Fprintf(c.out, "command %s requires at least %d arguments\n", name, cmd.MinArgs)
+		fs.Usage()
+		return ErrUsage
+	}
+
+	return cmd.Run(ctx, fs)
+}
+
+//输出全部命令及说明
+func (c *Command) PrintHelp() {
 	c.mu.RLock()
-	f, ok := c.container[name]
+	cmds := make([]*Cmd, 0, len(c.container))
+	for _, cmd := range c.container {
+		cmds = append(cmds, cmd)
+	}
 	c.mu.RUnlock()
-	if ok {
-		f()
-	} else {
-		panic(ErrUnknownName.Error())
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+
+	fmt.Fprintln(c.out, "Usage: -a command -m <name> [-- flags and args]")
+	fmt.Fprintln(c.out, "\nCommands:")
+	for _, cmd := range cmds {
+		fmt.Fprintf(c.out, "  %-20s %s\n", cmd.Name, cmd.Description)
+	}
+	fmt.Fprintf(c.out, "  %-20s %s\n", HelpName, "show this help")
+}
+
+//输出命令的用法
+func (c *Command) printUsage(cmd *Cmd, fs *flag.FlagSet) {
+	fmt.Fprintf(c.out, "Usage: -a command -m %s -- [flags] %s\n", cmd.Name, cmd.Usage)
+	if cmd.Description != "" {
+		fmt.Fprintf(c.out, "\n%s\n", cmd.Description)
+	}
+	fmt.Fprintln(c.out, "\nFlags:")
+	fs.PrintDefaults()
+}
+
+//按退出码返回的错误
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit code %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+//生成指定退出码的错误
+func Exit(code int, err error) error {
+	return &ExitError{Code: code, Err: err}
+}
+
+/**
+ * 命令返回的错误对应的进程退出码
+ * nil为0，ErrUnknownName和ErrUsage为2，ExitError为指定的退出码，其他错误为1
+ */
+func ExitCode(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return ExitOk
+	case *ExitError:
+		return e.Code
+	}
+	if err == ErrUnknownName || err == ErrUsage {
+		return ExitUsage
 	}
-	return
+	return ExitFailed
 }
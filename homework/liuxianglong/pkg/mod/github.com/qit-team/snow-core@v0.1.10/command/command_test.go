@@ -1,21 +1,89 @@
 package command
 
 import (
-	"testing"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"strings"
+	"testing"
 )
 
 func TestNew(t *testing.T) {
 	cmd := New()
 	cmd.AddFunc("test", test)
-	cmd.Execute("test")
-
-	defer func() {
-		if e := recover(); e == nil {
-			t.Error("unknown name do not panic")
-		}
-	}()
-	cmd.Execute("test1")
+	err := cmd.Execute("test")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cmd.SetOutput(&bytes.Buffer{})
+	err = cmd.Execute("test1")
+	if err != ErrUnknownName {
+		t.Error("unknown name must return ErrUnknownName", err)
+	}
+}
+
+func TestCommand_ExecuteContext(t *testing.T) {
+	var (
+		start int
+		dry   bool
+		got   []string
+	)
+	cmd := New()
+	out := &bytes.Buffer{}
+	cmd.SetOutput(out)
+	cmd.Add(&Cmd{
+		Name:        "backfill",
+		Description: "backfill orders",
+		Usage:       "<table>",
+		MinArgs:     1,
+		Flags: func(fs *flag.FlagSet) {
+			fs.IntVar(&start, "start", 0, "start id")
+			fs.BoolVar(&dry, "dry", false, "dry run")
+		},
+		Run: func(ctx context.Context, fs *flag.FlagSet) error {
+			got = fs.Args()
+			if dry {
+				return Exit(3, errors.New("dry run"))
+			}
+			return nil
+		},
+	})
+
+	err := cmd.Execute("backfill", "-start", "10", "orders")
+	if err != nil || start != 10 || len(got) != 1 || got[0] != "orders" {
+		t.Error("args mismatch", err, start, got)
+		return
+	}
+
+	err = cmd.Execute("backfill", "-dry", "orders")
+	if ExitCode(err) != 3 {
+		t.Error("exit code mismatch", err)
+	}
+
+	err = cmd.Execute("backfill", "-start", "10")
+	if ExitCode(err) != ExitUsage {
+		t.Error("missing args must be usage error", err)
+	}
+	err = cmd.Execute("backfill", "-unknown")
+	if ExitCode(err) != ExitUsage {
+		t.Error("unknown flag must be usage error", err)
+	}
+
+	out.Reset()
+	err = cmd.Execute(HelpName)
+	if err != nil || !strings.Contains(out.String(), "backfill orders") {
+		t.Error("help must list commands", err, out.String())
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if ExitCode(nil) != ExitOk || ExitCode(errors.New("failed")) != ExitFailed || ExitCode(ErrUnknownName) != ExitUsage {
+		t.Error("exit code mismatch")
+	}
 }
 
 func test() {
@@ -65,3 +65,21 @@ type ApiConfig struct {
 	Host string
 	Port int
 }
+
+type JobConfig struct {
+	AdminHost   string //管理端口的监听地址
+	AdminPort   int    //管理端口，提供/metrics和/stats接口，0表示不启动
+	StopTimeout int    //平滑关闭时等待处理中任务的超时时间，单位秒，默认60秒
+}
+
+type ConsoleConfig struct {
+	StopTimeout int //平滑关闭时等待执行中cron任务的超时时间，单位秒，默认60秒
+}
+
+type CacheConfig struct {
+	Driver string //缓存驱动类型，redis或memory，默认redis
+}
+
+type QueueConfig struct {
+	Driver string //队列驱动类型，redis、db或memory，默认redis
+}
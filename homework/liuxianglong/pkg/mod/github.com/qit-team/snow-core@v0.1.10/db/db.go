@@ -11,6 +11,9 @@ import (
 	"github.com/go-xorm/xorm"
 	"xorm.io/core"
 	"errors"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 const (
@@ -18,6 +21,9 @@ const (
 	defaultCharset = "utf8mb4"
 )
 
+//各engine是否支持SKIP LOCKED，按数据库版本检测一次后缓存
+var skipLocked sync.Map
+
 func NewEngineGroup(dbConf config.DbConfig) (*xorm.EngineGroup, error) {
 	master, err := newConn(dbConf.Driver, dbConf.Master, dbConf.Option)
 	if err != nil {
@@ -114,6 +120,71 @@ func formatMssqlDSN(base config.DbBaseConfig, option config.DbOptionConfig) stri
 		base.User, base.Password, base.Host, port, base.DBName)
 }
 
+/**
+ * 数据库是否支持SELECT ... FOR UPDATE SKIP LOCKED
+ * 首次调用时查询数据库版本：MySQL 8.0.1、MariaDB 10.6、PostgreSQL 9.5起支持，查询失败时返回false且不缓存
+ */
+func SupportSkipLocked(engine *xorm.Engine) bool {
+	if v, ok := skipLocked.Load(engine); ok {
+		return v.(bool)
+	}
+
+	dbType := engine.Dialect().DBType()
+	if dbType != core.MYSQL && dbType != core.POSTGRES {
+		skipLocked.Store(engine, false)
+		return false
+	}
+	res, err := engine.QueryString("SELECT VERSION() AS version")
+	if err != nil || len(res) == 0 {
+		return false
+	}
+	support := versionSupportSkipLocked(dbType, res[0]["version"])
+	skipLocked.Store(engine, support)
+	return support
+}
+
+//按SELECT VERSION()的结果判断是否支持SKIP LOCKED
+func versionSupportSkipLocked(dbType core.DbType, version string) bool {
+	switch dbType {
+	case core.MYSQL:
+		//MariaDB的版本号形如 10.6.4-MariaDB 或者 5.5.5-10.6.4-MariaDB
+		if strings.Contains(version, "MariaDB") {
+			return versionAtLeast(strings.TrimPrefix(version, "5.5.5-"), 10, 6)
+		}
+		return versionAtLeast(version, 8, 0, 1)
+	case core.POSTGRES:
+		//PostgreSQL的版本号形如 PostgreSQL 9.6.1 on x86_64-pc-linux-gnu ...
+		fields := strings.Fields(version)
+		if len(fields) < 2 {
+			return false
+		}
+		return versionAtLeast(fields[1], 9, 5)
+	}
+	return false
+}
+
+//版本号开头的数字部分是否大于等于min，无法解析时返回false
+func versionAtLeast(version string, min ...int) bool {
+	parts := strings.SplitN(version, ".", len(min)+1)
+	for k, n := range min {
+		if k >= len(parts) {
+			return false
+		}
+		end := 0
+		for end < len(parts[k]) && parts[k][end] >= '0' && parts[k][end] <= '9' {
+			end++
+		}
+		v, err := strconv.Atoi(parts[k][:end])
+		if err != nil {
+			return false
+		}
+		if v != n {
+			return v > n
+		}
+	}
+	return true
+}
+
 func getPortOrDefault(port int, defaultPort int) int {
 	if port == 0 {
 		return defaultPort
@@ -5,6 +5,7 @@ import (
 	"github.com/qit-team/snow-core/config"
 	"github.com/go-xorm/xorm"
 	"fmt"
+	"xorm.io/core"
 	//go test时需要开启
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -61,3 +62,30 @@ func TestGet(t *testing.T) {
 
 	fmt.Println(banner)
 }
+
+func TestVersionSupportSkipLocked(t *testing.T) {
+	cases := []struct {
+		dbType  core.DbType
+		version string
+		want    bool
+	}{
+		{core.MYSQL, "5.7.30-log", false},
+		{core.MYSQL, "8.0.0-dmr", false},
+		{core.MYSQL, "8.0.1", true},
+		{core.MYSQL, "8.0.21", true},
+		{core.MYSQL, "10.5.8-MariaDB-1:10.5.8+maria~focal", false},
+		{core.MYSQL, "5.5.5-10.5.8-MariaDB", false},
+		{core.MYSQL, "10.6.4-MariaDB", true},
+		{core.MYSQL, "5.5.5-10.11.2-MariaDB", true},
+		{core.POSTGRES, "PostgreSQL 9.4.26 on x86_64-pc-linux-gnu", false},
+		{core.POSTGRES, "PostgreSQL 9.5.0 on x86_64-pc-linux-gnu", true},
+		{core.POSTGRES, "PostgreSQL 13.2 on x86_64-pc-linux-gnu", true},
+		{core.SQLITE, "3.31.1", false},
+		{core.MYSQL, "", false},
+	}
+	for _, c := range cases {
+		if got := versionSupportSkipLocked(c.dbType, c.version); got != c.want {
+			t.Error("skip locked support error", c.dbType, c.version, got)
+		}
+	}
+}
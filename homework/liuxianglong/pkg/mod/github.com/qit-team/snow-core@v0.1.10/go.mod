@@ -10,6 +10,7 @@ require (
 	github.com/go-xorm/xorm v0.7.4
 	github.com/gogap/errors v0.0.0-20160523102334-149c546090d0 // indirect
 	github.com/gogap/stack v0.0.0-20150131034635-fef68dddd4f8 // indirect
+	github.com/golang/protobuf v1.3.1
 	github.com/google/uuid v1.1.1
 	github.com/hetiansu5/accesslog v1.0.0
 	github.com/hetiansu5/cores v1.0.0
@@ -17,6 +18,7 @@ require (
 	github.com/qit-team/work v0.3.4
 	github.com/robfig/cron v1.2.0
 	github.com/sirupsen/logrus v1.4.2
+	github.com/ugorji/go v1.1.4
 	github.com/valyala/fasthttp v1.3.0 // indirect
 	xorm.io/core v0.6.3
 )
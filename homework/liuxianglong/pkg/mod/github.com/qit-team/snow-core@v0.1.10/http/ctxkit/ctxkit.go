@@ -47,3 +47,13 @@ func GetHost(ctx context.Context) string {
 	s, _ := ctx.Value(HOST).(string)
 	return s
 }
+
+//非gin场景(如队列任务)往ctx注入trace_id
+func WithTraceId(ctx context.Context, value string) context.Context {
+	return context.WithValue(ctx, TraceId, value)
+}
+
+//非gin场景(如队列任务)往ctx注入客户端ip
+func WithClientId(ctx context.Context, value string) context.Context {
+	return context.WithValue(ctx, ClientIp, value)
+}
@@ -3,6 +3,7 @@ package ctxkit
 import (
 	"testing"
 	"github.com/gin-gonic/gin"
+	"context"
 )
 
 var c *gin.Context
@@ -50,3 +51,23 @@ func TestGetServerId(t *testing.T) {
 		return
 	}
 }
+
+func TestWithTraceId(t *testing.T) {
+	v := "5"
+	ctx := WithTraceId(context.Background(), v)
+	v1 := GetTraceId(ctx)
+	if v1 != v {
+		t.Error("TraceId miss match")
+		return
+	}
+}
+
+func TestWithClientId(t *testing.T) {
+	v := "6"
+	ctx := WithClientId(context.Background(), v)
+	v1 := GetClientId(ctx)
+	if v1 != v {
+		t.Error("ClientId miss match")
+		return
+	}
+}
@@ -1,14 +1,32 @@
 package server
 
 import (
+	"context"
 	"github.com/qit-team/snow-core/command"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 // Execute one-time command
-func ExecuteCommand(name string, registerCommand func(*command.Command)) error {
+// args为命令的参数，收到退出信号时取消命令的ctx；返回的错误可以通过command.ExitCode转换为进程退出码
+func ExecuteCommand(name string, registerCommand func(*command.Command), args ...string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(ch)
+	go func() {
+		select {
+		case <-ch:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	//注册并执行某个name对应的脚本
 	c := command.New()
 	registerCommand(c)
-	err := c.Execute(name)
-	return err
+	return c.ExecuteContext(ctx, name, args...)
 }
@@ -1,34 +1,54 @@
 package server
 
 import (
+	"github.com/qit-team/snow-core/config"
+	"github.com/qit-team/snow-core/schedule"
 	"github.com/robfig/cron"
 	"fmt"
 	"time"
 )
 
-func waitConsoleStop(c *cron.Cron) {
+//等待执行中cron任务的默认超时时间
+const defaultConsoleStopTimeout = 60 * time.Second
+
+func waitConsoleStop(c *cron.Cron, stopTimeout time.Duration) {
 	//等待结束
 	WaitStop()
 
 	//暂停新的Cron任务执行
 	c.Stop()
 
-	//等待执行中的cron任务结束，目前简单实现等待5s后结束
+	//释放调度器持有的leader锁，其他实例可以立即接管
+	schedule.StopSchedulers()
+
+	//等待执行中的cron任务结束，超时后取消任务的ctx
+	report := schedule.Shutdown(stopTimeout)
+	if report.TimedOut {
+		fmt.Println("wait stop timeout, interrupted cron jobs:", len(report.Interrupted))
+		for _, run := range report.Interrupted {
+			fmt.Println("interrupted cron job", run.Name, run.Start.Format(time.RFC3339), run.Duration)
+		}
+	}
 	if GetDebug() {
-		fmt.Println("wait 5 sencods")
+		fmt.Printf("cron stopped, elapsed:%s\n", report.Elapsed)
 	}
-	time.Sleep(time.Second * 5)
 
 	CloseService()
 }
 
 // Start Cron Schedule
-func StartConsole(pidFile string, registerSchedule func(*cron.Cron)) error {
+// consoleConf可选，配置了StopTimeout时按配置等待执行中的任务
+func StartConsole(pidFile string, registerSchedule func(*cron.Cron), consoleConf ...config.ConsoleConfig) error {
 	//注册Cron执行计划
 	cronEngine := cron.New()
 	registerSchedule(cronEngine)
 	cronEngine.Start()
 
+	stopTimeout := defaultConsoleStopTimeout
+	if len(consoleConf) > 0 && consoleConf[0].StopTimeout > 0 {
+		stopTimeout = time.Duration(consoleConf[0].StopTimeout) * time.Second
+	}
+
 	//写pid文件
 	WritePidFile(pidFile)
 
@@ -36,6 +56,6 @@ func StartConsole(pidFile string, registerSchedule func(*cron.Cron)) error {
 	RegisterSignal()
 
 	//等待停止信号
-	waitConsoleStop(cronEngine)
+	waitConsoleStop(cronEngine, stopTimeout)
 	return nil
 }
@@ -4,30 +4,64 @@ import (
 	"fmt"
 	"github.com/qit-team/work"
 	"time"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"github.com/qit-team/snow-core/http/ctxkit"
+	"github.com/qit-team/snow-core/config"
 )
 
-func waitJobStop(job *work.Job) {
+//平滑关闭的默认超时时间
+const defaultJobStopTimeout = 60 * time.Second
+
+func waitJobStop(job *work.Job, admin *http.Server, stopTimeout time.Duration) {
 	//等待结束
 	WaitStop()
 
-	//暂停新的Cron任务执行
-	job.Stop()
+	//停止拉取新任务，未开始处理的任务放回队列，等待处理中的任务完成
+	report := job.Shutdown(stopTimeout)
+	if report.TimedOut {
+		fmt.Println("wait stop timeout, abandoned tasks:", len(report.Abandoned))
+		for _, task := range report.Abandoned {
+			fmt.Println("abandoned task", task.Topic, task.Id)
+		}
+	}
+	if len(report.RequeueFailed) > 0 {
+		fmt.Println("requeue failed tasks:", len(report.RequeueFailed))
+	}
+	if srv.debug {
+		fmt.Printf("job stopped, requeued:%d elapsed:%s\n", report.Requeued, report.Elapsed)
+	}
 
-	err := job.WaitStop(60 * time.Second)
-	if err != nil {
-		fmt.Println("wait stop error", err)
+	//任务处理完成后再关闭管理端口，方便观察退出过程
+	if admin != nil {
+		admin.Close()
 	}
 
 	CloseService()
 }
 
 // Start Job Worker
-func StartJob(pidFile string, registerWorker func(*work.Job)) error {
+// jobConf可选，配置了AdminPort时会启动管理端口
+func StartJob(pidFile string, registerWorker func(*work.Job), jobConf ...config.JobConfig) error {
 	//注册Job Worker
 	job := work.New()
+	job.RegisterTaskContextCallback(taskContext)
 	registerWorker(job)
 	job.Start()
 
+	var admin *http.Server
+	stopTimeout := defaultJobStopTimeout
+	if len(jobConf) > 0 {
+		if jobConf[0].AdminPort > 0 {
+			admin = startJobAdmin(job, jobConf[0])
+		}
+		if jobConf[0].StopTimeout > 0 {
+			stopTimeout = time.Duration(jobConf[0].StopTimeout) * time.Second
+		}
+	}
+
 	//写pid文件
 	WritePidFile(pidFile)
 
@@ -35,6 +69,45 @@ func StartJob(pidFile string, registerWorker func(*work.Job)) error {
 	RegisterSignal()
 
 	//等待停止信号
-	waitJobStop(job)
+	waitJobStop(job, admin, stopTimeout)
 	return nil
 }
+
+//任务处理函数的ctx注入入队时透传的trace_id和客户端ip，使logger记录的日志可以和入队请求串联
+//入队时没有trace_id的任务使用任务id
+func taskContext(ctx context.Context, task work.Task) context.Context {
+	traceId := task.GetHeader(ctxkit.TraceId)
+	if traceId == "" {
+		traceId = task.Id
+	}
+	ctx = ctxkit.WithTraceId(ctx, traceId)
+
+	if cip := task.GetHeader(ctxkit.ClientIp); cip != "" {
+		ctx = ctxkit.WithClientId(ctx, cip)
+	}
+	return ctx
+}
+
+//启动job进程的管理端口：/metrics为Prometheus文本格式的指标，/stats为json格式的统计数据
+func startJobAdmin(job *work.Job, jobConf config.JobConfig) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", job.MetricsHandler())
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"total":  job.Stats(),
+			"topics": job.StatsByTopic(),
+		})
+	})
+
+	admin := &http.Server{
+		Addr:    jobConf.AdminHost + ":" + strconv.Itoa(jobConf.AdminPort),
+		Handler: mux,
+	}
+	go func() {
+		if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Println("job admin server error", err)
+		}
+	}()
+	return admin
+}
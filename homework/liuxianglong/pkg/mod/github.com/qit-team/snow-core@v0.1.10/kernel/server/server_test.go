@@ -1,6 +1,11 @@
 package server
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"github.com/qit-team/snow-core/http/ctxkit"
+	"github.com/qit-team/work"
+)
 
 func TestGetDebug(t *testing.T) {
 	debug := GetDebug()
@@ -15,3 +20,24 @@ func TestGetDebug(t *testing.T) {
 		return
 	}
 }
+
+func Test_taskContext(t *testing.T) {
+	task := work.Task{Id: "task-id"}
+	ctx := taskContext(context.Background(), task)
+	if ctxkit.GetTraceId(ctx) != task.Id {
+		t.Error("trace id is not task id")
+		return
+	}
+
+	task.SetHeader(ctxkit.TraceId, "trace-id")
+	task.SetHeader(ctxkit.ClientIp, "127.0.0.1")
+	ctx = taskContext(context.Background(), task)
+	if ctxkit.GetTraceId(ctx) != "trace-id" {
+		t.Error("trace id is not from header")
+		return
+	}
+	if ctxkit.GetClientId(ctx) != "127.0.0.1" {
+		t.Error("client ip is not from header")
+		return
+	}
+}
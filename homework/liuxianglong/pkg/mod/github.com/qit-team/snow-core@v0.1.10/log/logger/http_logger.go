@@ -5,6 +5,7 @@ import (
 	"context"
 	"os"
 	"github.com/qit-team/snow-core/http/ctxkit"
+	"github.com/qit-team/work"
 )
 
 var (
@@ -66,6 +67,15 @@ func formatLog(c context.Context, t string, args ...*withField) logrus.Fields {
 		if cip != "" {
 			data["cip"] = cip
 		}
+
+		//队列任务处理函数中记录任务信息
+		if task, ok := work.TaskFromContext(c); ok {
+			data["task_id"] = task.Id
+			data["topic"] = task.Topic
+			if task.Attempt > 0 {
+				data["attempt"] = task.Attempt
+			}
+		}
 	}
 
 	for _, field := range args {
@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"context"
+	"testing"
+	"github.com/qit-team/snow-core/http/ctxkit"
+	"github.com/qit-team/work"
+)
+
+func Test_formatLog(t *testing.T) {
+	task := work.Task{Id: "task-id", Topic: "topic-test", Attempt: 2}
+	ctx := ctxkit.WithTraceId(work.WithTask(context.Background(), task), "trace-id")
+
+	data := formatLog(ctx, "test", NewWithField("key", "value"))
+	if data["trace_id"] != "trace-id" {
+		t.Error("trace_id is not in log fields")
+		return
+	}
+	if data["task_id"] != task.Id || data["topic"] != task.Topic || data["attempt"] != task.Attempt {
+		t.Error("task info is not in log fields", data)
+		return
+	}
+	if data["key"] != "value" {
+		t.Error("with field is not in log fields")
+		return
+	}
+
+	data = formatLog(context.Background(), "test")
+	if _, ok := data["task_id"]; ok {
+		t.Error("task_id should not be in log fields")
+		return
+	}
+}
@@ -0,0 +1,63 @@
+package codec
+
+import (
+	"errors"
+	"github.com/golang/protobuf/proto"
+	"github.com/qit-team/work"
+	ugcodec "github.com/ugorji/go/codec"
+)
+
+var ErrNotProtoMessage = errors.New("value does not implement proto.Message")
+
+var (
+	//msgpack编码器
+	Msgpack work.Codec = &msgpackCodec{handle: &ugcodec.MsgpackHandle{}}
+	//protobuf编码器，payload需要实现proto.Message
+	Protobuf work.Codec = protobufCodec{}
+)
+
+//注册到work，消费时可以按任务header中的编码器名称解码
+func init() {
+	work.RegisterCodec(Msgpack)
+	work.RegisterCodec(Protobuf)
+}
+
+type msgpackCodec struct {
+	handle *ugcodec.MsgpackHandle
+}
+
+func (c *msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (c *msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var data []byte
+	err := ugcodec.NewEncoderBytes(&data, c.handle).Encode(v)
+	return data, err
+}
+
+func (c *msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return ugcodec.NewDecoderBytes(data, c.handle).Decode(v)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string {
+	return "protobuf"
+}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,71 @@
+package codec
+
+import (
+	"testing"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/qit-team/work"
+)
+
+type order struct {
+	OrderNo string
+	Amount  int64
+}
+
+func TestMsgpack(t *testing.T) {
+	data, err := Msgpack.Marshal(order{OrderNo: "no-1", Amount: 100})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var o order
+	err = Msgpack.Unmarshal(data, &o)
+	if err != nil {
+		t.Error(err)
+	} else if o.OrderNo != "no-1" || o.Amount != 100 {
+		t.Error("msgpack decode mismatch", o)
+	}
+}
+
+func TestProtobuf(t *testing.T) {
+	data, err := Protobuf.Marshal(&wrappers.StringValue{Value: "no-1"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var v wrappers.StringValue
+	err = Protobuf.Unmarshal(data, &v)
+	if err != nil {
+		t.Error(err)
+	} else if v.Value != "no-1" {
+		t.Error("protobuf decode mismatch", v.Value)
+	}
+
+	_, err = Protobuf.Marshal(order{})
+	if err != ErrNotProtoMessage {
+		t.Error("non proto message must be rejected", err)
+	}
+}
+
+func TestPayloadTask(t *testing.T) {
+	j := work.New()
+	j.SetTopicCodec("topic-codec", Msgpack)
+	task, err := j.PayloadTask("topic-codec", order{OrderNo: "no-2", Amount: 200})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if task.GetHeader(work.HeaderCodec) != "msgpack" {
+		t.Error("codec header mismatch", task.Headers)
+	}
+
+	//消费端未设置topic编码器时按header解码
+	var o order
+	err = work.New().DecodePayload(task, &o)
+	if err != nil {
+		t.Error(err)
+	} else if o.OrderNo != "no-2" || o.Amount != 200 {
+		t.Error("payload decode mismatch", o)
+	}
+}
@@ -0,0 +1,343 @@
+package dbqueue
+
+import (
+	"context"
+	"errors"
+	"github.com/go-xorm/xorm"
+	"github.com/qit-team/snow-core/db"
+	"github.com/qit-team/snow-core/queue"
+	"github.com/qit-team/snow-core/utils"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//消息出队后默认的可见性超时时间，超时未ack的消息会被重新投递
+	DefaultVisibilityTimeout = 30 * time.Second
+	//乐观锁出队时被其他消费者抢占后的最大尝试次数
+	casRetries = 3
+)
+
+var (
+	mp map[string]queue.Queue
+	mu sync.RWMutex
+)
+
+/**
+ * 队列消息表的实体
+ * 出队时将available_at推迟到可见性超时时间并生成新的token，ack时按id和token删除
+ */
+type queueMessage struct {
+	Id      int64  `xorm:"pk autoincr 'id'"`
+	Topic   string `xorm:"varchar(191) notnull index(idx_topic_available) 'topic'"`
+	Message string `xorm:"mediumtext notnull 'message'"`
+	//可以出队的毫秒时间戳，延迟消息为到期时间，处理中的消息为可见性超时时间
+	AvailableAt int64 `xorm:"bigint notnull index(idx_topic_available) 'available_at'"`
+	//最近一次出队的token
+	Token string `xorm:"varchar(64) notnull default '' 'token'"`
+	//出队次数
+	Attempts  int   `xorm:"int notnull default 0 'attempts'"`
+	CreatedAt int64 `xorm:"bigint notnull 'created_at'"`
+}
+
+func (m *queueMessage) TableName() string {
+	return "queue_message"
+}
+
+/**
+ * 基于数据库表的队列，使用前需要调用Sync创建queue_message表
+ * 数据库版本支持时(MySQL 8.0.1、MariaDB 10.6、PostgreSQL 9.5起)使用SELECT ... FOR UPDATE SKIP LOCKED出队，其他使用乐观锁出队
+ */
+type DbQueue struct {
+	diName string
+	//可见性超时时间
+	visibilityTimeout time.Duration
+	//数据库支持时是否使用SKIP LOCKED出队
+	skipLocked bool
+}
+
+//new实例
+func newDbQueue(diName string) queue.Queue {
+	m := new(DbQueue)
+	m.diName = diName
+	m.visibilityTimeout = DefaultVisibilityTimeout
+	m.skipLocked = true
+	return m
+}
+
+//单例模式
+func GetDbQueue(diName string) queue.Queue {
+	key := diName
+	mu.RLock()
+	q, ok := mp[key]
+	mu.RUnlock()
+	if ok {
+		return q
+	}
+
+	q = newDbQueue(diName)
+	mu.Lock()
+	mp[key] = q
+	mu.Unlock()
+	return q
+}
+
+//设置可见性超时时间，需要大于任务的最长处理时间，否则未处理完成的消息会被重复投递
+func (m *DbQueue) SetVisibilityTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		m.visibilityTimeout = timeout
+	}
+}
+
+//可见性超时时间，Job启动时检查worker的任务超时时间是否小于此时间
+func (m *DbQueue) VisibilityTimeout() time.Duration {
+	return m.visibilityTimeout
+}
+
+//是否在数据库支持时使用SKIP LOCKED出队，关闭后总是使用乐观锁出队
+func (m *DbQueue) SetSkipLocked(skipLocked bool) {
+	m.skipLocked = skipLocked
+}
+
+//读写都走主库
+func (m *DbQueue) getEngine() *xorm.Engine {
+	return db.GetDb(m.diName).Master()
+}
+
+//同步队列消息表的结构，表不存在时创建
+func (m *DbQueue) Sync() error {
+	return m.getEngine().Sync2(new(queueMessage))
+}
+
+/**
+ * 队列消息入队
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *DbQueue) Enqueue(ctx context.Context, key string, message string, args ...interface{}) (bool, error) {
+	return m.BatchEnqueue(ctx, key, []string{message}, args...)
+}
+
+/**
+ * 队列消息批量入队，一条insert语句写入
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *DbQueue) BatchEnqueue(ctx context.Context, key string, messages []string, args ...interface{}) (bool, error) {
+	if len(messages) == 0 {
+		return false, errors.New("messages is empty")
+	}
+
+	now := utils.GetCurrentMilliTime()
+	availableAt := now + queue.GetDelay(args...)*1000
+	rows := make([]*queueMessage, len(messages))
+	for k, message := range messages {
+		rows[k] = &queueMessage{
+			Topic:       key,
+			Message:     message,
+			AvailableAt: availableAt,
+			CreatedAt:   now,
+		}
+	}
+	_, err := m.getEngine().Insert(rows)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+/**
+ * 队列消息出队，消息不存在时返回空字符串
+ * 返回的token为 <id>|<uuid>，超过可见性超时时间未ack的消息会被重新投递，之前的token失效
+ */
+func (m *DbQueue) Dequeue(ctx context.Context, key string) (message string, token string, err error) {
+	engine := m.getEngine()
+	if m.skipLocked && db.SupportSkipLocked(engine) {
+		return m.dequeueSkipLocked(engine, key)
+	}
+	return m.dequeueCAS(engineStore{engine}, key)
+}
+
+//在事务中锁定一条可出队的消息，跳过其他消费者已锁定的行
+func (m *DbQueue) dequeueSkipLocked(engine *xorm.Engine, key string) (string, string, error) {
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return "", "", err
+	}
+
+	now := utils.GetCurrentMilliTime()
+	row := new(queueMessage)
+	has, err := session.SQL("SELECT * FROM queue_message WHERE topic = ? AND available_at <= ? ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED",
+		key, now).Get(row)
+	if err != nil || !has {
+		session.Rollback()
+		return "", "", err
+	}
+
+	token := utils.GenUUID()
+	_, err = session.Exec("UPDATE queue_message SET token = ?, available_at = ?, attempts = attempts + 1 WHERE id = ?",
+		token, m.deadline(now), row.Id)
+	if err != nil {
+		session.Rollback()
+		return "", "", err
+	}
+	if err = session.Commit(); err != nil {
+		return "", "", err
+	}
+	return row.Message, formatToken(row.Id, token), nil
+}
+
+//乐观锁出队用到的读写操作
+type casStore interface {
+	//按id顺序查询一条可出队的消息
+	firstAvailable(key string, now int64) (*queueMessage, bool, error)
+	//消息的token和available_at未被修改时更新为新值，返回更新的行数
+	compareAndSwap(row *queueMessage, token string, availableAt int64) (int64, error)
+}
+
+//基于xorm.Engine的casStore
+type engineStore struct {
+	engine *xorm.Engine
+}
+
+func (s engineStore) firstAvailable(key string, now int64) (*queueMessage, bool, error) {
+	row := new(queueMessage)
+	has, err := s.engine.Where("topic = ? AND available_at <= ?", key, now).OrderBy("id").Get(row)
+	return row, has, err
+}
+
+func (s engineStore) compareAndSwap(row *queueMessage, token string, availableAt int64) (int64, error) {
+	res, err := s.engine.Exec("UPDATE queue_message SET token = ?, available_at = ?, attempts = attempts + 1 WHERE id = ? AND token = ? AND available_at = ?",
+		token, availableAt, row.Id, row.Token, row.AvailableAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+//查询一条可出队的消息后按原token和available_at更新，被其他消费者抢占时重新查询
+func (m *DbQueue) dequeueCAS(store casStore, key string) (string, string, error) {
+	for i := 0; i < casRetries; i++ {
+		now := utils.GetCurrentMilliTime()
+		row, has, err := store.firstAvailable(key, now)
+		if err != nil || !has {
+			return "", "", err
+		}
+
+		token := utils.GenUUID()
+		n, err := store.compareAndSwap(row, token, m.deadline(now))
+		if err != nil {
+			return "", "", err
+		}
+		if n > 0 {
+			return row.Message, formatToken(row.Id, token), nil
+		}
+	}
+	return "", "", nil
+}
+
+/**
+ * 确认消息接收，删除消息
+ * 消息已经因超时被重新投递时返回false
+ */
+func (m *DbQueue) AckMsg(ctx context.Context, key string, token string) (bool, error) {
+	id, uuid, ok := parseToken(token)
+	if !ok {
+		return false, errors.New("invalid token")
+	}
+	res, err := m.getEngine().Exec("DELETE FROM queue_message WHERE id = ? AND token = ?", id, uuid)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+/**
+ * 队列消息数，包括未到期的延迟消息和处理中的消息
+ */
+func (m *DbQueue) Len(ctx context.Context, key string) (int64, error) {
+	return m.getEngine().Where("topic = ?", key).Count(new(queueMessage))
+}
+
+/**
+ * 按位置查看消息，不会出队
+ */
+func (m *DbQueue) Range(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	if start < 0 {
+		start = 0
+	}
+	//stop小于0时查看start之后的全部消息
+	limit := math.MaxInt32
+	if stop >= 0 {
+		if stop < start {
+			return []string{}, nil
+		}
+		limit = int(stop - start + 1)
+	}
+	rows := make([]*queueMessage, 0)
+	err := m.getEngine().Where("topic = ?", key).OrderBy("id").Limit(limit, int(start)).Find(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]string, len(rows))
+	for k, row := range rows {
+		messages[k] = row.Message
+	}
+	return messages, nil
+}
+
+/**
+ * 移除队列中的一条消息
+ */
+func (m *DbQueue) Remove(ctx context.Context, key string, message string) (bool, error) {
+	engine := m.getEngine()
+	row := new(queueMessage)
+	has, err := engine.Where("topic = ? AND message = ?", key, message).OrderBy("id").Get(row)
+	if err != nil || !has {
+		return false, err
+	}
+	n, err := engine.ID(row.Id).Delete(new(queueMessage))
+	return n > 0, err
+}
+
+/**
+ * 清空队列，包括未到期的延迟消息和处理中的消息
+ */
+func (m *DbQueue) Purge(ctx context.Context, key string) (bool, error) {
+	_, err := m.getEngine().Where("topic = ?", key).Delete(new(queueMessage))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//可见性超时的毫秒时间戳
+func (m *DbQueue) deadline(now int64) int64 {
+	return now + int64(m.visibilityTimeout/time.Millisecond)
+}
+
+func formatToken(id int64, uuid string) string {
+	return strconv.FormatInt(id, 10) + "|" + uuid
+}
+
+//从token中解析消息id和uuid，token格式为 <id>|<uuid>
+func parseToken(token string) (int64, string, bool) {
+	i := strings.Index(token, "|")
+	if i <= 0 || i == len(token)-1 {
+		return 0, "", false
+	}
+	id, err := strconv.ParseInt(token[:i], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return id, token[i+1:], true
+}
+
+func init() {
+	mp = make(map[string]queue.Queue)
+	queue.Register(queue.DriverTypeDb, GetDbQueue)
+}
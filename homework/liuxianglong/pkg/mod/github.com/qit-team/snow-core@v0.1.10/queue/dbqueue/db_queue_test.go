@@ -0,0 +1,382 @@
+package dbqueue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"github.com/qit-team/snow-core/config"
+	"github.com/qit-team/snow-core/db"
+	"github.com/qit-team/snow-core/queue"
+	"github.com/qit-team/snow-core/utils"
+	"github.com/qit-team/work"
+	//go test时需要开启
+	_ "github.com/go-sql-driver/mysql"
+)
+
+var (
+	_ work.BrowsableQueue  = &DbQueue{}
+	_ work.VisibilityQueue = &DbQueue{}
+)
+
+func init() {
+	m := config.DbBaseConfig{
+		Host:     "127.0.0.1",
+		Port:     3306,
+		User:     "root",
+		Password: "123456",
+		DBName:   "test",
+	}
+	dbConf := config.DbConfig{
+		Driver: "mysql",
+		Master: m,
+	}
+
+	err := db.Pr.Register("db", dbConf, true)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+//创建队列消息表并清空topic，数据库不可用时跳过
+func prepare(t *testing.T, m *DbQueue, topic string) {
+	if err := m.Sync(); err != nil {
+		t.Skip("database is not available", err)
+	}
+	m.Purge(context.TODO(), topic)
+}
+
+func TestEnqueue(t *testing.T) {
+	q := queue.GetQueue("db", queue.DriverTypeDb).(*DbQueue)
+	ctx := context.TODO()
+	topic := "snow-db-one"
+	prepare(t, q, topic)
+
+	ok, err := q.BatchEnqueue(ctx, topic, []string{"1", "2"})
+	if err != nil || !ok {
+		t.Error("enqueue error", err)
+		return
+	}
+	if n, _ := q.Len(ctx, topic); n != 2 {
+		t.Error("len error", n)
+		return
+	}
+
+	for _, msg := range []string{"1", "2"} {
+		message, token, err := q.Dequeue(ctx, topic)
+		if err != nil || message != msg {
+			t.Error("dequeue error", message, err)
+			return
+		}
+		ok, err = q.AckMsg(ctx, topic, token)
+		if err != nil || !ok {
+			t.Error("ack error", err)
+			return
+		}
+		ok, _ = q.AckMsg(ctx, topic, token)
+		if ok {
+			t.Error("message must not be acked twice")
+			return
+		}
+	}
+
+	message, token, err := q.Dequeue(ctx, topic)
+	if err != nil || message != "" || token != "" {
+		t.Error("queue must be empty", message, err)
+	}
+}
+
+func TestEnqueue_delay(t *testing.T) {
+	q := queue.GetQueue("db", queue.DriverTypeDb).(*DbQueue)
+	ctx := context.TODO()
+	topic := "snow-db-delay"
+	prepare(t, q, topic)
+
+	q.Enqueue(ctx, topic, "delay", int64(1))
+	message, _, _ := q.Dequeue(ctx, topic)
+	if message != "" {
+		t.Error("delayed message must not be dequeued before due", message)
+		return
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	message, token, err := q.Dequeue(ctx, topic)
+	if err != nil || message != "delay" {
+		t.Error("delayed message must be dequeued after due", message, err)
+		return
+	}
+	q.AckMsg(ctx, topic, token)
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	q := newDbQueue("db").(*DbQueue)
+	q.SetVisibilityTimeout(100 * time.Millisecond)
+	ctx := context.TODO()
+	topic := "snow-db-visibility"
+	prepare(t, q, topic)
+
+	q.Enqueue(ctx, topic, "1")
+	_, first, _ := q.Dequeue(ctx, topic)
+	message, _, _ := q.Dequeue(ctx, topic)
+	if message != "" {
+		t.Error("message must not be redelivered before visibility timeout", message)
+		return
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	message, token, err := q.Dequeue(ctx, topic)
+	if err != nil || message != "1" {
+		t.Error("message must be redelivered after visibility timeout", message, err)
+		return
+	}
+	if ok, _ := q.AckMsg(ctx, topic, first); ok {
+		t.Error("token of the previous delivery must be invalid")
+		return
+	}
+	if ok, _ := q.AckMsg(ctx, topic, token); !ok {
+		t.Error("ack error")
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	q := queue.GetQueue("db", queue.DriverTypeDb).(*DbQueue)
+	ctx := context.TODO()
+	topic := "snow-db-browse"
+	prepare(t, q, topic)
+
+	q.BatchEnqueue(ctx, topic, []string{"1", "2", "3"})
+	messages, err := q.Range(ctx, topic, 1, 2)
+	if err != nil || len(messages) != 2 || messages[0] != "2" || messages[1] != "3" {
+		t.Error("range error", messages, err)
+		return
+	}
+
+	ok, err := q.Remove(ctx, topic, "2")
+	if err != nil || !ok {
+		t.Error("remove error", err)
+		return
+	}
+	if messages, _ = q.Range(ctx, topic, 0, -1); len(messages) != 2 {
+		t.Error("message must be removed", messages)
+		return
+	}
+
+	q.Purge(ctx, topic)
+	if n, _ := q.Len(ctx, topic); n != 0 {
+		t.Error("queue must be purged", n)
+	}
+}
+
+//进程内的casStore，用于测试乐观锁出队
+type fakeStore struct {
+	lock sync.Mutex
+	rows []*queueMessage
+	//在compareAndSwap之前执行，用于模拟其他消费者抢先更新
+	beforeSwap func(s *fakeStore, row *queueMessage)
+}
+
+func newFakeStore(key string, messages ...string) *fakeStore {
+	s := new(fakeStore)
+	for k, message := range messages {
+		s.rows = append(s.rows, &queueMessage{Id: int64(k + 1), Topic: key, Message: message})
+	}
+	return s
+}
+
+func (s *fakeStore) firstAvailable(key string, now int64) (*queueMessage, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, r := range s.rows {
+		if r.Topic == key && r.AvailableAt <= now {
+			row := *r
+			return &row, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (s *fakeStore) compareAndSwap(row *queueMessage, token string, availableAt int64) (int64, error) {
+	if s.beforeSwap != nil {
+		s.beforeSwap(s, row)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, r := range s.rows {
+		if r.Id == row.Id && r.Token == row.Token && r.AvailableAt == row.AvailableAt {
+			r.Token = token
+			r.AvailableAt = availableAt
+			r.Attempts++
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+//模拟可见性超时，消息可以重新出队
+func (s *fakeStore) expire(id int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, r := range s.rows {
+		if r.Id == id {
+			r.AvailableAt = 0
+		}
+	}
+}
+
+func TestDequeueCAS(t *testing.T) {
+	q := newDbQueue("db").(*DbQueue)
+	topic := "snow-db-cas"
+	store := newFakeStore(topic, "1", "2")
+
+	message, first, err := q.dequeueCAS(store, topic)
+	if err != nil || message != "1" {
+		t.Error("dequeue error", message, err)
+		return
+	}
+	message, _, err = q.dequeueCAS(store, topic)
+	if err != nil || message != "2" {
+		t.Error("dequeued message must not be dequeued again", message, err)
+		return
+	}
+	message, token, err := q.dequeueCAS(store, topic)
+	if err != nil || message != "" || token != "" {
+		t.Error("queue must be empty", message, err)
+		return
+	}
+
+	//超过可见性超时时间后重新投递，生成新的token
+	store.expire(1)
+	message, token, err = q.dequeueCAS(store, topic)
+	if err != nil || message != "1" || token == first {
+		t.Error("message must be redelivered with a new token", message, token, err)
+		return
+	}
+	if id, _, ok := parseToken(token); !ok || id != 1 {
+		t.Error("token error", token)
+		return
+	}
+	if store.rows[0].Attempts != 2 {
+		t.Error("attempts error", store.rows[0].Attempts)
+	}
+}
+
+func TestDequeueCAS_conflict(t *testing.T) {
+	q := newDbQueue("db").(*DbQueue)
+	topic := "snow-db-cas-conflict"
+	store := newFakeStore(topic, "1", "2")
+
+	//第一条消息被其他消费者抢先出队时，重新查询并出队下一条
+	store.beforeSwap = func(s *fakeStore, row *queueMessage) {
+		if row.Id == 1 && row.Token == "" {
+			s.lock.Lock()
+			s.rows[0].Token = "other"
+			s.rows[0].AvailableAt = q.deadline(utils.GetCurrentMilliTime())
+			s.lock.Unlock()
+		}
+	}
+	message, _, err := q.dequeueCAS(store, topic)
+	if err != nil || message != "2" {
+		t.Error("dequeue must skip the message taken by others", message, err)
+		return
+	}
+
+	//一直被抢占时超过重试次数后返回空消息
+	var calls int
+	store = newFakeStore(topic, "1")
+	store.beforeSwap = func(s *fakeStore, row *queueMessage) {
+		calls++
+		s.lock.Lock()
+		s.rows[0].Token = utils.GenUUID()
+		s.lock.Unlock()
+	}
+	message, token, err := q.dequeueCAS(store, topic)
+	if err != nil || message != "" || token != "" || calls != casRetries {
+		t.Error("dequeue must give up after retries", message, calls, err)
+	}
+}
+
+func TestDequeueCAS_contention(t *testing.T) {
+	q := newDbQueue("db").(*DbQueue)
+	topic := "snow-db-cas-contention"
+
+	//多个消费者同时抢占同一条消息，只有一个可以出队
+	for i := 0; i < 100; i++ {
+		store := newFakeStore(topic, "1")
+		var (
+			wg    sync.WaitGroup
+			start = make(chan struct{})
+			got   = make([]string, 4)
+		)
+		for k := range got {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				<-start
+				got[k], _, _ = q.dequeueCAS(store, topic)
+			}(k)
+		}
+		close(start)
+		wg.Wait()
+
+		n := 0
+		for _, message := range got {
+			if message == "1" {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Error("message must be dequeued by exactly one consumer", got)
+			return
+		}
+	}
+}
+
+func TestDequeueCAS_db(t *testing.T) {
+	q := newDbQueue("db").(*DbQueue)
+	q.SetSkipLocked(false)
+	q.SetVisibilityTimeout(100 * time.Millisecond)
+	ctx := context.TODO()
+	topic := "snow-db-cas"
+	prepare(t, q, topic)
+
+	q.BatchEnqueue(ctx, topic, []string{"1", "2"})
+	message, first, err := q.Dequeue(ctx, topic)
+	if err != nil || message != "1" {
+		t.Error("dequeue error", message, err)
+		return
+	}
+	message, token, err := q.Dequeue(ctx, topic)
+	if err != nil || message != "2" {
+		t.Error("dequeued message must not be dequeued again", message, err)
+		return
+	}
+	q.AckMsg(ctx, topic, token)
+
+	//超过可见性超时时间后重新投递，之前的token失效
+	time.Sleep(150 * time.Millisecond)
+	message, token, err = q.Dequeue(ctx, topic)
+	if err != nil || message != "1" {
+		t.Error("message must be redelivered after visibility timeout", message, err)
+		return
+	}
+	if ok, _ := q.AckMsg(ctx, topic, first); ok {
+		t.Error("token of the previous delivery must be invalid")
+		return
+	}
+	if ok, _ := q.AckMsg(ctx, topic, token); !ok {
+		t.Error("ack error")
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	id, uuid, ok := parseToken(formatToken(12, "abc"))
+	if !ok || id != 12 || uuid != "abc" {
+		t.Error("parse token error", id, uuid)
+	}
+	for _, token := range []string{"", "12", "12|", "|abc", "x|abc"} {
+		if _, _, ok := parseToken(token); ok {
+			t.Error("invalid token must not be parsed", token)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package memoryqueue
+
+import (
+	"context"
+	"errors"
+	"github.com/qit-team/snow-core/queue"
+	"github.com/qit-team/snow-core/utils"
+	"github.com/qit-team/work"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//高优先级和低优先级队列的key后缀，默认优先级使用原key，与redis驱动一致
+	highSuffix = ":high"
+	lowSuffix  = ":low"
+	//消息出队后默认的可见性超时时间，超时未ack的消息会被重新投递
+	DefaultVisibilityTimeout = 30 * time.Second
+	//topic默认保留的已发布消息数，新订阅组从保留的最早的消息开始消费
+	DefaultMaxLen = 10000
+)
+
+var (
+	mp map[string]queue.Queue
+	mu sync.RWMutex
+)
+
+//队列中的一条消息
+type memoryMessage struct {
+	message string
+	//可以出队的毫秒时间戳，延迟消息为到期时间，处理中的消息为可见性超时时间
+	availableAt int64
+	//处理中消息的token，未出队时为空
+	token string
+}
+
+//发布订阅的topic
+type memoryTopic struct {
+	//已有的订阅组
+	groups map[string]struct{}
+	//保留的已发布消息
+	messages []*memoryMessage
+}
+
+/**
+ * 基于进程内存的队列，用于单元测试和本地开发，消息只在当前进程内投递，进程退出后丢失
+ * 支持延迟消息、可见性超时和ack、优先级，key为 <topic>#<group> 时作为topic的订阅组，订阅组在首次出队时创建
+ */
+type MemoryQueue struct {
+	lock sync.Mutex
+	//可见性超时时间
+	visibilityTimeout time.Duration
+	//topic保留的已发布消息数
+	maxLen int
+	//各队列key的消息，按入队顺序排列
+	queues map[string][]*memoryMessage
+	//发布订阅的topic
+	topics map[string]*memoryTopic
+}
+
+//new实例
+func newMemoryQueue(diName string) queue.Queue {
+	m := new(MemoryQueue)
+	m.visibilityTimeout = DefaultVisibilityTimeout
+	m.maxLen = DefaultMaxLen
+	m.queues = make(map[string][]*memoryMessage)
+	m.topics = make(map[string]*memoryTopic)
+	return m
+}
+
+//单例模式，相同diName的队列共享消息
+func GetMemoryQueue(diName string) queue.Queue {
+	key := diName
+	mu.RLock()
+	q, ok := mp[key]
+	mu.RUnlock()
+	if ok {
+		return q
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if q, ok = mp[key]; ok {
+		return q
+	}
+	q = newMemoryQueue(diName)
+	mp[key] = q
+	return q
+}
+
+//设置可见性超时时间，需要大于任务的最长处理时间，否则未处理完成的消息会被重复投递
+func (m *MemoryQueue) SetVisibilityTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		m.visibilityTimeout = timeout
+	}
+}
+
+//可见性超时时间，Job启动时检查worker的任务超时时间是否小于此时间
+func (m *MemoryQueue) VisibilityTimeout() time.Duration {
+	return m.visibilityTimeout
+}
+
+//设置topic保留的已发布消息数，小于等于0时不保留，之后创建的订阅组只收到创建后发布的消息
+func (m *MemoryQueue) SetMaxLen(maxLen int) {
+	m.maxLen = maxLen
+}
+
+/**
+ * 队列消息入队
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *MemoryQueue) Enqueue(ctx context.Context, key string, message string, args ...interface{}) (bool, error) {
+	return m.BatchEnqueuePriority(ctx, key, []string{message}, work.PriorityNormal, args...)
+}
+
+/**
+ * 队列消息按优先级入队
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *MemoryQueue) EnqueuePriority(ctx context.Context, key string, message string, priority int, args ...interface{}) (bool, error) {
+	return m.BatchEnqueuePriority(ctx, key, []string{message}, priority, args...)
+}
+
+/**
+ * 队列消息批量入队
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *MemoryQueue) BatchEnqueue(ctx context.Context, key string, messages []string, args ...interface{}) (bool, error) {
+	return m.BatchEnqueuePriority(ctx, key, messages, work.PriorityNormal, args...)
+}
+
+/**
+ * 队列消息按优先级批量入队
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *MemoryQueue) BatchEnqueuePriority(ctx context.Context, key string, messages []string, priority int, args ...interface{}) (bool, error) {
+	if len(messages) == 0 {
+		return false, errors.New("messages is empty")
+	}
+
+	availableAt := utils.GetCurrentMilliTime() + queue.GetDelay(args...)*1000
+	key = priorityKey(key, priority)
+	m.lock.Lock()
+	for _, message := range messages {
+		m.queues[key] = append(m.queues[key], &memoryMessage{message: message, availableAt: availableAt})
+	}
+	m.lock.Unlock()
+	return true, nil
+}
+
+/**
+ * 发布消息，topic的每个订阅组都会收到
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *MemoryQueue) Publish(ctx context.Context, topic string, message string, args ...interface{}) (bool, error) {
+	return m.BatchPublish(ctx, topic, []string{message}, args...)
+}
+
+/**
+ * 批量发布消息
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *MemoryQueue) BatchPublish(ctx context.Context, topic string, messages []string, args ...interface{}) (bool, error) {
+	if len(messages) == 0 {
+		return false, errors.New("messages is empty")
+	}
+
+	availableAt := utils.GetCurrentMilliTime() + queue.GetDelay(args...)*1000
+	m.lock.Lock()
+	t := m.getTopic(topic)
+	for _, message := range messages {
+		msg := &memoryMessage{message: message, availableAt: availableAt}
+		for group := range t.groups {
+			key := topic + work.SubscriptionSeparator + group
+			m.queues[key] = append(m.queues[key], msg.copy())
+		}
+		if m.maxLen > 0 {
+			t.messages = append(t.messages, msg)
+		}
+	}
+	if m.maxLen > 0 && len(t.messages) > m.maxLen {
+		t.messages = append([]*memoryMessage(nil), t.messages[len(t.messages)-m.maxLen:]...)
+	}
+	m.lock.Unlock()
+	return true, nil
+}
+
+/**
+ * 队列消息出队，消息不存在时返回空字符串
+ * 超过可见性超时时间未ack的消息会被重新投递，之前的token失效
+ */
+func (m *MemoryQueue) Dequeue(ctx context.Context, key string) (message string, token string, err error) {
+	return m.DequeuePriority(ctx, key, []int{work.PriorityNormal})
+}
+
+/**
+ * 按priorities的顺序依次尝试出队
+ */
+func (m *MemoryQueue) DequeuePriority(ctx context.Context, key string, priorities []int) (message string, token string, err error) {
+	now := utils.GetCurrentMilliTime()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if topic, group, ok := parseSubscriptionKey(key); ok {
+		m.ensureGroup(topic, group)
+	}
+	for _, p := range priorities {
+		for _, msg := range m.queues[priorityKey(key, p)] {
+			if msg.availableAt > now {
+				continue
+			}
+			msg.token = utils.GenUUID()
+			msg.availableAt = now + int64(m.visibilityTimeout/time.Millisecond)
+			return msg.message, msg.token, nil
+		}
+	}
+	return "", "", nil
+}
+
+/**
+ * 确认消息接收，删除消息
+ * 消息已经因超时被重新投递时返回false
+ */
+func (m *MemoryQueue) AckMsg(ctx context.Context, key string, token string) (bool, error) {
+	if token == "" {
+		return false, errors.New("invalid token")
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, k := range priorityKeys(key) {
+		for i, msg := range m.queues[k] {
+			if msg.token == token {
+				m.removeAt(k, i)
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+/**
+ * 队列消息数，包括各优先级的队列和未到期的延迟消息，不包括处理中的消息
+ */
+func (m *MemoryQueue) Len(ctx context.Context, key string) (int64, error) {
+	now := utils.GetCurrentMilliTime()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var total int64
+	for _, k := range priorityKeys(key) {
+		for _, msg := range m.queues[k] {
+			if !msg.inflight(now) {
+				total++
+			}
+		}
+	}
+	return total, nil
+}
+
+/**
+ * 按位置查看未处理的消息，不会出队，各优先级的队列按高、默认、低优先级的顺序连续编号，与Len一致
+ */
+func (m *MemoryQueue) Range(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	now := utils.GetCurrentMilliTime()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	messages := make([]string, 0)
+	var i int64
+	for _, k := range priorityKeys(key) {
+		for _, msg := range m.queues[k] {
+			if msg.inflight(now) {
+				continue
+			}
+			if i >= start && (stop < 0 || i <= stop) {
+				messages = append(messages, msg.message)
+			}
+			i++
+		}
+	}
+	return messages, nil
+}
+
+/**
+ * 移除未处理的一条消息，按高、默认、低优先级的顺序查找
+ */
+func (m *MemoryQueue) Remove(ctx context.Context, key string, message string) (bool, error) {
+	now := utils.GetCurrentMilliTime()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, k := range priorityKeys(key) {
+		for i, msg := range m.queues[k] {
+			if msg.message == message && !msg.inflight(now) {
+				m.removeAt(k, i)
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+/**
+ * 清空队列，包括各优先级的队列、未到期的延迟消息和处理中的消息
+ * key为topic时同时清空topic保留的已发布消息
+ */
+func (m *MemoryQueue) Purge(ctx context.Context, key string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, k := range priorityKeys(key) {
+		delete(m.queues, k)
+	}
+	if t, ok := m.topics[key]; ok {
+		t.messages = nil
+	}
+	return true, nil
+}
+
+//获取topic，不存在时创建，调用方需要持有锁
+func (m *MemoryQueue) getTopic(topic string) *memoryTopic {
+	t, ok := m.topics[topic]
+	if !ok {
+		t = &memoryTopic{groups: make(map[string]struct{})}
+		m.topics[topic] = t
+	}
+	return t
+}
+
+//订阅组不存在时创建，topic保留的已发布消息排在订阅组已有的消息之前，调用方需要持有锁
+func (m *MemoryQueue) ensureGroup(topic string, group string) {
+	t := m.getTopic(topic)
+	if _, ok := t.groups[group]; ok {
+		return
+	}
+	t.groups[group] = struct{}{}
+
+	key := topic + work.SubscriptionSeparator + group
+	messages := make([]*memoryMessage, 0, len(t.messages)+len(m.queues[key]))
+	for _, msg := range t.messages {
+		messages = append(messages, msg.copy())
+	}
+	m.queues[key] = append(messages, m.queues[key]...)
+}
+
+//移除队列中的第i条消息，调用方需要持有锁
+func (m *MemoryQueue) removeAt(key string, i int) {
+	messages := m.queues[key]
+	messages = append(messages[:i], messages[i+1:]...)
+	if len(messages) == 0 {
+		delete(m.queues, key)
+		return
+	}
+	m.queues[key] = messages
+}
+
+//发布的消息投递给各订阅组时复制，各订阅组的处理状态互不影响
+func (msg *memoryMessage) copy() *memoryMessage {
+	return &memoryMessage{message: msg.message, availableAt: msg.availableAt}
+}
+
+//是否处理中且未超过可见性超时时间
+func (msg *memoryMessage) inflight(now int64) bool {
+	return msg.token != "" && msg.availableAt > now
+}
+
+//优先级对应的队列key
+func priorityKey(key string, priority int) string {
+	if priority > work.PriorityNormal {
+		return key + highSuffix
+	} else if priority < work.PriorityNormal {
+		return key + lowSuffix
+	}
+	return key
+}
+
+//key的各优先级队列
+func priorityKeys(key string) []string {
+	return []string{key + highSuffix, key, key + lowSuffix}
+}
+
+//解析订阅组的key，格式为 <topic>#<group>
+func parseSubscriptionKey(key string) (topic string, group string, ok bool) {
+	i := strings.Index(key, work.SubscriptionSeparator)
+	if i <= 0 || i == len(key)-1 {
+		return key, "", false
+	}
+	return key[:i], key[i+1:], true
+}
+
+func init() {
+	mp = make(map[string]queue.Queue)
+	queue.Register(queue.DriverTypeMemory, GetMemoryQueue)
+}
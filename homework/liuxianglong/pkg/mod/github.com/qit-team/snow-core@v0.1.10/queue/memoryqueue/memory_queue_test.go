@@ -0,0 +1,211 @@
+package memoryqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+	"github.com/qit-team/snow-core/queue"
+	"github.com/qit-team/work"
+)
+
+var (
+	_ work.BrowsableQueue  = &MemoryQueue{}
+	_ work.PriorityQueue   = &MemoryQueue{}
+	_ work.PubSubQueue     = &MemoryQueue{}
+	_ work.VisibilityQueue = &MemoryQueue{}
+)
+
+func TestEnqueue(t *testing.T) {
+	q := queue.GetQueue("memory", queue.DriverTypeMemory)
+	ctx := context.TODO()
+	topic := "memory-topic-one"
+
+	ok, err := q.BatchEnqueue(ctx, topic, []string{"1", "2"})
+	if err != nil || !ok {
+		t.Error("enqueue error", err)
+		return
+	}
+
+	for _, msg := range []string{"1", "2"} {
+		message, token, err := q.Dequeue(ctx, topic)
+		if err != nil || message != msg {
+			t.Error("dequeue error", message, err)
+			return
+		}
+		ok, err = q.AckMsg(ctx, topic, token)
+		if err != nil || !ok {
+			t.Error("ack error", err)
+			return
+		}
+		ok, _ = q.AckMsg(ctx, topic, token)
+		if ok {
+			t.Error("message must not be acked twice")
+			return
+		}
+	}
+
+	message, token, err := q.Dequeue(ctx, topic)
+	if err != nil || message != "" || token != "" {
+		t.Error("queue must be empty", message, err)
+	}
+}
+
+func TestEnqueue_delay(t *testing.T) {
+	q := queue.GetQueue("memory", queue.DriverTypeMemory)
+	ctx := context.TODO()
+	topic := "memory-topic-delay"
+
+	q.Enqueue(ctx, topic, "delay", int64(1))
+	message, _, _ := q.Dequeue(ctx, topic)
+	if message != "" {
+		t.Error("delayed message must not be dequeued before due", message)
+		return
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	message, token, err := q.Dequeue(ctx, topic)
+	if err != nil || message != "delay" {
+		t.Error("delayed message must be dequeued after due", message, err)
+		return
+	}
+	q.AckMsg(ctx, topic, token)
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	q := newMemoryQueue("memory").(*MemoryQueue)
+	q.SetVisibilityTimeout(100 * time.Millisecond)
+	ctx := context.TODO()
+	topic := "memory-topic-visibility"
+
+	q.Enqueue(ctx, topic, "1")
+	_, first, _ := q.Dequeue(ctx, topic)
+	message, _, _ := q.Dequeue(ctx, topic)
+	if message != "" {
+		t.Error("message must not be redelivered before visibility timeout", message)
+		return
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	message, token, err := q.Dequeue(ctx, topic)
+	if err != nil || message != "1" {
+		t.Error("message must be redelivered after visibility timeout", message, err)
+		return
+	}
+	if ok, _ := q.AckMsg(ctx, topic, first); ok {
+		t.Error("token of the previous delivery must be invalid")
+		return
+	}
+	if ok, _ := q.AckMsg(ctx, topic, token); !ok {
+		t.Error("ack error")
+	}
+}
+
+func TestDequeuePriority(t *testing.T) {
+	q := queue.GetQueue("memory", queue.DriverTypeMemory).(*MemoryQueue)
+	ctx := context.TODO()
+	topic := "memory-topic-priority"
+
+	q.EnqueuePriority(ctx, topic, "low", work.PriorityLow)
+	q.Enqueue(ctx, topic, "normal")
+	q.EnqueuePriority(ctx, topic, "high", work.PriorityHigh)
+	if n, _ := q.Len(ctx, topic); n != 3 {
+		t.Error("len must count all priorities", n)
+		return
+	}
+	//各优先级的消息按出队顺序连续编号
+	if messages, _ := q.Range(ctx, topic, 1, -1); len(messages) != 2 || messages[0] != "normal" || messages[1] != "low" {
+		t.Error("range must contain all priorities", messages)
+		return
+	}
+
+	priorities := []int{work.PriorityHigh, work.PriorityNormal, work.PriorityLow}
+	for _, msg := range []string{"high", "normal", "low"} {
+		message, token, err := q.DequeuePriority(ctx, topic, priorities)
+		if err != nil || message != msg {
+			t.Error("dequeue priority error", message, err)
+			return
+		}
+		if ok, _ := q.AckMsg(ctx, topic, token); !ok {
+			t.Error("ack error", msg)
+			return
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	q := newMemoryQueue("memory").(*MemoryQueue)
+	ctx := context.TODO()
+	topic := "memory-topic-event"
+	notify := topic + work.SubscriptionSeparator + "notify"
+	stats := topic + work.SubscriptionSeparator + "stats"
+
+	//订阅组创建前发布的消息也会投递
+	q.Publish(ctx, topic, "login")
+	q.Dequeue(ctx, stats)
+	q.Publish(ctx, topic, "logout")
+
+	for _, key := range []string{notify, stats} {
+		message, token, _ := q.Dequeue(ctx, key)
+		if key == notify && message != "login" {
+			t.Error("subscriber must receive retained messages", key, message)
+			return
+		}
+		if key == stats && message != "logout" {
+			t.Error("subscriber must receive the message", key, message)
+			return
+		}
+		q.AckMsg(ctx, key, token)
+	}
+
+	//写入订阅组key的消息只投递给该订阅组
+	q.Enqueue(ctx, notify, "retry")
+	message, _, _ := q.Dequeue(ctx, notify)
+	if message != "logout" {
+		t.Error("subscriber must receive the message", message)
+		return
+	}
+	message, _, _ = q.Dequeue(ctx, notify)
+	if message != "retry" {
+		t.Error("retry message must be delivered to its group", message)
+		return
+	}
+	message, _, _ = q.Dequeue(ctx, stats)
+	if message != "" {
+		t.Error("retry message must not be delivered to other groups", message)
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	q := queue.GetQueue("memory", queue.DriverTypeMemory).(*MemoryQueue)
+	ctx := context.TODO()
+	topic := "memory-topic-browse"
+
+	q.BatchEnqueue(ctx, topic, []string{"1", "2", "3"})
+	messages, err := q.Range(ctx, topic, 1, 2)
+	if err != nil || len(messages) != 2 || messages[0] != "2" || messages[1] != "3" {
+		t.Error("range error", messages, err)
+		return
+	}
+
+	//处理中的消息不计入
+	q.Dequeue(ctx, topic)
+	if n, _ := q.Len(ctx, topic); n != 2 {
+		t.Error("len must not count inflight messages", n)
+		return
+	}
+
+	ok, err := q.Remove(ctx, topic, "2")
+	if err != nil || !ok {
+		t.Error("remove error", err)
+		return
+	}
+	if messages, _ = q.Range(ctx, topic, 0, -1); len(messages) != 1 || messages[0] != "3" {
+		t.Error("message must be removed", messages)
+		return
+	}
+
+	q.Purge(ctx, topic)
+	if n, _ := q.Len(ctx, topic); n != 0 {
+		t.Error("queue must be purged", n)
+	}
+}
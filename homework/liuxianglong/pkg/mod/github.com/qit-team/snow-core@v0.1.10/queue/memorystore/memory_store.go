@@ -0,0 +1,162 @@
+package memorystore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//清理过期key的最小间隔
+const gcInterval = time.Minute
+
+var (
+	mp map[string]*MemoryStore
+	mu sync.RWMutex
+)
+
+//幂等key或任务组，expireAt为过期时间
+type memoryEntry struct {
+	members  map[string]struct{}
+	expireAt time.Time
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !now.Before(e.expireAt)
+}
+
+//基于进程内存的幂等存储和任务组存储，实现work.IdempotentStore和work.GroupStore接口，配合memory队列驱动使用
+type MemoryStore struct {
+	lock    sync.Mutex
+	entries map[string]*memoryEntry
+	//最近一次清理过期key的时间
+	gcAt time.Time
+}
+
+//new实例
+func newMemoryStore(diName string) *MemoryStore {
+	m := new(MemoryStore)
+	m.entries = make(map[string]*memoryEntry)
+	m.gcAt = time.Now()
+	return m
+}
+
+//单例模式，相同diName的存储共享数据
+func GetMemoryStore(diName string) *MemoryStore {
+	key := diName
+	mu.RLock()
+	s, ok := mp[key]
+	mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if s, ok = mp[key]; ok {
+		return s
+	}
+	s = newMemoryStore(diName)
+	mp[key] = s
+	return s
+}
+
+/**
+ * key不存在时写入，ttl后过期
+ */
+func (m *MemoryStore) SetNX(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.gc(now)
+	if _, ok := m.get(key, now); ok {
+		return false, nil
+	}
+	m.entries[key] = &memoryEntry{expireAt: now.Add(ttl)}
+	return true, nil
+}
+
+/**
+ * key是否存在
+ */
+func (m *MemoryStore) Exists(ctx context.Context, key string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.get(key, time.Now())
+	return ok, nil
+}
+
+/**
+ * 删除key
+ */
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.lock.Lock()
+	delete(m.entries, key)
+	m.lock.Unlock()
+	return nil
+}
+
+/**
+ * 记录任务组成员已完成，本次写入使全部成员完成时返回true，每次写入都会重新计算过期时间
+ */
+func (m *MemoryStore) AddGroupMember(ctx context.Context, key string, member string, size int, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.gc(now)
+	e, ok := m.get(key, now)
+	if !ok {
+		e = &memoryEntry{}
+		m.entries[key] = e
+	}
+	if e.members == nil {
+		e.members = make(map[string]struct{})
+	}
+	e.expireAt = now.Add(ttl)
+	if _, ok := e.members[member]; ok {
+		return false, nil
+	}
+	e.members[member] = struct{}{}
+	return len(e.members) == size, nil
+}
+
+/**
+ * 移除任务组已完成的成员
+ */
+func (m *MemoryStore) RemoveGroupMember(ctx context.Context, key string, member string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if e, ok := m.get(key, time.Now()); ok {
+		delete(e.members, member)
+	}
+	return nil
+}
+
+//获取未过期的key，已过期时删除，调用方需要持有锁
+func (m *MemoryStore) get(key string, now time.Time) (*memoryEntry, bool) {
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if e.expired(now) {
+		delete(m.entries, key)
+		return nil, false
+	}
+	return e, true
+}
+
+//距离上次清理超过间隔时间时删除全部过期的key，调用方需要持有锁
+func (m *MemoryStore) gc(now time.Time) {
+	if now.Sub(m.gcAt) < gcInterval {
+		return
+	}
+	m.gcAt = now
+	for key, e := range m.entries {
+		if e.expired(now) {
+			delete(m.entries, key)
+		}
+	}
+}
+
+func init() {
+	mp = make(map[string]*MemoryStore)
+}
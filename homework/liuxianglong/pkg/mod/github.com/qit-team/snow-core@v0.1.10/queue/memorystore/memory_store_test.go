@@ -0,0 +1,116 @@
+package memorystore
+
+import (
+	"context"
+	"testing"
+	"time"
+	"github.com/qit-team/work"
+)
+
+var (
+	_ work.IdempotentStore = &MemoryStore{}
+	_ work.GroupStore      = &MemoryStore{}
+)
+
+func TestSetNX(t *testing.T) {
+	ctx := context.TODO()
+	s := GetMemoryStore("memory")
+	key := "memory-store-setnx"
+	s.Delete(ctx, key)
+
+	ok, err := s.SetNX(ctx, key, time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if !ok {
+		t.Error("first setnx must be ok")
+		return
+	}
+
+	ok, err = s.SetNX(ctx, key, time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if ok {
+		t.Error("second setnx must not be ok")
+		return
+	}
+
+	ok, err = s.Exists(ctx, key)
+	if err != nil || !ok {
+		t.Error("key must exist", err)
+		return
+	}
+
+	err = s.Delete(ctx, key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ok, _ = s.Exists(ctx, key)
+	if ok {
+		t.Error("key must not exist after delete")
+		return
+	}
+}
+
+func TestGroupMember(t *testing.T) {
+	ctx := context.TODO()
+	s := GetMemoryStore("memory")
+	key := "memory-store-group"
+	s.Delete(ctx, key)
+
+	done, err := s.AddGroupMember(ctx, key, "a", 2, time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if done {
+		t.Error("group must not be done with one member")
+		return
+	}
+
+	done, err = s.AddGroupMember(ctx, key, "b", 2, time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if !done {
+		t.Error("group must be done with all members")
+		return
+	}
+
+	//重复投递的成员不会再次触发
+	done, _ = s.AddGroupMember(ctx, key, "b", 2, time.Minute)
+	if done {
+		t.Error("duplicate member must not complete the group again")
+		return
+	}
+
+	err = s.RemoveGroupMember(ctx, key, "b")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	done, _ = s.AddGroupMember(ctx, key, "b", 2, time.Minute)
+	if !done {
+		t.Error("group must be done after member re-added")
+	}
+	s.Delete(ctx, key)
+}
+
+func TestSetNX_expire(t *testing.T) {
+	ctx := context.TODO()
+	s := GetMemoryStore("memory")
+	key := "memory-store-expire"
+
+	s.SetNX(ctx, key, 50*time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	ok, _ := s.Exists(ctx, key)
+	if ok {
+		t.Error("key must expire after ttl")
+		return
+	}
+	ok, _ = s.SetNX(ctx, key, time.Minute)
+	if !ok {
+		t.Error("setnx must be ok after key expired")
+	}
+}
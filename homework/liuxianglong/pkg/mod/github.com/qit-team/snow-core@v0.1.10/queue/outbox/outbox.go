@@ -0,0 +1,102 @@
+package outbox
+
+import (
+	"errors"
+	"github.com/go-xorm/xorm"
+	"github.com/qit-team/snow-core/db"
+	"github.com/qit-team/snow-core/queue"
+	"github.com/qit-team/snow-core/utils"
+	"github.com/qit-team/work"
+	"time"
+)
+
+//outbox任务的状态
+const (
+	StatusPending = 0
+	StatusSent    = 1
+)
+
+//投递方式
+const (
+	//work.Job.EnqueueWithTask
+	modeEnqueue = 0
+	//work.Job.PublishWithTask
+	modePublish = 1
+)
+
+/**
+ * outbox表的实体
+ * 任务与业务数据在同一事务中写入，事务提交后由Relay投递并标记为已投递
+ */
+type outboxMessage struct {
+	Id    int64  `xorm:"pk autoincr 'id'"`
+	Topic string `xorm:"varchar(191) notnull 'topic'"`
+	//json编码的work.Task
+	Task string `xorm:"mediumtext notnull 'task'"`
+	Mode int    `xorm:"tinyint notnull default 0 'mode'"`
+	//任务可以被消费的毫秒时间戳，投递时换算为剩余的延迟秒数
+	AvailableAt int64 `xorm:"bigint notnull default 0 'available_at'"`
+	Status      int   `xorm:"tinyint notnull default 0 index(idx_status_retry) 'status'"`
+	//投递失败后下次重试的毫秒时间戳
+	RetryAt   int64  `xorm:"bigint notnull default 0 index(idx_status_retry) 'retry_at'"`
+	Attempts  int    `xorm:"int notnull default 0 'attempts'"`
+	LastError string `xorm:"varchar(255) notnull default '' 'last_error'"`
+	CreatedAt int64  `xorm:"bigint notnull 'created_at'"`
+	SentAt    int64  `xorm:"bigint notnull default 0 'sent_at'"`
+}
+
+func (m *outboxMessage) TableName() string {
+	return "outbox_message"
+}
+
+//同步outbox表的结构，表不存在时创建，outbox表需要和业务表在同一个数据库
+func Sync(diName string) error {
+	return db.GetDb(diName).Master().Sync2(new(outboxMessage))
+}
+
+/**
+ * 在业务写入的session中写入待入队的任务，session开启了事务时随业务数据一起提交或回滚
+ * 事务提交后由Relay投递，投递至少一次；任务id在写入时生成，worker可以通过work.IdempotentTTL按任务id去重
+ * args[0] delay 延迟消息，单位秒
+ */
+func Enqueue(session *xorm.Session, topic string, task work.Task, args ...interface{}) error {
+	return insert(session, topic, task, modeEnqueue, args...)
+}
+
+/**
+ * 在业务写入的session中写入待发布的任务，Relay投递时发布到topic的每个订阅组
+ * args[0] delay 延迟消息，单位秒
+ */
+func Publish(session *xorm.Session, topic string, task work.Task, args ...interface{}) error {
+	return insert(session, topic, task, modePublish, args...)
+}
+
+func insert(session *xorm.Session, topic string, task work.Task, mode int, args ...interface{}) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+	if task.Id == "" {
+		task.Id = work.GenUUID()
+	}
+	if task.Topic == "" {
+		task.Topic = topic
+	}
+	if task.EnqueuedAt == 0 {
+		task.EnqueuedAt = time.Now().Unix()
+	}
+	s, err := work.JsonEncode(task)
+	if err != nil {
+		return err
+	}
+
+	now := utils.GetCurrentMilliTime()
+	_, err = session.Insert(&outboxMessage{
+		Topic:       topic,
+		Task:        s,
+		Mode:        mode,
+		AvailableAt: now + queue.GetDelay(args...)*1000,
+		CreatedAt:   now,
+	})
+	return err
+}
+
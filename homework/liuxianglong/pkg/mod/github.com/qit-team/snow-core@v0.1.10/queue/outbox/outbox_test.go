@@ -0,0 +1,177 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+	"github.com/qit-team/snow-core/config"
+	"github.com/qit-team/snow-core/db"
+	"github.com/go-xorm/xorm"
+	"github.com/qit-team/snow-core/queue/memoryqueue"
+	"github.com/qit-team/work"
+	//go test时需要开启
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func init() {
+	m := config.DbBaseConfig{
+		Host:     "127.0.0.1",
+		Port:     3306,
+		User:     "root",
+		Password: "123456",
+		DBName:   "test",
+	}
+	dbConf := config.DbConfig{
+		Driver: "mysql",
+		Master: m,
+	}
+
+	err := db.Pr.Register("db", dbConf, true)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+//创建outbox表并清空，数据库不可用时跳过
+func prepare(t *testing.T) {
+	if err := Sync("db"); err != nil {
+		t.Skip("database is not available", err)
+	}
+	db.GetDb("db").Master().Exec("DELETE FROM outbox_message")
+}
+
+func TestRelay(t *testing.T) {
+	prepare(t)
+	ctx := context.TODO()
+	topic := "snow-outbox-one"
+	q := memoryqueue.GetMemoryQueue("outbox")
+	job := work.New()
+	job.AddQueue(q)
+	job.AddFunc(topic, func(task work.Task) work.TaskResult {
+		return work.TaskResult{Id: task.Id}
+	})
+	engine := db.GetDb("db").Master()
+
+	//回滚的事务不会写入任务
+	session := engine.NewSession()
+	session.Begin()
+	Enqueue(session, topic, work.GenTask(topic, "rollback"))
+	session.Rollback()
+	session.Close()
+
+	_, err := engine.Transaction(func(session *xorm.Session) (interface{}, error) {
+		return nil, Enqueue(session, topic, work.GenTask(topic, "commit"))
+	})
+	if err != nil {
+		t.Error("enqueue error", err)
+		return
+	}
+
+	relay := NewRelay(job, "db")
+	if n, _ := relay.Pending(ctx); n != 1 {
+		t.Error("pending error", n)
+		return
+	}
+	if err = relay.Relay(ctx); err != nil {
+		t.Error("relay error", err)
+		return
+	}
+	if n, _ := relay.Pending(ctx); n != 0 {
+		t.Error("relayed task must be marked sent", n)
+		return
+	}
+
+	message, token, _ := q.Dequeue(ctx, topic)
+	task, _ := work.DecodeStringTask(message)
+	if task.Message != "commit" || task.Id == "" {
+		t.Error("relayed task error", message)
+		return
+	}
+	q.AckMsg(ctx, topic, token)
+	if message, _, _ = q.Dequeue(ctx, topic); message != "" {
+		t.Error("task must be relayed once", message)
+		return
+	}
+
+	if n, _ := relay.Clean(ctx, time.Now().Add(time.Second)); n != 1 {
+		t.Error("clean error", n)
+	}
+}
+
+func TestRelay_retry(t *testing.T) {
+	prepare(t)
+	ctx := context.TODO()
+	topic := "snow-outbox-retry"
+	//没有可用的queue，投递失败
+	job := work.New()
+	engine := db.GetDb("db").Master()
+	engine.Transaction(func(session *xorm.Session) (interface{}, error) {
+		return nil, Publish(session, topic, work.GenTask(topic, "retry"))
+	})
+
+	relay := NewRelay(job, "db")
+	sent, fetched, err := relay.RelayOnce(ctx)
+	if err != nil || sent != 0 || fetched != 1 {
+		t.Error("relay once error", sent, fetched, err)
+		return
+	}
+	//退避期间不会再次取出
+	if _, fetched, _ = relay.RelayOnce(ctx); fetched != 0 {
+		t.Error("failed task must wait for retry", fetched)
+		return
+	}
+
+	row := new(outboxMessage)
+	engine.Where("topic = ?", topic).Get(row)
+	if row.Status != StatusPending || row.Attempts != 1 || row.LastError == "" {
+		t.Error("failed task must be recorded", row)
+	}
+}
+
+func TestRelay_withoutSkipLocked(t *testing.T) {
+	prepare(t)
+	ctx := context.TODO()
+	topic := "snow-outbox-no-skip-locked"
+	job := work.New()
+	job.AddQueue(memoryqueue.GetMemoryQueue("outbox"))
+	engine := db.GetDb("db").Master()
+	engine.Transaction(func(session *xorm.Session) (interface{}, error) {
+		return nil, Enqueue(session, topic, work.GenTask(topic, "1"))
+	})
+
+	//MySQL 5.7等不支持SKIP LOCKED时不加锁查询
+	relay := NewRelay(job, "db")
+	relay.SetSkipLocked(false)
+	sent, fetched, err := relay.RelayOnce(ctx)
+	if err != nil || sent != 1 || fetched != 1 {
+		t.Error("relay once error", sent, fetched, err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		7:  time.Minute,
+		20: time.Minute,
+	}
+	for attempts, want := range cases {
+		if d := retryBackoff(attempts); d != want {
+			t.Error("backoff error", attempts, d)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if s := truncate("error", 255); s != "error" {
+		t.Error("short string must not be truncated", s)
+	}
+	s := truncate(strings.Repeat("投递失败", 100), 255)
+	if !utf8.ValidString(s) || utf8.RuneCountInString(s) != 255 {
+		t.Error("string must be truncated by rune", utf8.RuneCountInString(s))
+	}
+}
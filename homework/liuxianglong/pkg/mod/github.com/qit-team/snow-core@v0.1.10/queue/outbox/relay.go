@@ -0,0 +1,224 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"github.com/qit-team/snow-core/db"
+	"github.com/qit-team/snow-core/log/logger"
+	"github.com/qit-team/snow-core/utils"
+	"github.com/qit-team/work"
+	"time"
+)
+
+const (
+	//单批投递的默认任务数
+	DefaultBatchSize = 100
+	//Run轮询的默认间隔
+	DefaultInterval = time.Second
+	//投递失败后重试间隔的上限
+	maxRetryBackoff = time.Minute
+	//记录的错误信息最大长度
+	maxErrorLen = 255
+)
+
+/**
+ * 将outbox表中待投递的任务投递到work.Job并标记为已投递
+ * 数据库版本支持时(MySQL 8.0.1、MariaDB 10.6、PostgreSQL 9.5起)使用SELECT ... FOR UPDATE SKIP LOCKED，多个Relay可以同时运行；
+ * 其他数据库或者关闭SetSkipLocked时不加锁查询，同一时间只应运行一个Relay
+ * 投递后标记失败(如进程退出)时任务会被再次投递
+ */
+type Relay struct {
+	job    *work.Job
+	diName string
+	//单批投递的任务数
+	batchSize int
+	//Run轮询的间隔
+	interval time.Duration
+	//数据库支持时是否使用SKIP LOCKED查询
+	skipLocked bool
+}
+
+/**
+ * 生成Relay
+ * @param job 投递任务的Job，需要注册好各topic的Queue
+ * @param diName outbox表所在的db实例名
+ * @param args 可选参数按类型识别：int为单批投递的任务数，默认100；time.Duration为Run轮询的间隔，默认1秒
+ */
+func NewRelay(job *work.Job, diName string, args ...interface{}) *Relay {
+	r := &Relay{
+		job:        job,
+		diName:     diName,
+		batchSize:  DefaultBatchSize,
+		interval:   DefaultInterval,
+		skipLocked: true,
+	}
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case int:
+			if v > 0 {
+				r.batchSize = v
+			}
+		case time.Duration:
+			if v > 0 {
+				r.interval = v
+			}
+		}
+	}
+	return r
+}
+
+//是否在数据库支持时使用SKIP LOCKED查询，关闭后同一时间只应运行一个Relay
+func (r *Relay) SetSkipLocked(skipLocked bool) {
+	r.skipLocked = skipLocked
+}
+
+/**
+ * 投递一批待投递的任务，投递失败的任务记录错误并按次数退避后重试，不影响同批的其他任务
+ * @return 本批投递成功的任务数和取出的任务数
+ */
+func (r *Relay) RelayOnce(ctx context.Context) (sent int, fetched int, err error) {
+	engine := db.GetDb(r.diName).Master()
+	session := engine.NewSession()
+	defer session.Close()
+	if err = session.Begin(); err != nil {
+		return
+	}
+
+	now := utils.GetCurrentMilliTime()
+	sql := "SELECT * FROM outbox_message WHERE status = ? AND retry_at <= ? ORDER BY id LIMIT ?"
+	if r.skipLocked && db.SupportSkipLocked(engine) {
+		sql += " FOR UPDATE SKIP LOCKED"
+	}
+	rows := make([]*outboxMessage, 0)
+	if err = session.SQL(sql, StatusPending, now, r.batchSize).Find(&rows); err != nil {
+		session.Rollback()
+		return
+	}
+	fetched = len(rows)
+
+	ids := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		if e := r.send(ctx, row, now); e != nil {
+			logger.Warn(ctx, "outbox_relay_error", logger.NewWithField("outbox_id", row.Id), logger.NewWithField("topic", row.Topic), e.Error())
+			_, err = session.Exec("UPDATE outbox_message SET attempts = attempts + 1, retry_at = ?, last_error = ? WHERE id = ?",
+				now+int64(retryBackoff(row.Attempts+1)/time.Millisecond), truncate(e.Error(), maxErrorLen), row.Id)
+			if err != nil {
+				session.Rollback()
+				return 0, fetched, err
+			}
+			continue
+		}
+		ids = append(ids, row.Id)
+	}
+	if len(ids) > 0 {
+		_, err = session.In("id", ids).Cols("status", "sent_at").Update(&outboxMessage{Status: StatusSent, SentAt: now})
+		if err != nil {
+			session.Rollback()
+			return 0, fetched, err
+		}
+	}
+	if err = session.Commit(); err != nil {
+		return 0, fetched, err
+	}
+	return len(ids), fetched, nil
+}
+
+/**
+ * 投递全部待投递的任务，作为cron任务使用：
+ * schedule.AddFunc(c, "outbox_relay", "@every 1s", relay.Relay, schedule.SkipIfRunning(true))
+ */
+func (r *Relay) Relay(ctx context.Context) error {
+	for ctx.Err() == nil {
+		_, fetched, err := r.RelayOnce(ctx)
+		if err != nil {
+			return err
+		}
+		if fetched < r.batchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+/**
+ * 持续投递待投递的任务直到ctx取消，作为常驻的command运行或者在goroutine中运行
+ */
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Relay(ctx); err != nil {
+			logger.Error(ctx, "outbox_relay_error", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+/**
+ * 删除投递时间早于before的已投递任务
+ */
+func (r *Relay) Clean(ctx context.Context, before time.Time) (int64, error) {
+	ms := before.UnixNano() / int64(time.Millisecond)
+	return db.GetDb(r.diName).Master().Where("status = ? AND sent_at < ?", StatusSent, ms).Delete(new(outboxMessage))
+}
+
+/**
+ * 待投递的任务数，包括等待重试的任务
+ */
+func (r *Relay) Pending(ctx context.Context) (int64, error) {
+	return db.GetDb(r.diName).Master().Where("status = ?", StatusPending).Count(new(outboxMessage))
+}
+
+//按写入时的方式投递任务，延迟任务按剩余的延迟时间入队
+func (r *Relay) send(ctx context.Context, row *outboxMessage, now int64) error {
+	task, err := work.DecodeStringTask(row.Task)
+	if err != nil {
+		return err
+	}
+
+	args := make([]interface{}, 0, 1)
+	if remain := row.AvailableAt - now; remain > 0 {
+		args = append(args, (remain+999)/1000)
+	}
+	var ok bool
+	if row.Mode == modePublish {
+		ok, err = r.job.PublishWithTask(ctx, row.Topic, task, args...)
+	} else {
+		ok, err = r.job.EnqueueWithTask(ctx, row.Topic, task, args...)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("enqueue failed")
+	}
+	return nil
+}
+
+//第attempts次失败后的重试间隔，从1秒开始翻倍，最长1分钟
+func retryBackoff(attempts int) time.Duration {
+	d := time.Second
+	for i := 1; i < attempts && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return d
+}
+
+//按字符截断，避免截断多字节字符
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
@@ -6,8 +6,11 @@ import (
 )
 
 const (
-	DriverTypeRedis  = "redis"
-	DriverTypeAliMns = "ali_mns"
+	DriverTypeRedis       = "redis"
+	DriverTypeAliMns      = "ali_mns"
+	DriverTypeRedisStream = "redis_stream"
+	DriverTypeDb          = "db"
+	DriverTypeMemory      = "memory"
 )
 
 var (
@@ -45,6 +48,19 @@ func GetQueue(diName string, driverType string) (q Queue) {
 	return
 }
 
+/**
+ * 从入队参数中获取延迟秒数，args[0]为int64类型的延迟秒数，不存在或者小于0时返回0
+ */
+func GetDelay(args ...interface{}) (delay int64) {
+	if len(args) > 0 {
+		delay, _ = args[0].(int64)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return
+}
+
 func init() {
 	drivers = make(map[string]Instance)
 }
@@ -63,3 +63,12 @@ func TestGetQueue_Nil(t *testing.T) {
 	}()
 	GetQueue("unknown", "mock")
 }
+
+func TestGetDelay(t *testing.T) {
+	if GetDelay() != 0 || GetDelay(int64(-1)) != 0 || GetDelay(3) != 0 {
+		t.Error("invalid delay must be 0")
+	}
+	if GetDelay(int64(3)) != 3 {
+		t.Error("delay error")
+	}
+}
@@ -0,0 +1,110 @@
+package redislimiter
+
+import (
+	"context"
+	redis_pool "github.com/hetiansu5/go-redis-pool"
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/snow-core/utils"
+	"time"
+)
+
+//限流key的前缀
+const keyPrefix = "work:limiter:"
+
+//令牌桶，令牌数和上次计算时间存放在hash中
+//KEYS[1] 令牌桶key
+//ARGV[1] 每秒生成的令牌数 ARGV[2] 桶容量 ARGV[3] 当前毫秒时间戳
+//@return 0表示获取到令牌，否则为需要等待的毫秒数
+const acquireScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+	ts = now
+end
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return wait
+`
+
+//基于redis的令牌桶限流器，多个进程使用相同key时共享限流额度，实现work.Limiter接口
+type RedisLimiter struct {
+	client *redis_pool.ReplicaPool
+	key    string
+	//每秒生成的令牌数
+	rate float64
+	//桶容量，即允许的突发数
+	burst int
+}
+
+/**
+ * 生成限流器
+ * @param diName redis实例名
+ * @param key 限流key，相同key共享限流额度
+ * @param rate 每秒允许的任务数
+ * @param burst 允许的突发任务数，小于1时按1处理
+ */
+func NewRedisLimiter(diName string, key string, rate float64, burst int) *RedisLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RedisLimiter{
+		client: redis.GetRedis(diName),
+		key:    keyPrefix + key,
+		rate:   rate,
+		burst:  burst,
+	}
+}
+
+/**
+ * 尝试获取一个令牌
+ * @return 需要等待的时间，0表示已获取到令牌
+ */
+func (m *RedisLimiter) Acquire(ctx context.Context) (time.Duration, error) {
+	reply, err := m.client.Do("EVAL", acquireScript, 1, m.key, m.rate, m.burst, utils.GetCurrentMilliTime())
+	if err != nil {
+		return 0, err
+	}
+	wait, _ := reply.(int64)
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+/**
+ * 阻塞直到获取到令牌，ctx取消时返回错误
+ */
+func (m *RedisLimiter) Wait(ctx context.Context) error {
+	if m.rate <= 0 {
+		return nil
+	}
+	for {
+		wait, err := m.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package redislimiter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"github.com/qit-team/snow-core/config"
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/work"
+)
+
+var _ work.Limiter = &RedisLimiter{}
+
+func init() {
+	redisConf := config.RedisConfig{
+		Master: config.RedisBaseConfig{
+			Host: "127.0.0.1",
+			Port: 6379,
+		},
+	}
+
+	//注册redis类
+	err := redis.Pr.Register("redis", redisConf, true)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	ctx := context.TODO()
+	key := fmt.Sprintf("snow-limiter-%d", time.Now().UnixNano())
+	l := NewRedisLimiter("redis", key, 10, 2)
+
+	//突发容量内立即获取到令牌
+	for i := 0; i < 2; i++ {
+		wait, err := l.Acquire(ctx)
+		if err != nil {
+			t.Error(err)
+			return
+		} else if wait != 0 {
+			t.Errorf("acquire %d must not wait, real %s", i, wait)
+			return
+		}
+	}
+
+	wait, err := l.Acquire(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if wait <= 0 || wait > 100*time.Millisecond {
+		t.Errorf("acquire must wait about 100ms, real %s", wait)
+		return
+	}
+}
+
+func TestWait(t *testing.T) {
+	key := fmt.Sprintf("snow-limiter-wait-%d", time.Now().UnixNano())
+	l := NewRedisLimiter("redis", key, 20, 1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		err := l.Wait(context.TODO())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Errorf("3 tokens at 20/s must take about 100ms, real %s", d)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond)
+	defer cancel()
+	l = NewRedisLimiter("redis", key, 0.1, 1)
+	l.Acquire(ctx)
+	if err := l.Wait(ctx); err == nil {
+		t.Error("wait must return error after ctx timeout")
+		return
+	}
+}
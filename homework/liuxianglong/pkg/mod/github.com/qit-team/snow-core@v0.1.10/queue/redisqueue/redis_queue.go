@@ -7,6 +7,32 @@ import (
 	"errors"
 	"sync"
 	"github.com/qit-team/snow-core/queue"
+	"github.com/qit-team/snow-core/utils"
+	"github.com/qit-team/work"
+	"strconv"
+	"time"
+	"os"
+	"fmt"
+)
+
+const (
+	//延迟消息暂存的有序集合key后缀
+	delayedSuffix = ":delayed"
+	//高优先级和低优先级队列的key后缀，默认优先级使用原key
+	highSuffix = ":high"
+	lowSuffix  = ":low"
+	//处理中消息哈希表的key后缀
+	processingSuffix = ":processing"
+	//处理中消息可见性超时时间的有序集合key后缀
+	inflightSuffix = ":inflight"
+	//单次出队时最多转移的到期延迟消息数
+	promoteLimit = 100
+	//单次最多回收的超时消息数
+	reapLimit = 100
+	//消息出队后默认的可见性超时时间，超时未ack的消息会被重新放回队列
+	DefaultVisibilityTimeout = 30 * time.Second
+	//默认回收超时消息的最小间隔
+	DefaultReapInterval = time.Second
 )
 
 var (
@@ -16,15 +42,60 @@ var (
 
 type RedisQueue struct {
 	client *redis_pool.ReplicaPool
+	//消费者标识，作为token的前缀，便于排查处理中的消息属于哪个进程
+	consumer string
+	//可见性超时时间
+	visibilityTimeout time.Duration
+	//回收超时消息的最小间隔
+	reapInterval time.Duration
+
+	//各key最近一次回收超时消息的时间
+	reapLock sync.Mutex
+	reapAt   map[string]time.Time
 }
 
 //new实例
 func newRedisQueue(diName string) queue.Queue {
 	m := new(RedisQueue)
 	m.client = redis.GetRedis(diName)
+	m.consumer = defaultConsumer()
+	m.visibilityTimeout = DefaultVisibilityTimeout
+	m.reapInterval = DefaultReapInterval
+	m.reapAt = make(map[string]time.Time)
 	return m
 }
 
+//默认消费者标识 hostname:pid
+func defaultConsumer() string {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+//设置消费者标识，不能包含"|"
+func (m *RedisQueue) SetConsumer(consumer string) {
+	m.consumer = consumer
+}
+
+//设置可见性超时时间，需要大于任务的最长处理时间，否则未处理完成的消息会被重复投递
+func (m *RedisQueue) SetVisibilityTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		m.visibilityTimeout = timeout
+	}
+}
+
+//可见性超时时间，Job启动时检查worker的任务超时时间是否小于此时间
+func (m *RedisQueue) VisibilityTimeout() time.Duration {
+	return m.visibilityTimeout
+}
+
+//设置回收超时消息的最小间隔
+func (m *RedisQueue) SetReapInterval(interval time.Duration) {
+	m.reapInterval = interval
+}
+
 //单例模式
 func GetRedisQueue(diName string) queue.Queue {
 	key := diName
@@ -44,9 +115,23 @@ func GetRedisQueue(diName string) queue.Queue {
 
 /**
  * 队列消息入队
+ * args[0] delay 延迟消息，单位秒
  */
 func (m *RedisQueue) Enqueue(ctx context.Context, key string, message string, args ...interface{}) (bool, error) {
-	//redis暂时不要延迟和优先级
+	return m.EnqueuePriority(ctx, key, message, work.PriorityNormal, args...)
+}
+
+/**
+ * 队列消息按优先级入队，不同优先级的消息存放在不同的列表
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *RedisQueue) EnqueuePriority(ctx context.Context, key string, message string, priority int, args ...interface{}) (bool, error) {
+	key = priorityKey(key, priority)
+	delay := queue.GetDelay(args...)
+	if delay > 0 {
+		return m.enqueueDelayed(key, []string{message}, delay)
+	}
+
 	_, err := m.client.RPush(key, message)
 	if err != nil {
 		return false, err
@@ -56,31 +141,112 @@ func (m *RedisQueue) Enqueue(ctx context.Context, key string, message string, ar
 
 /**
  * 队列消息出队
+ * 消息会原子地转移到处理中哈希表，返回的token用于ack，超过可见性超时时间未ack的消息会被重新放回队列
  */
 func (m *RedisQueue) Dequeue(ctx context.Context, key string) (message string, token string, err error) {
-	message, err = m.client.LPop(key)
-	if err == redis_pool.ErrNil {
-		err = nil
-		message = ""
+	return m.DequeuePriority(ctx, key, []int{work.PriorityNormal})
+}
+
+/**
+ * 按priorities的顺序依次尝试出队，各优先级共用处理中哈希表
+ */
+func (m *RedisQueue) DequeuePriority(ctx context.Context, key string, priorities []int) (message string, token string, err error) {
+	m.tryReap(key)
+
+	n := len(priorities)
+	keys := make([]interface{}, 0, n*2+2)
+	suffixes := make([]interface{}, 0, n)
+	for _, p := range priorities {
+		pk := priorityKey(key, p)
+		keys = append(keys, pk, pk+delayedSuffix)
+		suffixes = append(suffixes, pk[len(key):])
+	}
+	keys = append(keys, key+processingSuffix, key+inflightSuffix)
+
+	now := utils.GetCurrentMilliTime()
+	deadline := now + int64(m.visibilityTimeout/time.Millisecond)
+	params := append([]interface{}{dequeueScript, len(keys)}, keys...)
+	params = append(params, now, promoteLimit, m.consumer+"|"+utils.GenUUID(), deadline, n)
+	params = append(params, suffixes...)
+	reply, err := m.client.Do("EVAL", params...)
+	if err != nil {
+		return
+	}
+	if arr, ok := reply.([]interface{}); ok && len(arr) == 2 {
+		message = replyToString(arr[0])
+		token = replyToString(arr[1])
 	}
 	return
 }
 
 /**
- * 确认消息接收 redis暂时用不到
+ * 确认消息接收，从处理中哈希表移除
+ * 消息已经因超时被放回队列时返回false
  */
 func (m *RedisQueue) AckMsg(ctx context.Context, key string, token string) (bool, error) {
-	return true, nil
+	if token == "" {
+		return false, errors.New("invalid token")
+	}
+	reply, err := m.client.Do("EVAL", ackScript, 2, key+processingSuffix, key+inflightSuffix, token)
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n > 0, nil
 }
 
 /**
- * 队列消息入队
+ * 将超过可见性超时时间仍未ack的消息放回队列头部
+ * @return 放回队列的消息数
+ */
+func (m *RedisQueue) Reap(ctx context.Context, key string) (int64, error) {
+	reply, err := m.client.Do("EVAL", reapScript, 5, key, key+highSuffix, key+lowSuffix,
+		key+inflightSuffix, key+processingSuffix, utils.GetCurrentMilliTime(), reapLimit, highSuffix, lowSuffix)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return n, nil
+}
+
+//距离上次回收超过间隔时间时回收超时消息
+func (m *RedisQueue) tryReap(key string) {
+	now := time.Now()
+	m.reapLock.Lock()
+	last := m.reapAt[key]
+	if now.Sub(last) < m.reapInterval {
+		m.reapLock.Unlock()
+		return
+	}
+	m.reapAt[key] = now
+	m.reapLock.Unlock()
+
+	m.Reap(context.Background(), key)
+}
+
+/**
+ * 队列消息批量入队
+ * args[0] delay 延迟消息，单位秒
  */
 func (m *RedisQueue) BatchEnqueue(ctx context.Context, key string, messages []string, args ...interface{}) (bool, error) {
-	//redis暂时不要延迟和优先级
+	return m.BatchEnqueuePriority(ctx, key, messages, work.PriorityNormal, args...)
+}
+
+/**
+ * 队列消息按优先级批量入队
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *RedisQueue) BatchEnqueuePriority(ctx context.Context, key string, messages []string, priority int, args ...interface{}) (bool, error) {
+	key = priorityKey(key, priority)
 	if len(messages) == 0 {
 		return false, errors.New("messages is empty")
 	}
+
+	delay := queue.GetDelay(args...)
+	if delay > 0 {
+		return m.enqueueDelayed(key, messages, delay)
+	}
+
 	_, err := m.client.RPush(key, arrayStringToInterface(messages)...)
 	if err != nil {
 		return false, err
@@ -88,6 +254,127 @@ func (m *RedisQueue) BatchEnqueue(ctx context.Context, key string, messages []st
 	return true, err
 }
 
+/**
+ * 队列消息数，包括各优先级的队列
+ */
+func (m *RedisQueue) Len(ctx context.Context, key string) (int64, error) {
+	var total int64
+	for _, k := range priorityKeys(key) {
+		n, err := m.client.LLen(k)
+		if err != nil {
+			return 0, err
+		}
+		total += int64(n)
+	}
+	return total, nil
+}
+
+/**
+ * 按位置查看消息，不会出队，各优先级的队列按高、默认、低优先级的顺序连续编号，与Len一致
+ * stop小于0时查看start之后的全部消息
+ */
+func (m *RedisQueue) Range(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	if start < 0 {
+		start = 0
+	}
+	messages := make([]string, 0)
+	var offset int64
+	for _, k := range priorityKeys(key) {
+		if stop >= 0 && offset > stop {
+			break
+		}
+		n, err := m.client.LLen(k)
+		if err != nil {
+			return nil, err
+		}
+		//换算为当前队列内的位置
+		from, to := start-offset, int64(n)-1
+		if from < 0 {
+			from = 0
+		}
+		if stop >= 0 && stop-offset < to {
+			to = stop - offset
+		}
+		offset += int64(n)
+		if from > to {
+			continue
+		}
+		arr, err := m.client.LRange(k, from, to)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, arr...)
+	}
+	return messages, nil
+}
+
+/**
+ * 移除队列中的一条消息，按高、默认、低优先级的顺序查找
+ */
+func (m *RedisQueue) Remove(ctx context.Context, key string, message string) (bool, error) {
+	for _, k := range priorityKeys(key) {
+		n, err := m.client.LRem(k, 1, message)
+		if err != nil || n > 0 {
+			return n > 0, err
+		}
+	}
+	return false, nil
+}
+
+/**
+ * 清空队列，包括各优先级的队列和未到期的延迟消息
+ */
+func (m *RedisQueue) Purge(ctx context.Context, key string) (bool, error) {
+	_, err := m.client.Del(key, key+delayedSuffix, key+highSuffix, key+highSuffix+delayedSuffix,
+		key+lowSuffix, key+lowSuffix+delayedSuffix)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//延迟消息写入有序集合，score为到期的毫秒时间戳，出队时再转移到队列中
+func (m *RedisQueue) enqueueDelayed(key string, messages []string, delay int64) (bool, error) {
+	score := utils.GetCurrentMilliTime() + delay*1000
+	pairs := make([]interface{}, 0, len(messages)*2)
+	for _, message := range messages {
+		pairs = append(pairs, score, utils.GenUUID()+"|"+message)
+	}
+	_, err := m.client.ZAdd(key+delayedSuffix, pairs...)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//优先级对应的队列key
+func priorityKey(key string, priority int) string {
+	if priority > work.PriorityNormal {
+		return key + highSuffix
+	} else if priority < work.PriorityNormal {
+		return key + lowSuffix
+	}
+	return key
+}
+
+//各优先级的队列key，按出队的优先顺序排列
+func priorityKeys(key string) []string {
+	return []string{key + highSuffix, key, key + lowSuffix}
+}
+
+//redis返回值转换为字符串，nil时返回空字符串
+func replyToString(reply interface{}) string {
+	switch v := reply.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return ""
+}
+
 func arrayStringToInterface(arr []string) []interface{} {
 	newArr := make([]interface{}, len(arr))
 	for k, v := range arr {
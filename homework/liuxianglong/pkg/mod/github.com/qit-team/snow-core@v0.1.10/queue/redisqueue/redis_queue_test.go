@@ -7,8 +7,12 @@ import (
 	"fmt"
 	"github.com/qit-team/snow-core/redis"
 	"github.com/qit-team/snow-core/queue"
+	"github.com/qit-team/work"
+	"time"
 )
 
+var _ work.VisibilityQueue = &RedisQueue{}
+
 var q queue.Queue
 
 func init() {
@@ -28,9 +32,20 @@ func init() {
 	q = queue.GetQueue("redis", queue.DriverTypeRedis)
 }
 
+//清理队列、延迟消息和处理中的消息，避免上一次测试未ack的消息超时后被回收到队列中
+func reset(topic string) {
+	keys := make([]interface{}, 0, 8)
+	for _, k := range []string{topic, topic + highSuffix, topic + lowSuffix} {
+		keys = append(keys, k, k+delayedSuffix)
+	}
+	keys = append(keys, topic+processingSuffix, topic+inflightSuffix)
+	redis.GetRedis("redis").Del(keys...)
+}
+
 func TestEnqueue(t *testing.T) {
 	q := queue.GetQueue("redis", queue.DriverTypeRedis)
 	topic := "snow-topic-one"
+	reset(topic)
 	ctx := context.TODO()
 	msg := "1"
 	ok, err := q.Enqueue(ctx, topic, msg)
@@ -76,6 +91,7 @@ func TestEnqueue(t *testing.T) {
 func TestBatchEnqueue(t *testing.T) {
 	ctx := context.TODO()
 	topic := "snow-topic-batch"
+	reset(topic)
 	messages := []string{"11", "21"}
 	_, err := q.BatchEnqueue(ctx, topic, messages)
 	if err != nil {
@@ -116,3 +132,360 @@ func TestBatchEnqueueEmpty(t *testing.T) {
 		return
 	}
 }
+
+func TestEnqueueDelay(t *testing.T) {
+	ctx := context.TODO()
+	topic := "snow-topic-delay"
+	reset(topic)
+	msg := "delay"
+	ok, err := q.Enqueue(ctx, topic, msg, int64(1))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !ok {
+		t.Error("enqueue is not ok")
+		return
+	}
+
+	message, _, err := q.Dequeue(ctx, topic)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if message != "" {
+		t.Errorf("delay message must not be dequeued before due time %s", message)
+		return
+	}
+
+	time.Sleep(time.Millisecond * 1100)
+	message, _, err = q.Dequeue(ctx, topic)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if message != msg {
+		t.Errorf("message is not same %s", message)
+		return
+	}
+}
+
+func TestBatchEnqueueDelay(t *testing.T) {
+	ctx := context.TODO()
+	topic := "snow-topic-batch-delay"
+	reset(topic)
+	messages := []string{"same", "same"}
+	_, err := q.BatchEnqueue(ctx, topic, messages, int64(1))
+	if err != nil {
+		t.Error("batch enqueue error", err)
+		return
+	}
+
+	time.Sleep(time.Millisecond * 1100)
+	for i := 0; i < len(messages); i++ {
+		message, _, err := q.Dequeue(ctx, topic)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if message != messages[i] {
+			t.Errorf("message is not same origin:%s real:%s", messages[i], message)
+			return
+		}
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	ctx := context.TODO()
+	topic := "snow-topic-browse"
+	bq, ok := q.(work.BrowsableQueue)
+	if !ok {
+		t.Error("redis queue must implement BrowsableQueue")
+		return
+	}
+
+	_, err := bq.Purge(ctx, topic)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	messages := []string{"a", "b", "c"}
+	_, err = q.BatchEnqueue(ctx, topic, messages)
+	if err != nil {
+		t.Error("batch enqueue error", err)
+		return
+	}
+
+	n, err := bq.Len(ctx, topic)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if n != 3 {
+		t.Errorf("len is not 3 but %d", n)
+		return
+	}
+
+	arr, err := bq.Range(ctx, topic, 1, 2)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if len(arr) != 2 || arr[0] != "b" || arr[1] != "c" {
+		t.Errorf("range is not match %v", arr)
+		return
+	}
+
+	ok, err = bq.Remove(ctx, topic, "b")
+	if err != nil || !ok {
+		t.Error("remove failed", err)
+		return
+	}
+
+	_, err = bq.Purge(ctx, topic)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	n, _ = bq.Len(ctx, topic)
+	if n != 0 {
+		t.Errorf("queue must be empty after purge, len %d", n)
+		return
+	}
+}
+
+func TestAckAndReap(t *testing.T) {
+	ctx := context.TODO()
+	topic := "snow-topic-reap"
+	reset(topic)
+	rq := newRedisQueue("redis").(*RedisQueue)
+	rq.SetVisibilityTimeout(time.Millisecond * 100)
+	rq.SetReapInterval(time.Hour)
+
+	_, err := rq.Enqueue(ctx, topic, "reap")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	message, token, err := rq.Dequeue(ctx, topic)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if message != "reap" || token == "" {
+		t.Errorf("dequeue is not match message:%s token:%s", message, token)
+		return
+	}
+
+	//未超时不会被回收
+	n, err := rq.Reap(ctx, topic)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if n != 0 {
+		t.Errorf("reap count must be 0 before timeout, real %d", n)
+		return
+	}
+
+	time.Sleep(time.Millisecond * 150)
+	n, err = rq.Reap(ctx, topic)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if n != 1 {
+		t.Errorf("reap count must be 1 after timeout, real %d", n)
+		return
+	}
+
+	//超时回收后原token的ack无效
+	ok, err := rq.AckMsg(ctx, topic, token)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if ok {
+		t.Error("ack must be false after reaped")
+		return
+	}
+
+	message, token, err = rq.Dequeue(ctx, topic)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if message != "reap" {
+		t.Errorf("reaped message is not redelivered %s", message)
+		return
+	}
+
+	ok, err = rq.AckMsg(ctx, topic, token)
+	if err != nil || !ok {
+		t.Error("ack failed", err)
+		return
+	}
+
+	time.Sleep(time.Millisecond * 150)
+	n, _ = rq.Reap(ctx, topic)
+	if n != 0 {
+		t.Errorf("acked message must not be reaped, real %d", n)
+		return
+	}
+}
+
+func TestBrowse_priority(t *testing.T) {
+	ctx := context.TODO()
+	topic := "snow-topic-browse-priority"
+	rq := newRedisQueue("redis").(*RedisQueue)
+	rq.Purge(ctx, topic)
+
+	rq.EnqueuePriority(ctx, topic, "low", work.PriorityLow)
+	rq.BatchEnqueue(ctx, topic, []string{"normal1", "normal2"})
+	rq.EnqueuePriority(ctx, topic, "high", work.PriorityHigh)
+
+	//各优先级的消息按出队顺序连续编号
+	arr, err := rq.Range(ctx, topic, 0, -1)
+	if err != nil || len(arr) != 4 || arr[0] != "high" || arr[1] != "normal1" || arr[3] != "low" {
+		t.Errorf("range must contain every priority, real %v %v", arr, err)
+		return
+	}
+	arr, _ = rq.Range(ctx, topic, 1, 2)
+	if len(arr) != 2 || arr[0] != "normal1" || arr[1] != "normal2" {
+		t.Errorf("range error, real %v", arr)
+		return
+	}
+	arr, _ = rq.Range(ctx, topic, 3, 10)
+	if len(arr) != 1 || arr[0] != "low" {
+		t.Errorf("range error, real %v", arr)
+		return
+	}
+
+	ok, err := rq.Remove(ctx, topic, "low")
+	if err != nil || !ok {
+		t.Error("remove low priority message failed", err)
+		return
+	}
+	if n, _ := rq.Len(ctx, topic); n != 3 {
+		t.Errorf("len must be 3, real %d", n)
+		return
+	}
+	rq.Purge(ctx, topic)
+}
+
+func TestPriority(t *testing.T) {
+	ctx := context.TODO()
+	topic := "snow-topic-priority"
+	reset(topic)
+	rq := newRedisQueue("redis").(*RedisQueue)
+	rq.SetVisibilityTimeout(time.Millisecond * 100)
+	rq.SetReapInterval(time.Hour)
+	rq.Purge(ctx, topic)
+
+	rq.EnqueuePriority(ctx, topic, "low", work.PriorityLow)
+	rq.Enqueue(ctx, topic, "normal")
+	rq.BatchEnqueuePriority(ctx, topic, []string{"high"}, work.PriorityHigh)
+
+	n, err := rq.Len(ctx, topic)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if n != 3 {
+		t.Errorf("len must be 3, real %d", n)
+		return
+	}
+
+	//普通出队只读取默认优先级
+	message, token, err := rq.Dequeue(ctx, topic)
+	if err != nil || message != "normal" {
+		t.Errorf("dequeue must be normal, real %s %v", message, err)
+		return
+	}
+	rq.AckMsg(ctx, topic, token)
+
+	order := []int{work.PriorityLow, work.PriorityHigh, work.PriorityNormal}
+	message, token, err = rq.DequeuePriority(ctx, topic, order)
+	if err != nil || message != "low" {
+		t.Errorf("dequeue must be low, real %s %v", message, err)
+		return
+	}
+
+	//超时回收后放回原优先级的队列
+	time.Sleep(time.Millisecond * 150)
+	if n, _ := rq.Reap(ctx, topic); n != 1 {
+		t.Errorf("reap count must be 1, real %d", n)
+		return
+	}
+	message, token, _ = rq.DequeuePriority(ctx, topic, order)
+	if message != "low" {
+		t.Errorf("reaped message must be low, real %s", message)
+		return
+	}
+	ok, err := rq.AckMsg(ctx, topic, token)
+	if err != nil || !ok {
+		t.Error("ack failed", err)
+		return
+	}
+
+	message, _, _ = rq.DequeuePriority(ctx, topic, order)
+	if message != "high" {
+		t.Errorf("dequeue must be high, real %s", message)
+		return
+	}
+	rq.Purge(ctx, topic)
+}
+
+func TestAck_processingHash(t *testing.T) {
+	ctx := context.TODO()
+	topic := "snow-topic-processing"
+	a := newRedisQueue("redis").(*RedisQueue)
+	a.SetConsumer("a")
+	a.SetReapInterval(time.Hour)
+	b := newRedisQueue("redis").(*RedisQueue)
+	b.SetConsumer("b")
+	client := redis.GetRedis("redis")
+	reset(topic)
+
+	a.BatchEnqueue(ctx, topic, []string{"1", "2"})
+	_, token1, _ := a.Dequeue(ctx, topic)
+	_, token2, _ := a.Dequeue(ctx, topic)
+
+	//处理中的消息按token记录在哈希表中
+	n, err := client.Do("HLEN", topic+processingSuffix)
+	if err != nil || n.(int64) != 2 {
+		t.Error("processing hash must contain the dequeued messages", n, err)
+		return
+	}
+
+	//其他消费者也可以按token确认消息
+	ok, err := b.AckMsg(ctx, topic, token2)
+	if err != nil || !ok {
+		t.Error("ack by token error", err)
+		return
+	}
+	ok, _ = a.AckMsg(ctx, topic, token2)
+	if ok {
+		t.Error("message must not be acked twice")
+		return
+	}
+	ok, _ = a.AckMsg(ctx, topic, token1)
+	if !ok {
+		t.Error("ack error")
+		return
+	}
+
+	n, _ = client.Do("HLEN", topic+processingSuffix)
+	m, _ := client.Do("ZCARD", topic+inflightSuffix)
+	if n.(int64) != 0 || m.(int64) != 0 {
+		t.Error("acked messages must be removed", n, m)
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	rq := newRedisQueue("redis").(*RedisQueue)
+	if rq.VisibilityTimeout() != DefaultVisibilityTimeout {
+		t.Error("default visibility timeout error", rq.VisibilityTimeout())
+		return
+	}
+	//小于等于0的值不生效
+	rq.SetVisibilityTimeout(0)
+	rq.SetVisibilityTimeout(time.Minute)
+	rq.SetVisibilityTimeout(-time.Second)
+	if rq.VisibilityTimeout() != time.Minute {
+		t.Error("visibility timeout error", rq.VisibilityTimeout())
+	}
+}
@@ -0,0 +1,66 @@
+package redisqueue
+
+//处理中消息存放在哈希表中，field为token，value为消息，token格式为"consumer|uuid"加上出队列表的优先级后缀
+//脚本用到的key都通过KEYS传入，Redis Cluster下需要用{hash tag}使同一队列的key落在同一个slot
+
+//按优先级顺序将到期的延迟消息转移到队列后出队，出队的消息原子地放入处理中哈希表并记录可见性超时时间
+//延迟消息成员格式为"uuid|message"，转移时去掉37位的前缀
+//token为ARGV[3]加上出队列表的优先级后缀，回收时据此放回原优先级的队列
+//KEYS[2i-1] 第i个优先级的队列key KEYS[2i] 第i个优先级的延迟消息有序集合key
+//KEYS[2n+1] 处理中哈希表key KEYS[2n+2] 可见性超时有序集合key
+//ARGV[1] 当前毫秒时间戳 ARGV[2] 单次转移上限 ARGV[3] token前缀 ARGV[4] 可见性超时的毫秒时间戳
+//ARGV[5] 优先级数量n ARGV[5+i] 第i个优先级的key后缀
+const dequeueScript = `
+local n = tonumber(ARGV[5])
+for i = 1, n do
+	local items = redis.call('ZRANGEBYSCORE', KEYS[i * 2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+	for _, item in ipairs(items) do
+		redis.call('RPUSH', KEYS[i * 2 - 1], string.sub(item, 38))
+		redis.call('ZREM', KEYS[i * 2], item)
+	end
+end
+for i = 1, n do
+	local msg = redis.call('LPOP', KEYS[i * 2 - 1])
+	if msg then
+		local token = ARGV[3] .. ARGV[5 + i]
+		redis.call('HSET', KEYS[n * 2 + 1], token, msg)
+		redis.call('ZADD', KEYS[n * 2 + 2], ARGV[4], token)
+		return {msg, token}
+	end
+end
+return false
+`
+
+//确认消息，从处理中哈希表和可见性超时有序集合中移除
+//KEYS[1] 处理中哈希表key KEYS[2] 可见性超时有序集合key ARGV[1] token
+const ackScript = `
+redis.call('ZREM', KEYS[2], ARGV[1])
+return redis.call('HDEL', KEYS[1], ARGV[1])
+`
+
+//将可见性超时的消息从处理中哈希表放回原优先级队列的头部，token中uuid之后的部分为优先级的key后缀
+//KEYS[1] 默认优先级队列key KEYS[2] 高优先级队列key KEYS[3] 低优先级队列key
+//KEYS[4] 可见性超时有序集合key KEYS[5] 处理中哈希表key
+//ARGV[1] 当前毫秒时间戳 ARGV[2] 单次回收上限 ARGV[3] 高优先级key后缀 ARGV[4] 低优先级key后缀
+const reapScript = `
+local tokens = redis.call('ZRANGEBYSCORE', KEYS[4], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local n = 0
+for _, token in ipairs(tokens) do
+	local msg = redis.call('HGET', KEYS[5], token)
+	if msg then
+		local queue = KEYS[1]
+		local pos = string.find(token, '|[^|]*$')
+		local suffix = pos and string.sub(token, pos + 37) or ''
+		if suffix == ARGV[3] then
+			queue = KEYS[2]
+		elseif suffix == ARGV[4] then
+			queue = KEYS[3]
+		end
+		redis.call('HDEL', KEYS[5], token)
+		redis.call('LPUSH', queue, msg)
+		n = n + 1
+	end
+	redis.call('ZREM', KEYS[4], token)
+end
+return n
+`
@@ -0,0 +1,116 @@
+package redisstore
+
+import (
+	"context"
+	redis_pool "github.com/hetiansu5/go-redis-pool"
+	"github.com/qit-team/snow-core/redis"
+	"sync"
+	"time"
+)
+
+var (
+	mp map[string]*RedisStore
+	mu sync.RWMutex
+)
+
+/**
+ * 记录任务组成员完成的脚本，成员首次写入且全部完成时返回1
+ * KEYS[1] 任务组key
+ * ARGV[1] 成员 ARGV[2] 成员数 ARGV[3] 过期时间(毫秒)
+ */
+const addGroupMemberScript = `
+local added = redis.call('SADD', KEYS[1], ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+if added == 1 and redis.call('SCARD', KEYS[1]) == tonumber(ARGV[2]) then
+	return 1
+end
+return 0
+`
+
+//基于redis的幂等存储和任务组存储，实现work.IdempotentStore和work.GroupStore接口
+type RedisStore struct {
+	client *redis_pool.ReplicaPool
+}
+
+//new实例，读写都走主库，避免主从延迟导致判断失效
+func newRedisStore(diName string) *RedisStore {
+	m := new(RedisStore)
+	m.client = redis.GetRedis(diName).WithMaster()
+	return m
+}
+
+//单例模式
+func GetRedisStore(diName string) *RedisStore {
+	key := diName
+	mu.RLock()
+	s, ok := mp[key]
+	mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	s = newRedisStore(diName)
+	mu.Lock()
+	mp[key] = s
+	mu.Unlock()
+	return s
+}
+
+/**
+ * key不存在时写入，ttl后过期
+ */
+func (m *RedisStore) SetNX(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	ms := int64(ttl / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	reply, err := m.client.Do("SET", key, 1, "PX", ms, "NX")
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+/**
+ * key是否存在
+ */
+func (m *RedisStore) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := m.client.Exists(key)
+	return n > 0, err
+}
+
+/**
+ * 删除key
+ */
+func (m *RedisStore) Delete(ctx context.Context, key string) error {
+	_, err := m.client.Del(key)
+	return err
+}
+
+/**
+ * 记录任务组成员已完成，本次写入使全部成员完成时返回true
+ */
+func (m *RedisStore) AddGroupMember(ctx context.Context, key string, member string, size int, ttl time.Duration) (bool, error) {
+	ms := int64(ttl / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	reply, err := m.client.Do("EVAL", addGroupMemberScript, 1, key, member, size, ms)
+	if err != nil {
+		return false, err
+	}
+	done, _ := reply.(int64)
+	return done == 1, nil
+}
+
+/**
+ * 移除任务组已完成的成员
+ */
+func (m *RedisStore) RemoveGroupMember(ctx context.Context, key string, member string) error {
+	_, err := m.client.Do("SREM", key, member)
+	return err
+}
+
+func init() {
+	mp = make(map[string]*RedisStore)
+}
@@ -0,0 +1,116 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"github.com/qit-team/snow-core/config"
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/work"
+)
+
+var (
+	_ work.IdempotentStore = &RedisStore{}
+	_ work.GroupStore      = &RedisStore{}
+)
+
+func init() {
+	redisConf := config.RedisConfig{
+		Master: config.RedisBaseConfig{
+			Host: "127.0.0.1",
+			Port: 6379,
+		},
+	}
+
+	//注册redis类
+	err := redis.Pr.Register("redis", redisConf, true)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func TestSetNX(t *testing.T) {
+	ctx := context.TODO()
+	s := GetRedisStore("redis")
+	key := "snow-store-setnx"
+	s.Delete(ctx, key)
+
+	ok, err := s.SetNX(ctx, key, time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if !ok {
+		t.Error("first setnx must be ok")
+		return
+	}
+
+	ok, err = s.SetNX(ctx, key, time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if ok {
+		t.Error("second setnx must not be ok")
+		return
+	}
+
+	ok, err = s.Exists(ctx, key)
+	if err != nil || !ok {
+		t.Error("key must exist", err)
+		return
+	}
+
+	err = s.Delete(ctx, key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ok, _ = s.Exists(ctx, key)
+	if ok {
+		t.Error("key must not exist after delete")
+		return
+	}
+}
+
+func TestGroupMember(t *testing.T) {
+	ctx := context.TODO()
+	s := GetRedisStore("redis")
+	key := "snow-store-group"
+	s.Delete(ctx, key)
+
+	done, err := s.AddGroupMember(ctx, key, "a", 2, time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if done {
+		t.Error("group must not be done with one member")
+		return
+	}
+
+	done, err = s.AddGroupMember(ctx, key, "b", 2, time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if !done {
+		t.Error("group must be done with all members")
+		return
+	}
+
+	//重复投递的成员不会再次触发
+	done, _ = s.AddGroupMember(ctx, key, "b", 2, time.Minute)
+	if done {
+		t.Error("duplicate member must not complete the group again")
+		return
+	}
+
+	err = s.RemoveGroupMember(ctx, key, "b")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	done, _ = s.AddGroupMember(ctx, key, "b", 2, time.Minute)
+	if !done {
+		t.Error("group must be done after member re-added")
+	}
+	s.Delete(ctx, key)
+}
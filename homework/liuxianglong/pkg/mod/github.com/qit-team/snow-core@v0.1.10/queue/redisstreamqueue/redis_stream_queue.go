@@ -0,0 +1,621 @@
+package redisstreamqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	redis_pool "github.com/hetiansu5/go-redis-pool"
+	"github.com/qit-team/snow-core/queue"
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/snow-core/utils"
+	"github.com/qit-team/work"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//stream entry中存放消息的字段名
+	messageField = "m"
+	//延迟消息暂存的有序集合key后缀
+	delayedSuffix = ":delayed"
+	//单次出队时最多转移的到期延迟消息数
+	promoteLimit = 100
+	//非订阅组的key使用的消费组
+	DefaultGroup = "default"
+	//stream默认保留的消息数(近似值)，超出时裁剪最旧的消息，未消费的消息也会被裁剪
+	DefaultMaxLen = 100000
+	//单次认领时检查的pending消息数
+	reclaimLimit = 100
+	//不支持lag统计的Redis版本统计未读取消息数时最多检查的消息数
+	lenCountLimit = 1000
+	//消息出队后默认的可见性超时时间，超时未ack的消息会被其他消费者认领后重新投递
+	DefaultVisibilityTimeout = 30 * time.Second
+	//默认检查超时消息的最小间隔
+	DefaultReclaimInterval = time.Second
+)
+
+var (
+	mp map[string]queue.Queue
+	mu sync.RWMutex
+)
+
+/**
+ * 基于Redis Streams消费组的队列
+ * key为 <topic>#<group> 时作为topic的订阅组：读取topic的stream和订阅组私有的 <topic>#<group> stream，重试消息只写入私有的stream
+ * 其他key使用DefaultGroup消费组，即点对点队列
+ * 消息ack后仍保留在stream中，按MaxLen裁剪，可以通过Replay重放
+ * 出队后超过可见性超时时间未ack的消息会被认领并重新投递
+ */
+type RedisStreamQueue struct {
+	client *redis_pool.ReplicaPool
+	//消费者标识
+	consumer string
+	//stream保留的消息数
+	maxLen int64
+	//新建消费组时是否只消费之后写入的消息，默认从stream中最早的消息开始
+	startFromLatest bool
+	//可见性超时时间
+	visibilityTimeout time.Duration
+	//检查超时消息的最小间隔
+	reclaimInterval time.Duration
+
+	//各stream的消费组最近一次没有认领到消息的时间
+	reclaimLock sync.Mutex
+	reclaimAt   map[string]time.Time
+
+	//已创建的消费组 <stream>|<group>
+	groups sync.Map
+}
+
+//new实例，读写都走主库
+func newRedisStreamQueue(diName string) queue.Queue {
+	m := new(RedisStreamQueue)
+	m.client = redis.GetRedis(diName).WithMaster()
+	m.consumer = defaultConsumer()
+	m.maxLen = DefaultMaxLen
+	m.visibilityTimeout = DefaultVisibilityTimeout
+	m.reclaimInterval = DefaultReclaimInterval
+	m.reclaimAt = make(map[string]time.Time)
+	return m
+}
+
+//默认消费者标识 hostname:pid
+func defaultConsumer() string {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+//设置消费者标识
+func (m *RedisStreamQueue) SetConsumer(consumer string) {
+	m.consumer = consumer
+}
+
+//设置stream保留的消息数，小于等于0时不裁剪
+func (m *RedisStreamQueue) SetMaxLen(maxLen int64) {
+	m.maxLen = maxLen
+}
+
+//新建的消费组只消费之后写入的消息，需要在首次出队前设置
+func (m *RedisStreamQueue) SetStartFromLatest(latest bool) {
+	m.startFromLatest = latest
+}
+
+//设置可见性超时时间，需要大于任务的最长处理时间，否则未处理完成的消息会被重复投递
+func (m *RedisStreamQueue) SetVisibilityTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		m.visibilityTimeout = timeout
+	}
+}
+
+//可见性超时时间，Job启动时检查worker的任务超时时间是否小于此时间
+func (m *RedisStreamQueue) VisibilityTimeout() time.Duration {
+	return m.visibilityTimeout
+}
+
+//设置检查超时消息的最小间隔
+func (m *RedisStreamQueue) SetReclaimInterval(interval time.Duration) {
+	m.reclaimInterval = interval
+}
+
+//单例模式
+func GetRedisStreamQueue(diName string) queue.Queue {
+	key := diName
+	mu.RLock()
+	q, ok := mp[key]
+	mu.RUnlock()
+	if ok {
+		return q
+	}
+
+	q = newRedisStreamQueue(diName)
+	mu.Lock()
+	mp[key] = q
+	mu.Unlock()
+	return q
+}
+
+/**
+ * 队列消息入队，订阅组的key写入订阅组私有的stream
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *RedisStreamQueue) Enqueue(ctx context.Context, key string, message string, args ...interface{}) (bool, error) {
+	return m.BatchEnqueue(ctx, key, []string{message}, args...)
+}
+
+/**
+ * 队列消息批量入队
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *RedisStreamQueue) BatchEnqueue(ctx context.Context, key string, messages []string, args ...interface{}) (bool, error) {
+	if len(messages) == 0 {
+		return false, errors.New("messages is empty")
+	}
+
+	delay := queue.GetDelay(args...)
+	if delay > 0 {
+		return m.enqueueDelayed(key, messages, delay)
+	}
+
+	params := make([]interface{}, 0, len(messages)+4)
+	params = append(params, batchAddScript, 1, key, m.maxLen)
+	for _, message := range messages {
+		params = append(params, message)
+	}
+	_, err := m.client.Do("EVAL", params...)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+/**
+ * 发布消息，topic的每个订阅组都会收到
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *RedisStreamQueue) Publish(ctx context.Context, topic string, message string, args ...interface{}) (bool, error) {
+	return m.BatchEnqueue(ctx, topic, []string{message}, args...)
+}
+
+/**
+ * 批量发布消息
+ * args[0] delay 延迟消息，单位秒
+ */
+func (m *RedisStreamQueue) BatchPublish(ctx context.Context, topic string, messages []string, args ...interface{}) (bool, error) {
+	return m.BatchEnqueue(ctx, topic, messages, args...)
+}
+
+/**
+ * 队列消息出队，消息不存在时返回空字符串
+ * 优先认领超过可见性超时时间未ack的消息，再读取新消息
+ * 返回的token为 <stream>|<entry id>，用于ack
+ */
+func (m *RedisStreamQueue) Dequeue(ctx context.Context, key string) (message string, token string, err error) {
+	streams, group := parseKey(key)
+	if err = m.promote(streams); err != nil {
+		return
+	}
+
+	//订阅组私有的stream优先
+	for i := len(streams) - 1; i >= 0; i-- {
+		message, token, err = m.tryReclaim(streams[i], group)
+		if err != nil || token != "" {
+			return
+		}
+	}
+	for i := len(streams) - 1; i >= 0; i-- {
+		message, token, err = m.readGroup(streams[i], group)
+		if err != nil || token != "" {
+			return
+		}
+	}
+	return
+}
+
+/**
+ * 确认消息接收
+ * 消息已经被确认过时返回false
+ */
+func (m *RedisStreamQueue) AckMsg(ctx context.Context, key string, token string) (bool, error) {
+	stream, id, ok := parseToken(token)
+	if !ok {
+		return false, errors.New("invalid token")
+	}
+	_, group := parseKey(key)
+	reply, err := m.client.Do("XACK", stream, group, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n > 0, nil
+}
+
+/**
+ * 认领一条超过可见性超时时间未ack的消息，认领后重新计算可见性超时时间
+ * 消息已经被裁剪时从pending列表中移除
+ */
+func (m *RedisStreamQueue) Reclaim(ctx context.Context, key string) (message string, token string, err error) {
+	streams, group := parseKey(key)
+	for i := len(streams) - 1; i >= 0; i-- {
+		message, token, err = m.reclaim(streams[i], group)
+		if err != nil || token != "" {
+			return
+		}
+	}
+	return
+}
+
+//距离上次没有认领到消息超过间隔时间时认领超时消息，认领到消息时下次出队继续认领
+func (m *RedisStreamQueue) tryReclaim(stream string, group string) (string, string, error) {
+	key := stream + "|" + group
+	now := time.Now()
+	m.reclaimLock.Lock()
+	last := m.reclaimAt[key]
+	m.reclaimLock.Unlock()
+	if now.Sub(last) < m.reclaimInterval {
+		return "", "", nil
+	}
+
+	message, token, err := m.reclaim(stream, group)
+	if err == nil && token == "" {
+		m.reclaimLock.Lock()
+		m.reclaimAt[key] = now
+		m.reclaimLock.Unlock()
+	}
+	return message, token, err
+}
+
+func (m *RedisStreamQueue) reclaim(stream string, group string) (string, string, error) {
+	if err := m.ensureGroup(stream, group); err != nil {
+		return "", "", err
+	}
+	minIdle := int64(m.visibilityTimeout / time.Millisecond)
+	reply, err := m.client.Do("EVAL", reclaimScript, 1, stream, group, m.consumer, minIdle, reclaimLimit)
+	if err != nil {
+		//stream被删除后消费组也随之删除，下次出队时重新创建，脚本中的错误信息带有前缀
+		if strings.Contains(err.Error(), "NOGROUP") {
+			m.groups.Delete(stream + "|" + group)
+		}
+		return "", "", err
+	}
+	if reply == nil {
+		return "", "", nil
+	}
+	entries := streamEntries([]interface{}{reply})
+	if len(entries) == 0 {
+		return "", "", nil
+	}
+	return entries[0].message, stream + "|" + entries[0].id, nil
+}
+
+/**
+ * 重放消息，将key的消费组的读取位置重置到start，不影响处理中的消息
+ * 订阅组的key只重置topic的stream，订阅组私有stream中的重试消息不会重放
+ * @param start "0"表示从stream中保留的最早的消息开始，消息id表示从该消息之后开始，"$"表示跳过全部未读取的消息
+ */
+func (m *RedisStreamQueue) Replay(ctx context.Context, key string, start string) error {
+	streams, group := parseKey(key)
+	if err := m.ensureGroup(streams[0], group); err != nil {
+		return err
+	}
+	_, err := m.client.Do("XGROUP", "SETID", streams[0], group, start)
+	return err
+}
+
+//重放since之后写入的消息
+func (m *RedisStreamQueue) ReplaySince(ctx context.Context, key string, since time.Time) error {
+	ms := since.UnixNano() / int64(time.Millisecond)
+	if ms <= 0 {
+		return m.Replay(ctx, key, "0")
+	}
+	//since前1毫秒的最后一条消息
+	return m.Replay(ctx, key, strconv.FormatInt(ms-1, 10)+"-18446744073709551615")
+}
+
+/**
+ * 队列消息数，为消费组未读取和处理中的消息数之和，订阅组的key包括topic的stream和订阅组私有的stream
+ * 没有通过消费组读取过的key按普通stream计算消息数，与Range、Remove一致，如订阅组的死信队列 <topic>#<group>.dlq
+ * Redis 7以下每个stream最多统计lenCountLimit条未读取的消息
+ */
+func (m *RedisStreamQueue) Len(ctx context.Context, key string) (int64, error) {
+	streams, group := parseKey(key)
+	var total int64
+	for i, stream := range streams {
+		n, ok, err := m.groupLen(stream, group)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			//topic的stream上没有该订阅组时key不是订阅组，不能计入topic的stream
+			if i == 0 && len(streams) > 1 {
+				return m.streamLen(key)
+			}
+			if n, err = m.streamLen(stream); err != nil {
+				return 0, err
+			}
+		}
+		total += n
+	}
+	return total, nil
+}
+
+//stream中消费组未读取和处理中的消息数，消费组不存在时返回false
+func (m *RedisStreamQueue) groupLen(stream string, group string) (int64, bool, error) {
+	reply, err := m.client.Do("XINFO", "GROUPS", stream)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	groups, _ := reply.([]interface{})
+	for _, g := range groups {
+		fields, _ := g.([]interface{})
+		info := make(map[string]interface{}, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			info[replyToString(fields[i])] = fields[i+1]
+		}
+		if replyToString(info["name"]) != group {
+			continue
+		}
+
+		pending, _ := info["pending"].(int64)
+		//Redis 7起entries-read已知时lag为准确的未读取消息数
+		lag, ok := info["lag"].(int64)
+		if _, known := info["entries-read"].(int64); ok && known {
+			return pending + lag, true, nil
+		}
+		n, err := m.countAfter(stream, replyToString(info["last-delivered-id"]))
+		if err != nil {
+			return 0, false, err
+		}
+		return pending + n, true, nil
+	}
+	return 0, false, nil
+}
+
+//stream中id之后的消息数，最多统计lenCountLimit条，用于不支持lag统计的Redis版本，避免遍历整个stream
+func (m *RedisStreamQueue) countAfter(stream string, id string) (int64, error) {
+	reply, err := m.client.Do("XRANGE", stream, nextId(id), "+", "COUNT", lenCountLimit)
+	if err != nil {
+		return 0, err
+	}
+	entries, _ := reply.([]interface{})
+	return int64(len(entries)), nil
+}
+
+//stream中保留的消息数
+func (m *RedisStreamQueue) streamLen(stream string) (int64, error) {
+	reply, err := m.client.Do("XLEN", stream)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return n, nil
+}
+
+/**
+ * 按位置查看key对应stream中保留的消息，包括已ack的消息，不会出队
+ * key按普通stream处理，订阅组的key查看订阅组私有的stream
+ */
+func (m *RedisStreamQueue) Range(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	params := []interface{}{key, "-", "+"}
+	if stop >= 0 {
+		params = append(params, "COUNT", stop+1)
+	}
+	reply, err := m.client.Do("XRANGE", params...)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := streamEntries(reply)
+	if start < 0 {
+		start = 0
+	}
+	messages := make([]string, 0, len(entries))
+	for i := int(start); i < len(entries); i++ {
+		messages = append(messages, entries[i].message)
+	}
+	return messages, nil
+}
+
+/**
+ * 从key对应的stream中移除一条消息
+ */
+func (m *RedisStreamQueue) Remove(ctx context.Context, key string, message string) (bool, error) {
+	start := "-"
+	for {
+		reply, err := m.client.Do("XRANGE", key, start, "+", "COUNT", reclaimLimit)
+		if err != nil {
+			return false, err
+		}
+		entries := streamEntries(reply)
+		for _, e := range entries {
+			if e.message == message {
+				reply, err := m.client.Do("XDEL", key, e.id)
+				n, _ := reply.(int64)
+				return n > 0, err
+			}
+		}
+		if len(entries) < reclaimLimit {
+			return false, nil
+		}
+		start = nextId(entries[len(entries)-1].id)
+	}
+}
+
+/**
+ * 清空key对应的stream和未到期的延迟消息，stream的消费组会一起删除
+ */
+func (m *RedisStreamQueue) Purge(ctx context.Context, key string) (bool, error) {
+	_, err := m.client.Del(key, key+delayedSuffix)
+	if err != nil {
+		return false, err
+	}
+	m.groups.Range(func(k, v interface{}) bool {
+		if strings.HasPrefix(k.(string), key+"|") {
+			m.groups.Delete(k)
+		}
+		return true
+	})
+	return true, nil
+}
+
+//从stream的消费组读取一条新消息
+func (m *RedisStreamQueue) readGroup(stream string, group string) (string, string, error) {
+	if err := m.ensureGroup(stream, group); err != nil {
+		return "", "", err
+	}
+	reply, err := m.client.Do("XREADGROUP", "GROUP", group, m.consumer, "COUNT", 1, "STREAMS", stream, ">")
+	if err != nil {
+		//stream被删除后消费组也随之删除，下次出队时重新创建
+		if strings.HasPrefix(err.Error(), "NOGROUP") {
+			m.groups.Delete(stream + "|" + group)
+		}
+		return "", "", err
+	}
+
+	//返回值为 [[stream, entries]]，没有新消息时为nil
+	arr, _ := reply.([]interface{})
+	if len(arr) == 0 {
+		return "", "", nil
+	}
+	s, _ := arr[0].([]interface{})
+	if len(s) != 2 {
+		return "", "", nil
+	}
+	entries := streamEntries(s[1])
+	if len(entries) == 0 {
+		return "", "", nil
+	}
+	return entries[0].message, stream + "|" + entries[0].id, nil
+}
+
+//消费组不存在时创建
+func (m *RedisStreamQueue) ensureGroup(stream string, group string) error {
+	key := stream + "|" + group
+	if _, ok := m.groups.Load(key); ok {
+		return nil
+	}
+
+	start := "0"
+	if m.startFromLatest {
+		start = "$"
+	}
+	_, err := m.client.Do("XGROUP", "CREATE", stream, group, start, "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	m.groups.Store(key, struct{}{})
+	return nil
+}
+
+//将到期的延迟消息写入stream
+func (m *RedisStreamQueue) promote(streams []string) error {
+	params := make([]interface{}, 0, len(streams)*2+5)
+	params = append(params, promoteScript, len(streams)*2)
+	for _, stream := range streams {
+		params = append(params, stream+delayedSuffix, stream)
+	}
+	params = append(params, utils.GetCurrentMilliTime(), promoteLimit, m.maxLen)
+	_, err := m.client.Do("EVAL", params...)
+	return err
+}
+
+//延迟消息写入有序集合，score为到期的毫秒时间戳，出队时再写入stream
+func (m *RedisStreamQueue) enqueueDelayed(key string, messages []string, delay int64) (bool, error) {
+	score := utils.GetCurrentMilliTime() + delay*1000
+	pairs := make([]interface{}, 0, len(messages)*2)
+	for _, message := range messages {
+		pairs = append(pairs, score, utils.GenUUID()+"|"+message)
+	}
+	_, err := m.client.ZAdd(key+delayedSuffix, pairs...)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//key读取的stream和使用的消费组，订阅组的key依次为topic的stream和订阅组私有的stream
+func parseKey(key string) (streams []string, group string) {
+	i := strings.Index(key, work.SubscriptionSeparator)
+	if i <= 0 || i == len(key)-1 {
+		return []string{key}, DefaultGroup
+	}
+	return []string{key[:i], key}, key[i+1:]
+}
+
+//从token中解析stream和entry id，token格式为 <stream>|<entry id>
+func parseToken(token string) (stream string, id string, ok bool) {
+	i := strings.LastIndex(token, "|")
+	if i <= 0 || i == len(token)-1 {
+		return "", "", false
+	}
+	return token[:i], token[i+1:], true
+}
+
+//id之后的下一个消息id，id格式为 <毫秒时间戳>-<序号>
+func nextId(id string) string {
+	i := strings.Index(id, "-")
+	if i <= 0 {
+		return id
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return id
+	}
+	if seq < 1<<64-1 {
+		return id[:i] + "-" + strconv.FormatUint(seq+1, 10)
+	}
+	ms, _ := strconv.ParseUint(id[:i], 10, 64)
+	return strconv.FormatUint(ms+1, 10) + "-0"
+}
+
+//stream中的一条消息
+type entry struct {
+	id      string
+	message string
+}
+
+//解析消息列表，格式为 [[id, [field, value, ...]], ...]
+func streamEntries(reply interface{}) []entry {
+	arr, _ := reply.([]interface{})
+	entries := make([]entry, 0, len(arr))
+	for _, item := range arr {
+		e, ok := item.([]interface{})
+		if !ok || len(e) != 2 {
+			continue
+		}
+		fields, _ := e[1].([]interface{})
+		var message string
+		for i := 0; i+1 < len(fields); i += 2 {
+			if replyToString(fields[i]) == messageField {
+				message = replyToString(fields[i+1])
+			}
+		}
+		entries = append(entries, entry{id: replyToString(e[0]), message: message})
+	}
+	return entries
+}
+
+//redis返回值转换为字符串，nil时返回空字符串
+func replyToString(reply interface{}) string {
+	switch v := reply.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+func init() {
+	mp = make(map[string]queue.Queue)
+	queue.Register(queue.DriverTypeRedisStream, GetRedisStreamQueue)
+}
@@ -0,0 +1,393 @@
+package redisstreamqueue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"github.com/qit-team/snow-core/config"
+	"github.com/qit-team/snow-core/queue"
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/work"
+)
+
+var (
+	_ work.BrowsableQueue  = &RedisStreamQueue{}
+	_ work.PubSubQueue     = &RedisStreamQueue{}
+	_ work.VisibilityQueue = &RedisStreamQueue{}
+)
+
+func init() {
+	redisConf := config.RedisConfig{
+		Master: config.RedisBaseConfig{
+			Host: "127.0.0.1",
+			Port: 6379,
+		},
+	}
+
+	//注册redis类
+	err := redis.Pr.Register("redis", redisConf, true)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+//清理stream、延迟消息和已创建消费组的缓存
+func reset(q queue.Queue, keys ...string) {
+	m := q.(*RedisStreamQueue)
+	for _, key := range keys {
+		redis.GetRedis("redis").Del(key, key+delayedSuffix)
+	}
+	m.groups.Range(func(k, v interface{}) bool {
+		m.groups.Delete(k)
+		return true
+	})
+}
+
+func TestEnqueue(t *testing.T) {
+	q := queue.GetQueue("redis", queue.DriverTypeRedisStream)
+	ctx := context.TODO()
+	topic := "snow-stream-one"
+	reset(q, topic)
+
+	ok, err := q.BatchEnqueue(ctx, topic, []string{"1", "2"})
+	if err != nil || !ok {
+		t.Error("enqueue error", err)
+		return
+	}
+
+	for _, msg := range []string{"1", "2"} {
+		message, token, err := q.Dequeue(ctx, topic)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if message != msg {
+			t.Errorf("message is not same %s", message)
+			return
+		}
+		ok, err = q.AckMsg(ctx, topic, token)
+		if err != nil || !ok {
+			t.Error("ack error", err)
+			return
+		}
+		ok, _ = q.AckMsg(ctx, topic, token)
+		if ok {
+			t.Error("message must not be acked twice")
+			return
+		}
+	}
+
+	message, token, err := q.Dequeue(ctx, topic)
+	if err != nil || message != "" || token != "" {
+		t.Error("queue must be empty", message, err)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	q := queue.GetQueue("redis", queue.DriverTypeRedisStream)
+	ctx := context.TODO()
+	topic := "snow-stream-event"
+	notify := topic + work.SubscriptionSeparator + "notify"
+	stats := topic + work.SubscriptionSeparator + "stats"
+	reset(q, topic, notify, stats)
+
+	ok, err := q.(work.PubSubQueue).Publish(ctx, topic, "login")
+	if err != nil || !ok {
+		t.Error("publish error", err)
+		return
+	}
+
+	//每个订阅组都收到消息
+	for _, key := range []string{notify, stats} {
+		message, token, err := q.Dequeue(ctx, key)
+		if err != nil || message != "login" {
+			t.Error("subscriber must receive the message", key, message, err)
+			return
+		}
+		if ok, _ := q.AckMsg(ctx, key, token); !ok {
+			t.Error("ack error", key)
+			return
+		}
+	}
+
+	//写入订阅组key的消息只投递给该订阅组
+	q.Enqueue(ctx, notify, "retry")
+	message, token, _ := q.Dequeue(ctx, notify)
+	if message != "retry" {
+		t.Error("retry message must be delivered to its group", message)
+		return
+	}
+	q.AckMsg(ctx, notify, token)
+	message, _, _ = q.Dequeue(ctx, stats)
+	if message != "" {
+		t.Error("retry message must not be delivered to other groups", message)
+	}
+}
+
+func TestEnqueue_delay(t *testing.T) {
+	q := queue.GetQueue("redis", queue.DriverTypeRedisStream)
+	ctx := context.TODO()
+	topic := "snow-stream-delay"
+	reset(q, topic)
+
+	q.Enqueue(ctx, topic, "delay", int64(1))
+	message, _, _ := q.Dequeue(ctx, topic)
+	if message != "" {
+		t.Error("delayed message must not be dequeued before due", message)
+		return
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	message, token, err := q.Dequeue(ctx, topic)
+	if err != nil || message != "delay" {
+		t.Error("delayed message must be dequeued after due", message, err)
+		return
+	}
+	q.AckMsg(ctx, topic, token)
+}
+
+func TestParseKey(t *testing.T) {
+	streams, group := parseKey("user-login#points")
+	if len(streams) != 2 || streams[0] != "user-login" || streams[1] != "user-login#points" || group != "points" {
+		t.Error("parse subscription key error", streams, group)
+	}
+	streams, group = parseKey("user-login")
+	if len(streams) != 1 || streams[0] != "user-login" || group != DefaultGroup {
+		t.Error("parse key error", streams, group)
+	}
+}
+
+func TestReclaim(t *testing.T) {
+	ctx := context.TODO()
+	topic := "snow-stream-reclaim"
+	a := newRedisStreamQueue("redis").(*RedisStreamQueue)
+	a.SetConsumer("a")
+	b := newRedisStreamQueue("redis").(*RedisStreamQueue)
+	b.SetConsumer("b")
+	b.SetVisibilityTimeout(100 * time.Millisecond)
+	b.SetReclaimInterval(0)
+	reset(a, topic)
+
+	a.Enqueue(ctx, topic, "1")
+	message, _, _ := a.Dequeue(ctx, topic)
+	if message != "1" {
+		t.Error("dequeue error", message)
+		return
+	}
+
+	//未超过可见性超时时间时不会被认领
+	message, _, _ = b.Dequeue(ctx, topic)
+	if message != "" {
+		t.Error("message must not be reclaimed before visibility timeout", message)
+		return
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	message, token, err := b.Dequeue(ctx, topic)
+	if err != nil || message != "1" {
+		t.Error("message must be reclaimed after visibility timeout", message, err)
+		return
+	}
+	ok, _ := b.AckMsg(ctx, topic, token)
+	if !ok {
+		t.Error("reclaimed message must be acked")
+		return
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	message, _, _ = b.Dequeue(ctx, topic)
+	if message != "" {
+		t.Error("acked message must not be reclaimed", message)
+	}
+}
+
+func TestReclaim_noGroup(t *testing.T) {
+	ctx := context.TODO()
+	topic := "snow-stream-reclaim-nogroup"
+	q := newRedisStreamQueue("redis").(*RedisStreamQueue)
+	reset(q, topic)
+
+	q.Enqueue(ctx, topic, "1")
+	q.Dequeue(ctx, topic)
+	//stream被删除后认领失败，并清除消费组的缓存
+	redis.GetRedis("redis").Del(topic)
+	if _, _, err := q.reclaim(topic, DefaultGroup); err == nil {
+		t.Error("reclaim must fail without group")
+		return
+	}
+	if _, ok := q.groups.Load(topic + "|" + DefaultGroup); ok {
+		t.Error("group cache must be dropped on NOGROUP")
+		return
+	}
+	if _, _, err := q.reclaim(topic, DefaultGroup); err != nil {
+		t.Error("group must be created again", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	q := queue.GetQueue("redis", queue.DriverTypeRedisStream).(*RedisStreamQueue)
+	ctx := context.TODO()
+	topic := "snow-stream-replay"
+	reset(q, topic)
+
+	q.Enqueue(ctx, topic, "1")
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now()
+	q.Enqueue(ctx, topic, "2")
+	for i := 0; i < 2; i++ {
+		_, token, _ := q.Dequeue(ctx, topic)
+		q.AckMsg(ctx, topic, token)
+	}
+
+	err := q.Replay(ctx, topic, "0")
+	if err != nil && strings.Contains(err.Error(), "not supported") {
+		t.Skip("XGROUP SETID is not supported by the redis server")
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	message, token, _ := q.Dequeue(ctx, topic)
+	if message != "1" {
+		t.Error("replay must start from the first message", message)
+		return
+	}
+	q.AckMsg(ctx, topic, token)
+
+	q.ReplaySince(ctx, topic, since)
+	message, token, _ = q.Dequeue(ctx, topic)
+	if message != "2" {
+		t.Error("replay must start from the message after since", message)
+		return
+	}
+	q.AckMsg(ctx, topic, token)
+}
+
+func TestBrowse(t *testing.T) {
+	q := queue.GetQueue("redis", queue.DriverTypeRedisStream).(*RedisStreamQueue)
+	ctx := context.TODO()
+	topic := "snow-stream-browse"
+	reset(q, topic)
+
+	q.BatchEnqueue(ctx, topic, []string{"1", "2", "3"})
+	n, err := q.Len(ctx, topic)
+	if err != nil || n != 3 {
+		t.Error("len error", n, err)
+		return
+	}
+
+	//处理中和未读取的消息都计入，已ack的不计入
+	_, token, _ := q.Dequeue(ctx, topic)
+	q.AckMsg(ctx, topic, token)
+	q.Dequeue(ctx, topic)
+	if n, _ = q.Len(ctx, topic); n != 2 {
+		t.Error("len must count pending and unread messages", n)
+		return
+	}
+
+	messages, err := q.Range(ctx, topic, 1, 2)
+	if err != nil || len(messages) != 2 || messages[0] != "2" || messages[1] != "3" {
+		t.Error("range error", messages, err)
+		return
+	}
+
+	ok, err := q.Remove(ctx, topic, "2")
+	if err != nil || !ok {
+		t.Error("remove error", err)
+		return
+	}
+	if messages, _ = q.Range(ctx, topic, 0, -1); len(messages) != 2 {
+		t.Error("message must be removed", messages)
+		return
+	}
+
+	q.Purge(ctx, topic)
+	if n, _ = q.Len(ctx, topic); n != 0 {
+		t.Error("queue must be purged", n)
+	}
+}
+
+func TestCountAfter(t *testing.T) {
+	ctx := context.TODO()
+	topic := "snow-stream-count"
+	q := newRedisStreamQueue("redis").(*RedisStreamQueue)
+	reset(q, topic)
+
+	messages := make([]string, lenCountLimit+10)
+	for i := range messages {
+		messages[i] = fmt.Sprint(i)
+	}
+	q.BatchEnqueue(ctx, topic, messages)
+	n, err := q.countAfter(topic, "0-0")
+	if err != nil || n != lenCountLimit {
+		t.Error("count must be capped by lenCountLimit", n, err)
+		return
+	}
+
+	//id之后不足lenCountLimit条时按实际消息数统计
+	reply, _ := q.client.Do("XREVRANGE", topic, "+", "-", "COUNT", 3)
+	entries := streamEntries(reply)
+	if len(entries) != 3 {
+		t.Error("xrevrange error", entries)
+		return
+	}
+	if n, _ = q.countAfter(topic, entries[2].id); n != 2 {
+		t.Error("count after id error", n)
+	}
+}
+
+func TestBrowse_deadLetter(t *testing.T) {
+	q := queue.GetQueue("redis", queue.DriverTypeRedisStream).(*RedisStreamQueue)
+	ctx := context.TODO()
+	topic := "snow-stream-browse-event"
+	notify := topic + work.SubscriptionSeparator + "notify"
+	dlq := notify + ".dlq"
+	reset(q, topic, notify, dlq)
+
+	q.Publish(ctx, topic, "login")
+	q.Publish(ctx, topic, "logout")
+	q.Enqueue(ctx, dlq, "dead")
+
+	//订阅组的死信队列没有消费组，按普通stream计算，不计入topic的消息
+	n, err := q.Len(ctx, dlq)
+	if err != nil || n != 1 {
+		t.Error("dead letter len error", n, err)
+		return
+	}
+	messages, err := q.Range(ctx, dlq, 0, -1)
+	if err != nil || len(messages) != 1 || messages[0] != "dead" {
+		t.Error("dead letter range error", messages, err)
+		return
+	}
+
+	//订阅组消费后计入topic的stream
+	q.Dequeue(ctx, notify)
+	if n, _ = q.Len(ctx, notify); n != 2 {
+		t.Error("subscription len must count the topic stream", n)
+		return
+	}
+	if n, _ = q.Len(ctx, dlq); n != 1 {
+		t.Error("dead letter len must not change after the group is created", n)
+		return
+	}
+
+	ok, err := q.Remove(ctx, dlq, "dead")
+	if err != nil || !ok {
+		t.Error("dead letter remove error", err)
+		return
+	}
+	if n, _ = q.Len(ctx, dlq); n != 0 {
+		t.Error("dead letter must be removed", n)
+	}
+}
+
+func TestNextId(t *testing.T) {
+	if id := nextId("1700000000000-5"); id != "1700000000000-6" {
+		t.Error("next id error", id)
+	}
+	if id := nextId("1700000000000-18446744073709551615"); id != "1700000000001-0" {
+		t.Error("next id error", id)
+	}
+}
@@ -0,0 +1,56 @@
+package redisstreamqueue
+
+//Redis 5在脚本中先执行XADD等非确定性命令再写入时需要开启按效果复制，Redis 7起为默认行为
+
+//将到期的延迟消息写入stream，延迟消息成员格式为"uuid|message"，写入时去掉37位的前缀
+//KEYS[2i-1] 第i个延迟消息有序集合key KEYS[2i] 第i个stream key
+//ARGV[1] 当前毫秒时间戳 ARGV[2] 单次转移上限 ARGV[3] stream保留的消息数，小于等于0时不裁剪
+const promoteScript = `
+redis.replicate_commands()
+local n = 0
+for i = 1, #KEYS / 2 do
+	local items = redis.call('ZRANGEBYSCORE', KEYS[i * 2 - 1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+	for _, item in ipairs(items) do
+		if tonumber(ARGV[3]) > 0 then
+			redis.call('XADD', KEYS[i * 2], 'MAXLEN', '~', ARGV[3], '*', 'm', string.sub(item, 38))
+		else
+			redis.call('XADD', KEYS[i * 2], '*', 'm', string.sub(item, 38))
+		end
+		redis.call('ZREM', KEYS[i * 2 - 1], item)
+		n = n + 1
+	end
+end
+return n
+`
+
+//批量写入stream
+//KEYS[1] stream key ARGV[1] stream保留的消息数，小于等于0时不裁剪 ARGV[2..] 消息
+const batchAddScript = `
+redis.replicate_commands()
+for i = 2, #ARGV do
+	if tonumber(ARGV[1]) > 0 then
+		redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'm', ARGV[i])
+	else
+		redis.call('XADD', KEYS[1], '*', 'm', ARGV[i])
+	end
+end
+return #ARGV - 1
+`
+
+//认领空闲超过可见性超时时间的pending消息，返回认领到的第一条消息，效果同XAUTOCLAIM，兼容Redis 5
+//已被裁剪的消息无法认领，直接从pending列表移除
+//KEYS[1] stream key
+//ARGV[1] 消费组 ARGV[2] 消费者 ARGV[3] 最小空闲毫秒数 ARGV[4] 单次检查的pending消息数
+const reclaimScript = `
+local pending = redis.call('XPENDING', KEYS[1], ARGV[1], '-', '+', ARGV[4])
+for _, p in ipairs(pending) do
+	if tonumber(p[3]) >= tonumber(ARGV[3]) then
+		local claimed = redis.call('XCLAIM', KEYS[1], ARGV[1], ARGV[2], ARGV[3], p[1])
+		if type(claimed[1]) == 'table' then
+			return claimed[1]
+		end
+		redis.call('XACK', KEYS[1], ARGV[1], p[1])
+	end
+end
+return false
+`
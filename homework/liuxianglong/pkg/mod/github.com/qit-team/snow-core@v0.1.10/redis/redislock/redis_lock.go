@@ -0,0 +1,174 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	redis_pool "github.com/hetiansu5/go-redis-pool"
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/snow-core/utils"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//锁key的前缀，完整key为 <prefix><name>，fencing token的key为 <prefix><name>:fence
+const keyPrefix = "snow:lock:"
+
+var ErrNotAcquired = errors.New("lock is held by others")
+
+/**
+ * 获取锁，获取成功时递增并返回fencing token
+ * KEYS[1] 锁key KEYS[2] fencing token的key
+ * ARGV[1] 锁的值 ARGV[2] 过期时间(毫秒)
+ * @return 0表示锁被其他实例持有
+ */
+const lockScript = `
+if redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2], 'NX') then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`
+
+/**
+ * 持有锁时续期，d为0时删除锁
+ * KEYS[1] 锁key
+ * ARGV[1] 锁的值 ARGV[2] 过期时间(毫秒)
+ * @return 0表示锁已经不属于当前持有者
+ */
+const expireScript = `
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[2]) <= 0 then
+	return redis.call('DEL', KEYS[1])
+end
+return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+`
+
+//分布式锁，相同名称的锁在多个进程间互斥
+type Locker struct {
+	client *redis_pool.ReplicaPool
+	key    string
+	ttl    time.Duration
+}
+
+/**
+ * 生成分布式锁
+ * @param diName redis实例名
+ * @param name 锁名称
+ * @param ttl 锁的过期时间，持有期间按ttl/3的间隔续期，小于1秒时按1秒处理
+ */
+func New(diName string, name string, ttl time.Duration) *Locker {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	return &Locker{
+		client: redis.GetRedis(diName).WithMaster(),
+		key:    keyPrefix + name,
+		ttl:    ttl,
+	}
+}
+
+/**
+ * 尝试获取锁，锁被其他实例持有时返回ErrNotAcquired
+ * 获取成功后会自动续期，直到调用Unlock或者续期失败
+ */
+func (l *Locker) TryLock(ctx context.Context) (*Lock, error) {
+	value := utils.GenUUID()
+	reply, err := l.client.Do("EVAL", lockScript, 2, l.key, l.key+":fence", value, ms(l.ttl))
+	if err != nil {
+		return nil, err
+	}
+	token, _ := reply.(int64)
+	if token == 0 {
+		return nil, ErrNotAcquired
+	}
+
+	lock := &Lock{
+		locker: l,
+		value:  value,
+		Token:  token,
+		stop:   make(chan struct{}),
+		lost:   make(chan struct{}),
+	}
+	go lock.renew()
+	return lock, nil
+}
+
+//已获取的锁
+type Lock struct {
+	locker *Locker
+	value  string
+	//fencing token，每次获取锁时单调递增，写入外部资源时可以用来拒绝过期持有者的写入
+	Token int64
+
+	once sync.Once
+	stop chan struct{}
+	lost chan struct{}
+}
+
+//锁丢失(续期失败或者被删除)时关闭的通道
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+//释放锁
+func (l *Lock) Unlock() error {
+	return l.UnlockAfter(0)
+}
+
+/**
+ * 停止续期，锁在d时长后过期，d小于等于0时立即释放
+ * 用于保证ttl内只执行一次：任务提前完成时继续占用锁到ttl
+ */
+func (l *Lock) UnlockAfter(d time.Duration) error {
+	l.once.Do(func() {
+		close(l.stop)
+	})
+	_, err := l.expire(d)
+	return err
+}
+
+//按ttl/3的间隔续期，锁已经不属于当前持有者或者超过ttl未续期成功时停止
+func (l *Lock) renew() {
+	ticker := time.NewTicker(l.locker.ttl / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			start := time.Now()
+			ok, err := l.expire(l.locker.ttl)
+			if err == nil && ok {
+				renewed = start
+				continue
+			}
+			//网络异常时继续重试，超过ttl仍未续期成功时认为锁已丢失
+			if err != nil && time.Since(renewed) < l.locker.ttl {
+				continue
+			}
+			close(l.lost)
+			return
+		}
+	}
+}
+
+func (l *Lock) expire(d time.Duration) (bool, error) {
+	reply, err := l.locker.client.Do("EVAL", expireScript, 1, l.locker.key, l.value, ms(d))
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n == 1, nil
+}
+
+//转换为毫秒，d大于0时至少为1毫秒
+func ms(d time.Duration) string {
+	n := int64(d / time.Millisecond)
+	if d > 0 && n == 0 {
+		n = 1
+	}
+	return strconv.FormatInt(n, 10)
+}
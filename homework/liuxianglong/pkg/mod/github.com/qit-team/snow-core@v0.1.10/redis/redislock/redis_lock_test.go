@@ -0,0 +1,111 @@
+package redislock
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"github.com/qit-team/snow-core/config"
+	"github.com/qit-team/snow-core/redis"
+)
+
+func init() {
+	redisConf := config.RedisConfig{
+		Master: config.RedisBaseConfig{
+			Host: "127.0.0.1",
+			Port: 6379,
+		},
+	}
+
+	//注册redis类
+	err := redis.Pr.Register("redis", redisConf, true)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func TestTryLock(t *testing.T) {
+	ctx := context.TODO()
+	l := New("redis", "test-try-lock", time.Second)
+	redis.GetRedis("redis").Del(l.key)
+
+	lock, err := l.TryLock(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = l.TryLock(ctx)
+	if err != ErrNotAcquired {
+		t.Error("lock must not be acquired twice", err)
+		return
+	}
+
+	err = lock.Unlock()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	lock2, err := l.TryLock(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer lock2.Unlock()
+	if lock2.Token <= lock.Token {
+		t.Error("fencing token must increase", lock.Token, lock2.Token)
+	}
+}
+
+func TestLock_renew(t *testing.T) {
+	ctx := context.TODO()
+	l := New("redis", "test-renew-lock", time.Second)
+	redis.GetRedis("redis").Del(l.key)
+
+	lock, err := l.TryLock(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	//超过ttl后锁仍被持有
+	time.Sleep(time.Millisecond * 1500)
+	_, err = l.TryLock(ctx)
+	if err != ErrNotAcquired {
+		t.Error("lock must be renewed", err)
+		return
+	}
+
+	//锁被删除后通知持有者
+	redis.GetRedis("redis").Del(l.key)
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Error("lost must be closed after the lock is deleted")
+	}
+}
+
+func TestLock_UnlockAfter(t *testing.T) {
+	ctx := context.TODO()
+	l := New("redis", "test-unlock-after", time.Second*10)
+	redis.GetRedis("redis").Del(l.key)
+
+	lock, err := l.TryLock(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	lock.UnlockAfter(time.Millisecond * 200)
+	_, err = l.TryLock(ctx)
+	if err != ErrNotAcquired {
+		t.Error("lock must be held until expired", err)
+		return
+	}
+
+	time.Sleep(time.Millisecond * 300)
+	lock, err = l.TryLock(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	lock.Unlock()
+}
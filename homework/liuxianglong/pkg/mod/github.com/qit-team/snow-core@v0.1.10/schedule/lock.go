@@ -0,0 +1,70 @@
+package schedule
+
+import (
+	"context"
+	"github.com/qit-team/snow-core/log/logger"
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/snow-core/redis/redislock"
+	"github.com/robfig/cron"
+	"time"
+)
+
+type fencingTokenKey struct{}
+
+//获取执行加锁任务时的fencing token，写入外部资源时可以用来拒绝过期持有者的写入
+func FencingToken(ctx context.Context) (int64, bool) {
+	token, ok := ctx.Value(fencingTokenKey{}).(int64)
+	return token, ok
+}
+
+/**
+ * 注册加分布式锁的cron任务，多个cron实例中只有获取到锁的实例执行，其他实例跳过并记录日志
+ * 执行期间锁会自动续期，锁丢失时取消ctx；执行完成后锁保留到ttl，ttl内其他实例不会重复执行，ttl应小于执行间隔
+ * 任务以锁名称注册，可以通过History查询执行记录
+ * @param spec cron表达式，同cron.AddFunc
+ * @param name 锁名称
+ * @param ttl 锁的过期时间
+ * @param cmd 执行函数，ctx中携带fencing token
+ * @param diName redis实例名，可选，默认为redis的默认实例
+ */
+func AddLockedFunc(c *cron.Cron, spec string, name string, ttl time.Duration, cmd func(ctx context.Context) error, diName ...string) error {
+	dn := redis.SingletonMain
+	if len(diName) > 0 {
+		dn = diName[0]
+	}
+	l := redislock.New(dn, name, ttl)
+	return AddFunc(c, name, spec, func(ctx context.Context) error {
+		return runLocked(ctx, l, name, ttl, cmd)
+	})
+}
+
+//获取锁后执行，锁被其他实例持有时返回ErrSkipped
+func runLocked(ctx context.Context, l *redislock.Locker, name string, ttl time.Duration, cmd func(ctx context.Context) error) error {
+	lock, err := l.TryLock(ctx)
+	if err == redislock.ErrNotAcquired {
+		logger.Info(ctx, "cron_lock_skip", logger.NewWithField("cron", name), "lock is held by another instance")
+		return ErrSkipped
+	} else if err != nil {
+		logger.Error(ctx, "cron_lock_error", logger.NewWithField("cron", name), err.Error())
+		return err
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, fencingTokenKey{}, lock.Token))
+	defer cancel()
+	go func() {
+		select {
+		case <-lock.Lost():
+			logger.Warn(ctx, "cron_lock_lost", logger.NewWithField("cron", name), logger.NewWithField("token", lock.Token), "lock is lost")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	defer func() {
+		if err := lock.UnlockAfter(ttl - time.Since(start)); err != nil {
+			logger.Error(ctx, "cron_unlock_error", logger.NewWithField("cron", name), err.Error())
+		}
+	}()
+
+	return cmd(ctx)
+}
@@ -0,0 +1,58 @@
+package schedule
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/snow-core/redis/redislock"
+	"github.com/robfig/cron"
+)
+
+func TestAddLockedFunc(t *testing.T) {
+	redis.GetRedis("redis").Del("snow:lock:test-locked-func")
+
+	var (
+		mu     sync.Mutex
+		tokens []int64
+	)
+	cmd := func(ctx context.Context) error {
+		token, ok := FencingToken(ctx)
+		if !ok {
+			t.Error("fencing token must be in ctx")
+		}
+		mu.Lock()
+		tokens = append(tokens, token)
+		mu.Unlock()
+		time.Sleep(time.Millisecond * 100)
+		return nil
+	}
+
+	//两个cron实例同一时刻触发，只有一个实例执行
+	c1 := cron.New()
+	c2 := cron.New()
+	//同一进程内任务名称需要唯一，模拟两个实例时使用同名的锁分别注册
+	AddLockedFunc(c1, "* * * * * *", "test-locked-func", time.Millisecond*900, cmd, "redis")
+	c2.AddFunc("* * * * * *", func() {
+		runLocked(context.Background(), redislock.New("redis", "test-locked-func", time.Millisecond*900), "test-locked-func", time.Millisecond*900, cmd)
+	})
+	c1.Start()
+	c2.Start()
+	time.Sleep(time.Millisecond * 2500)
+	c1.Stop()
+	c2.Stop()
+	time.Sleep(time.Millisecond * 200)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(tokens) < 2 || len(tokens) > 3 {
+		t.Error("locked func must run once per tick", tokens)
+		return
+	}
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i] <= tokens[i-1] {
+			t.Error("fencing token must increase", tokens)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qit-team/snow-core/log/logger"
+	"github.com/robfig/cron"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//默认保留的执行记录数
+const defaultHistorySize = 20
+
+//执行结果
+const (
+	OutcomeSucceed = "succeed"
+	OutcomeFailed  = "failed"
+	OutcomePanic   = "panic"
+	//上一次执行未结束或者未获取到锁，本次跳过
+	OutcomeSkipped = "skipped"
+)
+
+var (
+	//执行函数返回ErrSkipped时记为跳过
+	ErrSkipped        = errors.New("skipped")
+	ErrNameRegistered = errors.New("the name had been registered")
+)
+
+//上一次执行未结束时跳过本次执行，作为AddFunc的可选参数使用
+type SkipIfRunning bool
+
+//保留的执行记录数，作为AddFunc的可选参数使用
+type HistorySize int
+
+//一次执行的记录
+type Run struct {
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Outcome  string        `json:"outcome"`
+	Error    string        `json:"error,omitempty"`
+}
+
+//注册的cron任务
+type entry struct {
+	name          string
+	cmd           func(ctx context.Context) error
+	skipIfRunning bool
+	historySize   int
+	//执行中的数量
+	running int32
+
+	mu      sync.Mutex
+	history []Run
+}
+
+var (
+	entries = make(map[string]*entry)
+	eLock   sync.RWMutex
+)
+
+/**
+ * 注册cron任务，执行时会recover panic、记录耗时和结果日志，并保留最近的执行记录
+ * @param name 任务名称，全局唯一，用于查询执行记录
+ * @param spec cron表达式，同cron.AddFunc
+ * @param cmd 执行函数，ctx在Shutdown等待超时后取消，返回ErrSkipped时记为跳过
+ * @param args 可选参数按类型识别：SkipIfRunning为上一次执行未结束时是否跳过，HistorySize为保留的执行记录数，默认20
+ */
+func AddFunc(c *cron.Cron, name string, spec string, cmd func(ctx context.Context) error, args ...interface{}) error {
+	e := &entry{name: name, cmd: cmd, historySize: defaultHistorySize}
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case SkipIfRunning:
+			e.skipIfRunning = bool(v)
+		case HistorySize:
+			if v > 0 {
+				e.historySize = int(v)
+			}
+		}
+	}
+
+	sched, err := cron.Parse(spec)
+	if err != nil {
+		return err
+	}
+
+	eLock.Lock()
+	if _, ok := entries[name]; ok {
+		eLock.Unlock()
+		return ErrNameRegistered
+	}
+	entries[name] = e
+	eLock.Unlock()
+
+	c.Schedule(sched, cron.FuncJob(e.run))
+	return nil
+}
+
+//已注册的任务名称
+func Names() []string {
+	eLock.RLock()
+	defer eLock.RUnlock()
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	return names
+}
+
+//任务最近的执行记录，按时间倒序
+func History(name string) []Run {
+	eLock.RLock()
+	e, ok := entries[name]
+	eLock.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	runs := make([]Run, len(e.history))
+	for k, run := range e.history {
+		runs[len(e.history)-1-k] = run
+	}
+	return runs
+}
+
+//执行一次任务
+func (e *entry) run() {
+	start := time.Now()
+	if e.skipIfRunning {
+		if !atomic.CompareAndSwapInt32(&e.running, 0, 1) {
+			logger.Warn(context.Background(), "cron_skip", logger.NewWithField("cron", e.name), "previous run is still in process")
+			e.record(Run{Name: e.name, Start: start, Outcome: OutcomeSkipped, Error: "previous run is still in process"})
+			return
+		}
+	} else {
+		atomic.AddInt32(&e.running, 1)
+	}
+
+	run := Run{Name: e.name, Start: start}
+	ctx, untrack := track(run)
+	defer func() {
+		untrack()
+		atomic.AddInt32(&e.running, -1)
+		if r := recover(); r != nil {
+			buf := make([]byte, 64<<10)
+			buf = buf[:runtime.Stack(buf, false)]
+			run.Outcome = OutcomePanic
+			run.Error = fmt.Sprint(r)
+			logger.Error(ctx, "cron_panic", logger.NewWithField("cron", e.name), logger.NewWithField("stack", string(buf)), run.Error)
+		}
+		run.Duration = time.Since(start)
+		e.record(run)
+		if run.Outcome != OutcomePanic {
+			logger.Info(ctx, "cron_run", logger.NewWithField("cron", e.name), logger.NewWithField("outcome", run.Outcome),
+				logger.NewWithField("duration", run.Duration.String()), run.Error)
+		}
+	}()
+
+	err := e.cmd(ctx)
+	switch {
+	case err == nil:
+		run.Outcome = OutcomeSucceed
+	case err == ErrSkipped:
+		run.Outcome = OutcomeSkipped
+	default:
+		run.Outcome = OutcomeFailed
+		run.Error = err.Error()
+	}
+}
+
+//保留最近historySize条执行记录
+func (e *entry) record(run Run) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.history = append(e.history, run)
+	if len(e.history) > e.historySize {
+		e.history = e.history[len(e.history)-e.historySize:]
+	}
+}
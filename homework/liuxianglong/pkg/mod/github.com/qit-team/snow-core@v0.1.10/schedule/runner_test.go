@@ -0,0 +1,94 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"github.com/robfig/cron"
+)
+
+func TestAddFunc(t *testing.T) {
+	c := cron.New()
+	err := AddFunc(c, "test-add-func", "@every 1s", func(ctx context.Context) error {
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = AddFunc(c, "test-add-func", "@every 1s", func(ctx context.Context) error {
+		return nil
+	})
+	if err != ErrNameRegistered {
+		t.Error("duplicate name must be rejected", err)
+	}
+	err = AddFunc(c, "test-add-func-spec", "bad spec", func(ctx context.Context) error {
+		return nil
+	})
+	if err == nil {
+		t.Error("invalid spec must be rejected")
+	}
+}
+
+func TestEntry_run(t *testing.T) {
+	calls := 0
+	AddFunc(cron.New(), "test-entry-run", "@every 1s", func(ctx context.Context) error {
+		calls++
+		switch calls {
+		case 1:
+			return nil
+		case 2:
+			return errors.New("failed")
+		case 3:
+			return ErrSkipped
+		default:
+			panic("boom")
+		}
+	}, HistorySize(3))
+
+	eLock.RLock()
+	e := entries["test-entry-run"]
+	eLock.RUnlock()
+	for i := 0; i < 4; i++ {
+		e.run()
+	}
+
+	//panic被recover，只保留最近3条记录，按时间倒序
+	runs := History("test-entry-run")
+	if len(runs) != 3 {
+		t.Error("history size mismatch", runs)
+		return
+	}
+	outcomes := []string{OutcomePanic, OutcomeSkipped, OutcomeFailed}
+	for k, run := range runs {
+		if run.Outcome != outcomes[k] {
+			t.Error("outcome mismatch", k, run)
+		}
+	}
+	if runs[0].Error != "boom" || runs[2].Error != "failed" {
+		t.Error("error mismatch", runs)
+	}
+}
+
+func TestSkipIfRunning(t *testing.T) {
+	release := make(chan struct{})
+	AddFunc(cron.New(), "test-skip-if-running", "@every 1s", func(ctx context.Context) error {
+		<-release
+		return nil
+	}, SkipIfRunning(true))
+
+	eLock.RLock()
+	e := entries["test-skip-if-running"]
+	eLock.RUnlock()
+	go e.run()
+	time.Sleep(time.Millisecond * 50)
+	e.run()
+	close(release)
+	time.Sleep(time.Millisecond * 50)
+
+	runs := History("test-skip-if-running")
+	if len(runs) != 2 || runs[1].Outcome != OutcomeSkipped || runs[0].Outcome != OutcomeSucceed {
+		t.Error("overlapping run must be skipped", runs)
+	}
+}
@@ -0,0 +1,217 @@
+package schedule
+
+import (
+	"context"
+	redis_pool "github.com/hetiansu5/go-redis-pool"
+	"github.com/qit-team/snow-core/log/logger"
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/snow-core/utils"
+	"github.com/qit-team/work"
+	"github.com/robfig/cron"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//leader锁key的前缀，完整key为 <prefix><name>
+	leaderKeyPrefix = "snow:schedule:leader:"
+	//默认的leader锁名称
+	defaultLeaderName = "default"
+	//默认的leader锁过期时间
+	defaultLeaderTTL = time.Second * 30
+	//任务header中记录触发时间(毫秒时间戳)的key
+	HeaderScheduleAt = "x-schedule-at"
+)
+
+/**
+ * 获取或者续期leader锁
+ * KEYS[1] leader锁key
+ * ARGV[1] 实例id ARGV[2] 过期时间(毫秒)
+ * @return 1表示当前实例为leader
+ */
+const electScript = `
+local owner = redis.call('GET', KEYS[1])
+if owner == false or owner == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+return 0
+`
+
+/**
+ * 当前实例持有leader锁时释放
+ * KEYS[1] leader锁key
+ * ARGV[1] 实例id
+ */
+const releaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+var (
+	//通过NewScheduler生成的调度器，StopSchedulers时统一停止
+	schedulers []*Scheduler
+	sLock      sync.Mutex
+)
+
+/**
+ * 定时投递任务的调度器，按cron表达式将任务投递到topic，由job进程消费
+ * 多个cron实例使用相同名称时通过redis的leader锁选主，只有leader实例投递任务
+ */
+type Scheduler struct {
+	cron   *cron.Cron
+	job    *work.Job
+	client *redis_pool.ReplicaPool
+	key    string
+	ttl    time.Duration
+	//实例id，作为leader锁的值
+	id string
+	//leader身份的有效期(纳秒时间戳)，续期失败超过ttl后不再认为是leader
+	leaseUntil int64
+
+	//保证Stop之后不会再获取leader锁
+	mu      sync.Mutex
+	stopped bool
+}
+
+/**
+ * 生成调度器，leader锁会按ttl/3的间隔续期
+ * @param c cron实例，调度器的任务注册在此实例上，随cron启动和停止
+ * @param job 投递任务的Job
+ * @param diName redis实例名
+ * @param args 可选参数按类型识别：string为leader锁名称，默认为default；time.Duration为leader锁过期时间，默认30秒
+ */
+func NewScheduler(c *cron.Cron, job *work.Job, diName string, args ...interface{}) *Scheduler {
+	name := defaultLeaderName
+	ttl := defaultLeaderTTL
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			name = v
+		case time.Duration:
+			ttl = v
+		}
+	}
+	if ttl < time.Second*3 {
+		ttl = time.Second * 3
+	}
+
+	s := &Scheduler{
+		cron:   c,
+		job:    job,
+		client: redis.GetRedis(diName).WithMaster(),
+		key:    leaderKeyPrefix + name,
+		ttl:    ttl,
+		id:     utils.GenUUID(),
+	}
+	s.elect()
+	c.Schedule(cron.Every(ttl/3), cron.FuncJob(s.elect))
+
+	sLock.Lock()
+	schedulers = append(schedulers, s)
+	sLock.Unlock()
+	return s
+}
+
+//获取或者续期leader锁
+func (s *Scheduler) elect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+
+	start := time.Now()
+	reply, err := s.client.Do("EVAL", electScript, 1, s.key, s.id, int64(s.ttl/time.Millisecond))
+	if err != nil {
+		logger.Error(context.Background(), "schedule_elect_error", logger.NewWithField("key", s.key), err.Error())
+		return
+	}
+	if ok, _ := reply.(int64); ok == 1 {
+		atomic.StoreInt64(&s.leaseUntil, start.Add(s.ttl).UnixNano())
+	} else {
+		atomic.StoreInt64(&s.leaseUntil, 0)
+	}
+}
+
+//当前实例是否为leader
+func (s *Scheduler) IsLeader() bool {
+	return time.Now().UnixNano() < atomic.LoadInt64(&s.leaseUntil)
+}
+
+/**
+ * 停止调度器，不再投递任务和续期leader锁
+ * 当前实例为leader时释放leader锁，其他实例在下一次续期时即可接管，不需要等待锁过期
+ * 应在cron停止之后调用
+ */
+func (s *Scheduler) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return nil
+	}
+	s.stopped = true
+	atomic.StoreInt64(&s.leaseUntil, 0)
+
+	_, err := s.client.Do("EVAL", releaseScript, 1, s.key, s.id)
+	if err != nil {
+		logger.Error(context.Background(), "schedule_release_error", logger.NewWithField("key", s.key), err.Error())
+	}
+	return err
+}
+
+//停止全部通过NewScheduler生成的调度器，释放持有的leader锁
+func StopSchedulers() {
+	sLock.Lock()
+	arr := schedulers
+	schedulers = nil
+	sLock.Unlock()
+
+	for _, s := range arr {
+		s.Stop()
+	}
+}
+
+/**
+ * 按cron表达式定时投递任务
+ * @param spec cron表达式，同cron.AddFunc
+ * @param topic 投递的topic
+ * @param newTask 每次触发时生成任务
+ * @param args 入队参数，同work.Job.EnqueueWithTask
+ */
+func (s *Scheduler) AddTask(spec string, topic string, newTask func() work.Task, args ...interface{}) error {
+	return s.cron.AddFunc(spec, func() {
+		if !s.IsLeader() {
+			return
+		}
+
+		ctx := context.Background()
+		task := newTask()
+		if task.Id == "" {
+			task.Id = work.GenUUID()
+		}
+		task.SetHeader(HeaderScheduleAt, strconv.FormatInt(utils.GetCurrentMilliTime(), 10))
+		fields := []interface{}{logger.NewWithField("spec", spec), logger.NewWithField("topic", topic), logger.NewWithField("task_id", task.Id)}
+		ok, err := s.job.EnqueueWithTask(ctx, topic, task, args...)
+		if err != nil {
+			logger.Error(ctx, "schedule_enqueue_error", append(fields, err.Error())...)
+			return
+		}
+		if !ok {
+			logger.Error(ctx, "schedule_enqueue_error", append(fields, "enqueue failed")...)
+			return
+		}
+		logger.Info(ctx, "schedule_enqueue", fields...)
+	})
+}
+
+//按cron表达式定时投递消息
+func (s *Scheduler) AddMessage(spec string, topic string, message string, args ...interface{}) error {
+	return s.AddTask(spec, topic, func() work.Task {
+		return work.GenTask(topic, message)
+	}, args...)
+}
@@ -0,0 +1,151 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"github.com/qit-team/snow-core/config"
+	"github.com/qit-team/snow-core/log/logger"
+	"github.com/qit-team/snow-core/queue"
+	_ "github.com/qit-team/snow-core/queue/redisqueue"
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/work"
+	"github.com/robfig/cron"
+)
+
+func init() {
+	redisConf := config.RedisConfig{
+		Master: config.RedisBaseConfig{
+			Host: "127.0.0.1",
+			Port: 6379,
+		},
+	}
+
+	//注册redis类
+	err := redis.Pr.Register("redis", redisConf, true)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	//注册日志类，输出到标准输出
+	err = logger.Pr.Register("logger", config.LogConfig{Handler: logger.HandlerStdout, Dir: "/dev/stdout", Level: "info"}, true)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func TestScheduler_IsLeader(t *testing.T) {
+	redis.GetRedis("redis").Del(leaderKeyPrefix + "test-leader")
+	s1 := NewScheduler(cron.New(), work.New(), "redis", "test-leader", 3*time.Second)
+	s2 := NewScheduler(cron.New(), work.New(), "redis", "test-leader", 3*time.Second)
+	if !s1.IsLeader() {
+		t.Error("first scheduler must be leader")
+		return
+	}
+	if s2.IsLeader() {
+		t.Error("second scheduler must not be leader")
+		return
+	}
+
+	//leader续期后仍为leader
+	s1.elect()
+	s2.elect()
+	if !s1.IsLeader() || s2.IsLeader() {
+		t.Error("leader must not change after renewal")
+	}
+}
+
+func TestScheduler_Stop(t *testing.T) {
+	key := leaderKeyPrefix + "test-stop"
+	client := redis.GetRedis("redis")
+	client.Del(key)
+	s1 := NewScheduler(cron.New(), work.New(), "redis", "test-stop", 3*time.Second)
+	s2 := NewScheduler(cron.New(), work.New(), "redis", "test-stop", 3*time.Second)
+
+	//非leader实例停止时不能释放leader锁
+	if err := s2.Stop(); err != nil {
+		t.Error(err)
+		return
+	}
+	if owner, _ := client.Get(key); owner != s1.id {
+		t.Error("follower must not release the leader key", owner)
+		return
+	}
+
+	if err := s1.Stop(); err != nil {
+		t.Error(err)
+		return
+	}
+	if s1.IsLeader() {
+		t.Error("stopped scheduler must not be leader")
+		return
+	}
+	if owner, _ := client.Get(key); owner != "" {
+		t.Error("leader key must be released", owner)
+		return
+	}
+
+	//停止后不再获取leader锁，其他实例立即接管
+	s1.elect()
+	if s1.IsLeader() {
+		t.Error("stopped scheduler must not elect again")
+		return
+	}
+	s3 := NewScheduler(cron.New(), work.New(), "redis", "test-stop", 3*time.Second)
+	if !s3.IsLeader() {
+		t.Error("new scheduler must take over after the leader stopped")
+		return
+	}
+
+	StopSchedulers()
+	if s3.IsLeader() {
+		t.Error("stop schedulers must stop every scheduler")
+		return
+	}
+	if owner, _ := client.Get(key); owner != "" {
+		t.Error("leader key must be released", owner)
+	}
+}
+
+func TestScheduler_AddMessage(t *testing.T) {
+	ctx := context.TODO()
+	topic := "snow-schedule-test"
+	q := queue.GetQueue("redis", queue.DriverTypeRedis)
+	q.(work.BrowsableQueue).Purge(ctx, topic)
+	redis.GetRedis("redis").Del(leaderKeyPrefix + "test-add")
+
+	job := work.New()
+	job.AddQueue(q)
+	//投递的topic需要注册过worker才会映射到queue
+	job.AddFunc(topic, func(task work.Task) work.TaskResult {
+		return work.TaskResult{Id: task.Id}
+	})
+	c1 := cron.New()
+	c2 := cron.New()
+	NewScheduler(c1, job, "redis", "test-add").AddMessage("@every 1s", topic, "leader")
+	NewScheduler(c2, job, "redis", "test-add").AddMessage("@every 1s", topic, "follower")
+	c1.Start()
+	c2.Start()
+	time.Sleep(time.Millisecond * 2500)
+	c1.Stop()
+	c2.Stop()
+
+	//只有leader实例投递任务
+	n, err := q.(work.BrowsableQueue).Len(ctx, topic)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n < 2 {
+		t.Error("leader should enqueue every tick, queue length", n)
+	}
+	for i := int64(0); i < n; i++ {
+		message, _, _ := q.Dequeue(ctx, topic)
+		task, _ := work.DecodeStringTask(message)
+		if task.Message != "leader" || task.GetHeader(HeaderScheduleAt) == "" {
+			t.Error("task must be enqueued by leader", message)
+		}
+	}
+	q.(work.BrowsableQueue).Purge(ctx, topic)
+}
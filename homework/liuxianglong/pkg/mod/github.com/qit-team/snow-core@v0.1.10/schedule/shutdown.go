@@ -0,0 +1,104 @@
+package schedule
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//一批执行中的任务，Shutdown时整体等待和取消
+type runner struct {
+	//任务执行的ctx，Shutdown等待超时后取消
+	ctx    context.Context
+	cancel context.CancelFunc
+	//执行中的任务
+	inFlight map[int64]Run
+	wg       sync.WaitGroup
+}
+
+func newRunner() *runner {
+	r := &runner{inFlight: make(map[int64]Run)}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	return r
+}
+
+var (
+	//新的执行记录到current，Shutdown时替换为新的runner，之后的执行不受上一次关闭的影响
+	current = newRunner()
+	runSeq  int64
+	fLock   sync.Mutex
+)
+
+//平滑关闭的结果
+type StopReport struct {
+	//等待超时时仍在执行的任务，ctx已被取消
+	Interrupted []Run `json:"interrupted"`
+	//等待耗时
+	Elapsed time.Duration `json:"elapsed"`
+	//是否等待超时
+	TimedOut bool `json:"timed_out"`
+}
+
+//记录执行中的任务，返回任务执行的ctx和执行完成后移除记录的函数
+func track(run Run) (context.Context, func()) {
+	//与Shutdown替换runner使用同一把锁，保证等待开始后不会再有任务加入被等待的runner
+	fLock.Lock()
+	r := current
+	r.wg.Add(1)
+	runSeq++
+	seq := runSeq
+	r.inFlight[seq] = run
+	fLock.Unlock()
+	return r.ctx, func() {
+		fLock.Lock()
+		delete(r.inFlight, seq)
+		fLock.Unlock()
+		r.wg.Done()
+	}
+}
+
+/**
+ * 等待执行中的任务完成，超时后取消任务的ctx并返回仍在执行的任务
+ * 需要先停止cron，避免等待期间触发新的执行；只有通过AddFunc注册的任务会被等待
+ * 调用之后开始的执行使用新的ctx，不会被本次关闭取消
+ * @param timeout 等待的超时时间，小于等于0时不等待
+ */
+func Shutdown(timeout time.Duration) StopReport {
+	start := time.Now()
+	fLock.Lock()
+	r := current
+	current = newRunner()
+	fLock.Unlock()
+
+	ch := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(ch)
+	}()
+
+	var report StopReport
+	if timeout > 0 {
+		select {
+		case <-ch:
+		case <-time.After(timeout):
+			report.TimedOut = true
+		}
+	} else {
+		select {
+		case <-ch:
+		default:
+			report.TimedOut = true
+		}
+	}
+
+	fLock.Lock()
+	for _, run := range r.inFlight {
+		run.Duration = time.Since(run.Start)
+		report.Interrupted = append(report.Interrupted, run)
+	}
+	fLock.Unlock()
+
+	r.cancel()
+	report.Elapsed = time.Since(start)
+	return report
+}
@@ -0,0 +1,108 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+	"github.com/robfig/cron"
+)
+
+func TestShutdown(t *testing.T) {
+	cancelled := make(chan struct{})
+	AddFunc(cron.New(), "test-shutdown-fast", "@every 1s", func(ctx context.Context) error {
+		time.Sleep(time.Millisecond * 50)
+		return nil
+	})
+	AddFunc(cron.New(), "test-shutdown-slow", "@every 1s", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+
+	eLock.RLock()
+	fast := entries["test-shutdown-fast"]
+	slow := entries["test-shutdown-slow"]
+	eLock.RUnlock()
+	go fast.run()
+	go slow.run()
+	time.Sleep(time.Millisecond * 10)
+
+	//等待执行快的任务完成，超时后取消执行慢的任务
+	report := Shutdown(time.Millisecond * 200)
+	if !report.TimedOut {
+		t.Error("shutdown must time out")
+	}
+	if len(report.Interrupted) != 1 || report.Interrupted[0].Name != "test-shutdown-slow" {
+		t.Error("interrupted runs mismatch", report.Interrupted)
+		return
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("ctx must be cancelled after shutdown timeout")
+	}
+
+	runs := History("test-shutdown-fast")
+	if len(runs) != 1 || runs[0].Outcome != OutcomeSucceed {
+		t.Error("fast run must finish before shutdown", runs)
+	}
+}
+
+func TestShutdown_restart(t *testing.T) {
+	ctxErr := make(chan error, 1)
+	AddFunc(cron.New(), "test-shutdown-restart", "@every 1s", func(ctx context.Context) error {
+		time.Sleep(time.Millisecond * 50)
+		ctxErr <- ctx.Err()
+		return nil
+	})
+	eLock.RLock()
+	e := entries["test-shutdown-restart"]
+	eLock.RUnlock()
+
+	if report := Shutdown(time.Second); report.TimedOut {
+		t.Error("shutdown without runs must not time out", report)
+		return
+	}
+
+	//上一次关闭后开始的执行使用新的ctx，并由下一次关闭等待
+	go e.run()
+	time.Sleep(time.Millisecond * 10)
+	report := Shutdown(time.Second)
+	if report.TimedOut || len(report.Interrupted) != 0 {
+		t.Error("shutdown must wait for the new run", report)
+		return
+	}
+	select {
+	case err := <-ctxErr:
+		if err != nil {
+			t.Error("ctx must not be cancelled by the previous shutdown", err)
+		}
+	default:
+		t.Error("run must finish before shutdown returns")
+	}
+}
+
+func TestShutdown_concurrentRuns(t *testing.T) {
+	AddFunc(cron.New(), "test-shutdown-concurrent", "@every 1s", func(ctx context.Context) error {
+		return nil
+	})
+	eLock.RLock()
+	e := entries["test-shutdown-concurrent"]
+	eLock.RUnlock()
+
+	//关闭期间开始的执行不能加入正在等待的任务
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 200; i++ {
+			e.run()
+		}
+		close(done)
+	}()
+	for i := 0; i < 20; i++ {
+		Shutdown(time.Second)
+	}
+	<-done
+	if report := Shutdown(time.Second); report.TimedOut {
+		t.Error("shutdown must not time out", report)
+	}
+}
@@ -0,0 +1,176 @@
+package work
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+//批量worker默认的凑批等待时间
+const defaultBatchWait = time.Millisecond * 100
+
+/**
+ * 批量处理的worker，一次接收多个任务，适合批量写库等场景
+ * 返回的结果与tasks按下标一一对应，缺少的结果按StateFailed处理，每个任务按各自的结果单独ack或重试
+ */
+type BatchWorkerFunc interface {
+	WorkerFunc
+	RunBatch(ctx context.Context, tasks []Task) []TaskResult
+}
+
+type MyBatchWorkerFunc func(ctx context.Context, tasks []Task) []TaskResult
+
+func (f MyBatchWorkerFunc) Run(task Task) TaskResult {
+	results := f(WithTask(context.Background(), task), []Task{task})
+	if len(results) == 0 {
+		return TaskResult{Id: task.Id, State: StateFailed, Message: "missing result"}
+	}
+	return results[0]
+}
+
+func (f MyBatchWorkerFunc) RunBatch(ctx context.Context, tasks []Task) []TaskResult {
+	return f(ctx, tasks)
+}
+
+/**
+ * 注册批量worker，拉取到size个任务或者等待wait时间后一次性投递给回调函数
+ * args可选参数同AddContextFunc，并发数小于size时按size处理，time.Duration为整批任务的超时时间
+ */
+func (j *Job) AddBatchFunc(topic string, f func(ctx context.Context, tasks []Task) []TaskResult, size int, wait time.Duration, args ...interface{}) error {
+	w := newWorker(MyBatchWorkerFunc(f), args...)
+	w.BatchSize = size
+	w.BatchWait = wait
+	return j.AddWorker(topic, w)
+}
+
+/**
+ * 以first为第一个任务凑批，达到BatchSize或者等待BatchWait超时后返回
+ * Job停止时已拉取的任务放回队列，返回false
+ */
+func (j *Job) collectBatch(w *Worker, topic string, first Task, taskChan <-chan Task, stop <-chan struct{}) ([]Task, bool) {
+	wait := w.BatchWait
+	if wait <= 0 {
+		wait = defaultBatchWait
+	}
+
+	tasks := make([]Task, 0, w.BatchSize)
+	tasks = append(tasks, first)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for len(tasks) < w.BatchSize {
+		select {
+		case task := <-taskChan:
+			tasks = append(tasks, task)
+		case <-timer.C:
+			return tasks, true
+		case <-stop:
+			q := j.GetQueueByTopic(topic)
+			for _, task := range tasks {
+				j.requeueTask(q, topic, task)
+				j.concurrency[topic] <- struct{}{}
+			}
+			return nil, false
+		}
+	}
+	return tasks, true
+}
+
+//批量处理任务，每个任务按各自的结果统计、ack或重试
+func (j *Job) processBatch(topic string, tasks []Task) {
+	c := j.counter(topic)
+	start := time.Now()
+	untracks := make([]func(), len(tasks))
+	for i, task := range tasks {
+		untracks[i] = j.trackTask(task)
+	}
+	atomic.AddInt64(&c.inFlight, int64(len(tasks)))
+	defer func() {
+		atomic.AddInt64(&c.inFlight, -int64(len(tasks)))
+		for _, untrack := range untracks {
+			untrack()
+		}
+		j.wg.Done()
+		for range tasks {
+			j.concurrency[topic] <- struct{}{}
+		}
+
+		//任务panic回调函数，整批任务都不会ack
+		if e := recover(); e != nil {
+			atomic.AddInt64(&j.handlePanicCount, int64(len(tasks)))
+			atomic.AddInt64(&c.handlePanic, int64(len(tasks)))
+			for _, task := range tasks {
+				if j.taskPanicCallback != nil {
+					j.taskPanicCallback(task, e)
+				} else {
+					j.logAndPrintln(Error, "task_panic", task, e)
+				}
+			}
+		}
+	}()
+
+	w := j.getWorker(topic)
+	q := j.GetQueueByTopic(topic)
+
+	pending := make([]Task, 0, len(tasks))
+	for i, task := range tasks {
+		//已处理过的重复投递任务直接ack
+		if j.isProcessed(w, topic, task) {
+			atomic.AddInt64(&c.skip, 1)
+			j.logAndPrintln(Info, "skip_processed_task", topic, task.Id)
+			j.ackTask(topic, task)
+			continue
+		}
+
+		//按限流器获取令牌，等待期间Job停止时剩余任务放回队列
+		if !j.waitLimiter(w, c) {
+			for _, t := range tasks[i:] {
+				j.requeueTask(q, topic, t)
+			}
+			break
+		}
+
+		//任务处理前回调函数
+		if j.taskBeforeCallback != nil {
+			j.taskBeforeCallback(task)
+		}
+		pending = append(pending, task)
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	ctx, cancel := j.batchContext(w)
+	defer cancel()
+
+	var results []TaskResult
+	if bw, ok := w.Call.(BatchWorkerFunc); ok {
+		results = bw.RunBatch(ctx, pending)
+	} else {
+		results = make([]TaskResult, len(pending))
+		for i, task := range pending {
+			results[i] = w.Call.Run(task)
+		}
+	}
+
+	elapsed := time.Since(start)
+	for i, task := range pending {
+		result := TaskResult{Id: task.Id, State: StateFailed, Message: "missing result"}
+		if i < len(results) {
+			result = results[i]
+		}
+
+		atomic.AddInt64(&j.handleCount, 1)
+		atomic.AddInt64(&c.handle, 1)
+		c.observe(elapsed)
+		j.handleResult(w, topic, task, result)
+	}
+}
+
+//生成批量任务处理函数的ctx：Job平滑关闭等待超时时取消，设置了超时时间的worker会在超时后取消
+func (j *Job) batchContext(w *Worker) (context.Context, context.CancelFunc) {
+	if w.Timeout > 0 {
+		return context.WithTimeout(j.runCtx, w.Timeout)
+	}
+	return context.WithCancel(j.runCtx)
+}
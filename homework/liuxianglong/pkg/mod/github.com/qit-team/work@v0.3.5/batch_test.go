@@ -0,0 +1,203 @@
+package work
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//入队n个任务后出队，返回携带token的任务
+func dequeueTasks(j *Job, q *testQueue, topic string, n int) []Task {
+	ctx := context.TODO()
+	for i := 0; i < n; i++ {
+		j.Enqueue(ctx, topic, strconv.Itoa(i))
+	}
+	tasks := make([]Task, 0, n)
+	for i := 0; i < n; i++ {
+		message, token, _ := q.Dequeue(ctx, topic)
+		task, _ := DecodeStringTask(message)
+		task.Token = token
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+//生成批量worker的Job并初始化worker和queue
+func newBatchJob(topic string, size int, wait time.Duration, f func(ctx context.Context, tasks []Task) []TaskResult, args ...interface{}) (*Job, *testQueue) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	j.AddBatchFunc(topic, f, size, wait, args...)
+	j.initWorkers()
+	j.initQueueMap()
+	return j, q
+}
+
+func succeedAll(ctx context.Context, tasks []Task) []TaskResult {
+	results := make([]TaskResult, len(tasks))
+	for k, task := range tasks {
+		results[k] = TaskResult{Id: task.Id, State: StateSucceed}
+	}
+	return results
+}
+
+func TestCollectBatch_size(t *testing.T) {
+	topic := "batch:size"
+	j, _ := newBatchJob(topic, 3, time.Second, succeedAll)
+	w := j.getWorker(topic)
+
+	taskChan := make(chan Task, 3)
+	for i := 1; i <= 3; i++ {
+		taskChan <- GenTask(topic, strconv.Itoa(i))
+	}
+
+	//凑满一批后立即返回，不等待BatchWait
+	start := time.Now()
+	tasks, ok := j.collectBatch(w, topic, GenTask(topic, "0"), taskChan, make(chan struct{}))
+	if !ok || len(tasks) != 3 {
+		t.Error("batch must be flushed on size", ok, tasks)
+		return
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Error("batch must not wait when it is full", d)
+		return
+	}
+	if tasks[0].Message != "0" || tasks[2].Message != "2" || len(taskChan) != 1 {
+		t.Error("batch order error", tasks, len(taskChan))
+	}
+}
+
+func TestCollectBatch_wait(t *testing.T) {
+	topic := "batch:wait"
+	j, _ := newBatchJob(topic, 10, 50*time.Millisecond, succeedAll)
+	w := j.getWorker(topic)
+
+	taskChan := make(chan Task, 1)
+	taskChan <- GenTask(topic, "1")
+
+	//不足一批时等待BatchWait后按已拉取的任务返回
+	start := time.Now()
+	tasks, ok := j.collectBatch(w, topic, GenTask(topic, "0"), taskChan, make(chan struct{}))
+	if !ok || len(tasks) != 2 {
+		t.Error("batch must be flushed after max wait", ok, tasks)
+		return
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Error("batch must wait for more tasks", d)
+	}
+}
+
+func TestCollectBatch_stop(t *testing.T) {
+	topic := "batch:stop"
+	j, q := newBatchJob(topic, 3, time.Minute, succeedAll)
+	w := j.getWorker(topic)
+	tasks := dequeueTasks(j, q, topic, 2)
+	//已拉取的任务各占用一个并发数
+	for range tasks {
+		<-j.concurrency[topic]
+	}
+
+	taskChan := make(chan Task, 1)
+	taskChan <- tasks[1]
+	stop := make(chan struct{})
+	type collected struct {
+		tasks []Task
+		ok    bool
+	}
+	done := make(chan collected)
+	go func() {
+		tasks, ok := j.collectBatch(w, topic, tasks[0], taskChan, stop)
+		done <- collected{tasks, ok}
+	}()
+	for len(taskChan) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+
+	//Job停止时已拉取的任务放回队列，归还并发数
+	res := <-done
+	if res.ok || res.tasks != nil {
+		t.Error("collect batch must return false on stop", res)
+		return
+	}
+	if len(q.messages(topic)) != 2 || q.ackedCount() != 2 {
+		t.Error("collected tasks must be requeued", q.messages(topic), q.ackedCount())
+		return
+	}
+	if n := len(j.concurrency[topic]); n != w.MaxConcurrency {
+		t.Error("concurrency tokens must be returned", n, w.MaxConcurrency)
+	}
+}
+
+func TestProcessBatch_missingResult(t *testing.T) {
+	topic := "batch:missing"
+	var got []Task
+	j, q := newBatchJob(topic, 2, time.Second, func(ctx context.Context, tasks []Task) []TaskResult {
+		got = tasks
+		//只返回第一个任务的结果
+		return []TaskResult{{Id: tasks[0].Id, State: StateSucceed}}
+	})
+	tasks := dequeueTasks(j, q, topic, 2)
+	for range tasks {
+		<-j.concurrency[topic]
+	}
+
+	j.wg.Add(1)
+	j.processBatch(topic, tasks)
+
+	if len(got) != 2 {
+		t.Error("batch func must receive all tasks", got)
+		return
+	}
+	//缺少结果的任务按StateFailed处理，不ack
+	if q.ackedCount() != 1 {
+		t.Error("only the succeeded task must be acked", q.ackedCount())
+		return
+	}
+	s := j.TopicStats(topic)
+	if s.Handle != 2 || s.HandleErr != 1 || s.InFlight != 0 {
+		t.Error("batch stats error", s.Handle, s.HandleErr, s.InFlight)
+		return
+	}
+	if n, max := len(j.concurrency[topic]), j.getWorker(topic).MaxConcurrency; n != max {
+		t.Error("concurrency tokens must be returned", n, max)
+	}
+}
+
+func TestProcessBatch_ackAndRetry(t *testing.T) {
+	topic := "batch:retry"
+	j, q := newBatchJob(topic, 3, time.Second, func(ctx context.Context, tasks []Task) []TaskResult {
+		return []TaskResult{
+			{Id: tasks[0].Id, State: StateSucceed},
+			{Id: tasks[1].Id, State: StateFailed, Message: "retry"},
+			{Id: tasks[2].Id, State: StateFailedWithAck},
+		}
+	}, NewFixedRetry(3, time.Second))
+	tasks := dequeueTasks(j, q, topic, 3)
+	for range tasks {
+		<-j.concurrency[topic]
+	}
+
+	j.wg.Add(1)
+	j.processBatch(topic, tasks)
+
+	//成功和StateFailedWithAck的任务ack，失败的任务重新入队后ack原消息
+	if q.ackedCount() != 3 {
+		t.Error("every task must be acked by its own result", q.ackedCount())
+		return
+	}
+	messages := q.messages(topic)
+	if len(messages) != 1 {
+		t.Error("failed task must be retried", messages)
+		return
+	}
+	retried, _ := DecodeStringTask(messages[0].message)
+	if retried.Id != tasks[1].Id || retried.Attempt != 1 {
+		t.Error("retried task error", retried)
+		return
+	}
+	s := j.TopicStats(topic)
+	if s.Retry != 1 || s.HandleErr != 2 {
+		t.Error("batch stats error", s.Retry, s.HandleErr)
+	}
+}
@@ -0,0 +1,87 @@
+package work
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+)
+
+//任务header中记录payload编码器名称的key
+const HeaderCodec = "x-codec"
+
+/**
+ * payload编码器接口，json之外的编码器(如msgpack、protobuf)需要先调用RegisterCodec注册
+ * 编码器名称会随任务的header投递，消费时按名称选择解码器
+ */
+type Codec interface {
+	//编码器名称，全局唯一
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+//默认的json编码器
+var JSONCodec Codec = jsonCodec{}
+
+var (
+	codecs = map[string]Codec{
+		JSONCodec.Name(): JSONCodec,
+	}
+	codecLock sync.RWMutex
+)
+
+//注册编码器，同名的编码器会被覆盖
+func RegisterCodec(c Codec) {
+	codecLock.Lock()
+	codecs[c.Name()] = c
+	codecLock.Unlock()
+}
+
+//根据名称获取已注册的编码器
+func GetCodec(name string) (Codec, bool) {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
+
+/**
+ * 将payload编码为任务消息
+ * json编码的结果原样作为消息，兼容直接读取task.Message的处理函数；其他编码器的结果为二进制，需要base64编码
+ */
+func encodePayload(c Codec, v interface{}) (string, error) {
+	data, err := c.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	if c.Name() == JSONCodec.Name() {
+		return string(data), nil
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+//将任务消息解码为payload，encodePayload的逆过程
+func decodePayload(c Codec, message string, v interface{}) error {
+	if c.Name() == JSONCodec.Name() {
+		return c.Unmarshal([]byte(message), v)
+	}
+	data, err := base64.StdEncoding.DecodeString(message)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(data, v)
+}
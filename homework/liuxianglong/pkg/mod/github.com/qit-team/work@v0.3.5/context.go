@@ -0,0 +1,31 @@
+package work
+
+import "context"
+
+type taskContextKey struct{}
+
+//将任务信息注入ctx
+func WithTask(ctx context.Context, task Task) context.Context {
+	return context.WithValue(ctx, taskContextKey{}, task)
+}
+
+//从ctx获取任务信息
+func TaskFromContext(ctx context.Context) (Task, bool) {
+	if ctx == nil {
+		return Task{}, false
+	}
+	task, ok := ctx.Value(taskContextKey{}).(Task)
+	return task, ok
+}
+
+//生成任务处理函数的ctx：携带任务信息，Job平滑关闭等待超时时取消，设置了超时时间的worker会在超时后取消
+func (j *Job) taskContext(w *Worker, task Task) (context.Context, context.CancelFunc) {
+	ctx := WithTask(j.runCtx, task)
+	if j.taskContextCallback != nil {
+		ctx = j.taskContextCallback(ctx, task)
+	}
+	if w.Timeout > 0 {
+		return context.WithTimeout(ctx, w.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,129 @@
+package work
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testContextKey struct{}
+
+func TestTaskContext(t *testing.T) {
+	j := newTestJob(newTestQueue())
+	j.RegisterTaskContextCallback(func(ctx context.Context, task Task) context.Context {
+		return context.WithValue(ctx, testContextKey{}, "trace-"+task.Id)
+	})
+	task := GenTask("context:task", "1")
+	task.Id = "1"
+
+	//未设置超时时间时ctx没有deadline
+	ctx, cancel := j.taskContext(&Worker{}, task)
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("ctx must not have a deadline without timeout")
+		return
+	}
+	if got, ok := TaskFromContext(ctx); !ok || got.Id != "1" {
+		t.Error("ctx must carry the task", got, ok)
+		return
+	}
+	if v, _ := ctx.Value(testContextKey{}).(string); v != "trace-1" {
+		t.Error("ctx callback must be applied", v)
+		return
+	}
+	cancel()
+	if ctx.Err() != context.Canceled {
+		t.Error("ctx must be cancelled by cancel func", ctx.Err())
+		return
+	}
+
+	//设置了超时时间的worker在超时后取消ctx
+	ctx, cancel = j.taskContext(&Worker{Timeout: 20 * time.Millisecond}, task)
+	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		t.Error("ctx must have a deadline with timeout")
+		return
+	}
+	if !waitClosed(ctx.Done(), time.Second) || ctx.Err() != context.DeadlineExceeded {
+		t.Error("ctx must be cancelled after timeout", ctx.Err())
+	}
+}
+
+func TestProcessTask_timeout(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "context:timeout"
+	errs := make(chan error, 1)
+	j.AddContextFunc(topic, func(ctx context.Context, task Task) TaskResult {
+		<-ctx.Done()
+		errs <- ctx.Err()
+		return TaskResult{Id: task.Id, State: StateFailedWithAck, Message: ctx.Err().Error()}
+	}, 1, 30*time.Millisecond)
+	j.Enqueue(context.TODO(), topic, "1")
+
+	j.Start()
+	defer j.Shutdown(time.Second)
+	select {
+	case err := <-errs:
+		if err != context.DeadlineExceeded {
+			t.Error("task ctx must time out", err)
+			return
+		}
+	case <-time.After(time.Second):
+		t.Error("task ctx is not cancelled after timeout")
+		return
+	}
+	//超时只取消当前任务，Job继续运行
+	if j.State() != JobRunning {
+		t.Error("job must keep running after task timeout", j.State())
+	}
+}
+
+func TestProcessTask_cancelOnStop(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "context:stop"
+	started := make(chan struct{})
+	errs := make(chan error, 1)
+	j.RegisterTaskContextCallback(func(ctx context.Context, task Task) context.Context {
+		return context.WithValue(ctx, testContextKey{}, task.Id)
+	})
+	j.AddContextFunc(topic, func(ctx context.Context, task Task) TaskResult {
+		close(started)
+		<-ctx.Done()
+		errs <- ctx.Err()
+		return TaskResult{Id: task.Id, State: StateFailed, Message: ctx.Err().Error()}
+	}, 1, time.Minute)
+	j.Enqueue(context.TODO(), topic, "1")
+
+	j.Start()
+	if !waitClosed(started, time.Second) {
+		t.Error("task is not started")
+		return
+	}
+	j.Shutdown(30 * time.Millisecond)
+
+	//平滑关闭等待超时后取消，回调函数生成的ctx同样被取消
+	select {
+	case err := <-errs:
+		if err != context.Canceled {
+			t.Error("task ctx must be cancelled on stop", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("task ctx is not cancelled on stop")
+	}
+}
+
+func TestMyContextWorkerFunc_Run(t *testing.T) {
+	f := MyContextWorkerFunc(func(ctx context.Context, task Task) TaskResult {
+		got, ok := TaskFromContext(ctx)
+		if !ok || got.Id != task.Id {
+			return TaskResult{Id: task.Id, State: StateFailed}
+		}
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	})
+	//不经过Job调用Run时ctx同样携带任务信息
+	task := GenTask("context:run", "1")
+	if r := f.Run(task); r.State != StateSucceed {
+		t.Error("ctx must carry the task when called by Run", r)
+	}
+}
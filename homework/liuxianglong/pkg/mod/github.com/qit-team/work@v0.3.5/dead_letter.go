@@ -0,0 +1,209 @@
+package work
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//死信队列topic的默认后缀
+	DeadLetterSuffix = ".dlq"
+	//死信队列分页查找时的单页数量
+	deadLetterPageSize = 100
+)
+
+//进入死信队列的原因
+const (
+	DeadReasonDecodeError        = "decode_task_error"
+	DeadReasonRetryExhausted     = "retry_exhausted"
+	DeadReasonPayloadDecodeError = "decode_payload_error"
+)
+
+var (
+	ErrQueueNotBrowsable  = errors.New("queue is not browsable")
+	ErrDeadLetterNotExist = errors.New("dead letter is not exists")
+)
+
+//死信消息
+type DeadLetter struct {
+	Id        string `json:"id"`
+	Topic     string `json:"topic"`
+	Message   string `json:"message"` //原始消息，重放时原样入队
+	Reason    string `json:"reason"`
+	Attempt   int    `json:"attempt"`
+	LastError string `json:"last_error"`
+	FailedAt  int64  `json:"failed_at"`
+}
+
+func DecodeStringDeadLetter(s string) (d DeadLetter, err error) {
+	err = json.Unmarshal([]byte(s), &d)
+	return
+}
+
+//topic对应的死信队列topic，worker未设置时默认为 <topic>.dlq
+func (j *Job) DeadLetterTopic(topic string) string {
+	j.wLock.RLock()
+	w, ok := j.workers[topic]
+	j.wLock.RUnlock()
+	if ok && w.DeadLetterTopic != "" {
+		return w.DeadLetterTopic
+	}
+	return topic + DeadLetterSuffix
+}
+
+/**
+ * 将消息投递到topic的死信队列
+ * @return 是否投递成功，投递成功后原消息可以ack
+ */
+func (j *Job) deadLetter(q Queue, topic string, message string, reason string, attempt int, lastErr string) bool {
+	d := DeadLetter{
+		Id:        GenUUID(),
+		Topic:     topic,
+		Message:   message,
+		Reason:    reason,
+		Attempt:   attempt,
+		LastError: lastErr,
+		FailedAt:  time.Now().Unix(),
+	}
+	s, _ := JsonEncode(d)
+	_, err := q.Enqueue(j.ctx, j.DeadLetterTopic(topic), s)
+	if err != nil {
+		j.logAndPrintln(Error, "dead_letter_error", topic, reason, message, err)
+		return false
+	}
+	atomic.AddInt64(&j.deadLetterCount, 1)
+	atomic.AddInt64(&j.counter(topic).deadLetter, 1)
+	j.logAndPrintln(Warn, "dead_letter", topic, reason, message, lastErr)
+	return true
+}
+
+//获取topic的Queue服务，需要实现BrowsableQueue接口
+func (j *Job) getBrowsableQueue(topic string) (BrowsableQueue, error) {
+	if !j.isQueueMapInit {
+		j.initQueueMap()
+	}
+	q := j.GetQueueByTopic(topic)
+	if q == nil {
+		return nil, ErrQueueNotExist
+	}
+	bq, ok := q.(BrowsableQueue)
+	if !ok {
+		return nil, ErrQueueNotBrowsable
+	}
+	return bq, nil
+}
+
+//死信队列的消息数
+func (j *Job) CountDeadLetters(ctx context.Context, topic string) (int64, error) {
+	bq, err := j.getBrowsableQueue(topic)
+	if err != nil {
+		return 0, err
+	}
+	return bq.Len(ctx, j.DeadLetterTopic(topic))
+}
+
+/**
+ * 分页查询死信队列的消息
+ * @param offset 起始位置，从0开始
+ * @param limit 数量
+ */
+func (j *Job) ListDeadLetters(ctx context.Context, topic string, offset int64, limit int64) ([]DeadLetter, error) {
+	bq, err := j.getBrowsableQueue(topic)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return []DeadLetter{}, nil
+	}
+
+	arr, err := bq.Range(ctx, j.DeadLetterTopic(topic), offset, offset+limit-1)
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(arr))
+	for _, s := range arr {
+		d, err := DecodeStringDeadLetter(s)
+		if err != nil {
+			j.logAndPrintln(Warn, "decode_dead_letter_error", topic, s, err)
+			continue
+		}
+		letters = append(letters, d)
+	}
+	return letters, nil
+}
+
+//查询死信队列中的某条消息
+func (j *Job) GetDeadLetter(ctx context.Context, topic string, id string) (DeadLetter, error) {
+	d, _, err := j.findDeadLetter(ctx, topic, id)
+	return d, err
+}
+
+/**
+ * 将死信消息重新投递到原topic，并从死信队列中移除
+ * 因重试耗尽进入死信队列的任务会重置已重试次数
+ */
+func (j *Job) RequeueDeadLetter(ctx context.Context, topic string, id string) (bool, error) {
+	d, raw, err := j.findDeadLetter(ctx, topic, id)
+	if err != nil {
+		return false, err
+	}
+
+	//无法解析的消息按原样以普通优先级投递
+	message := d.Message
+	priority := PriorityNormal
+	if task, err := DecodeStringTask(message); err == nil {
+		priority = task.Priority
+		if task.Attempt > 0 {
+			task.Attempt = 0
+			if message, err = JsonEncode(task); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	ok, err := j.enqueue(ctx, j.GetQueueByTopic(topic), topic, message, priority)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	bq, _ := j.getBrowsableQueue(topic)
+	return bq.Remove(ctx, j.DeadLetterTopic(topic), raw)
+}
+
+//清空死信队列
+func (j *Job) PurgeDeadLetters(ctx context.Context, topic string) (bool, error) {
+	bq, err := j.getBrowsableQueue(topic)
+	if err != nil {
+		return false, err
+	}
+	return bq.Purge(ctx, j.DeadLetterTopic(topic))
+}
+
+//在死信队列中逐页查找消息，返回解析后的消息和原始字符串
+func (j *Job) findDeadLetter(ctx context.Context, topic string, id string) (DeadLetter, string, error) {
+	bq, err := j.getBrowsableQueue(topic)
+	if err != nil {
+		return DeadLetter{}, "", err
+	}
+
+	key := j.DeadLetterTopic(topic)
+	for start := int64(0); ; start += deadLetterPageSize {
+		arr, err := bq.Range(ctx, key, start, start+deadLetterPageSize-1)
+		if err != nil {
+			return DeadLetter{}, "", err
+		}
+		for _, s := range arr {
+			d, err := DecodeStringDeadLetter(s)
+			if err == nil && d.Id == id {
+				return d, s, nil
+			}
+		}
+		if len(arr) < deadLetterPageSize {
+			return DeadLetter{}, "", ErrDeadLetterNotExist
+		}
+	}
+}
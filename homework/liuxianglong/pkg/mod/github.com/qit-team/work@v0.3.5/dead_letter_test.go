@@ -0,0 +1,108 @@
+package work
+
+import (
+	"context"
+	"testing"
+)
+
+//生成注册了topic的worker的Job，死信队列使用topic的queue
+func newDeadLetterJob(topic string) (*Job, *testPriorityQueue) {
+	q := newTestPriorityQueue()
+	j := newTestJob(q)
+	j.AddFunc(topic, func(task Task) TaskResult {
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	})
+	return j, q
+}
+
+//投递一条死信消息并返回死信id，投递失败时返回空字符串
+func addDeadLetter(j *Job, q Queue, topic string, message string) string {
+	if !j.deadLetter(q, topic, message, DeadReasonRetryExhausted, 3, "failed") {
+		return ""
+	}
+	letters, err := j.ListDeadLetters(context.TODO(), topic, 0, 10)
+	if err != nil || len(letters) == 0 {
+		return ""
+	}
+	return letters[len(letters)-1].Id
+}
+
+func TestRequeueDeadLetter(t *testing.T) {
+	ctx := context.TODO()
+	topic := "dlq:requeue"
+	j, q := newDeadLetterJob(topic)
+
+	task := GenTask(topic, "high")
+	task.Priority = PriorityHigh
+	task.Attempt = 3
+	s, _ := JsonEncode(task)
+	id := addDeadLetter(j, q, topic, s)
+	if id == "" {
+		t.Error("dead letter error")
+		return
+	}
+
+	ok, err := j.RequeueDeadLetter(ctx, topic, id)
+	if !ok || err != nil {
+		t.Error("requeue dead letter error", ok, err)
+		return
+	}
+	//按任务原有的优先级重新投递，并重置已重试次数
+	messages := q.messages(testPriorityKey(topic, PriorityHigh))
+	if len(messages) != 1 || len(q.messages(topic)) != 0 {
+		t.Error("dead letter must be requeued with its priority", messages, q.messages(topic))
+		return
+	}
+	requeued, _ := DecodeStringTask(messages[0].message)
+	if requeued.Id != task.Id || requeued.Attempt != 0 || requeued.Priority != PriorityHigh {
+		t.Error("requeued task error", requeued)
+		return
+	}
+	if n, _ := j.CountDeadLetters(ctx, topic); n != 0 {
+		t.Error("requeued dead letter must be removed", n)
+	}
+}
+
+func TestRequeueDeadLetter_raw(t *testing.T) {
+	ctx := context.TODO()
+	topic := "dlq:raw"
+	j, q := newDeadLetterJob(topic)
+	id := addDeadLetter(j, q, topic, "not a task")
+	if id == "" {
+		t.Error("dead letter error")
+		return
+	}
+
+	//无法解析的消息原样以普通优先级投递
+	ok, err := j.RequeueDeadLetter(ctx, topic, id)
+	if !ok || err != nil {
+		t.Error("requeue dead letter error", ok, err)
+		return
+	}
+	messages := q.messages(topic)
+	if len(messages) != 1 || messages[0].message != "not a task" {
+		t.Error("raw dead letter must be requeued as is", messages)
+	}
+}
+
+func TestRequeueDeadLetter_enqueueError(t *testing.T) {
+	ctx := context.TODO()
+	topic := "dlq:error"
+	j, q := newDeadLetterJob(topic)
+	id := addDeadLetter(j, q, topic, "message")
+	if id == "" {
+		t.Error("dead letter error")
+		return
+	}
+
+	//重新投递失败时保留死信消息
+	q.setFailEnqueue(true)
+	if ok, err := j.RequeueDeadLetter(ctx, topic, id); ok || err != errEnqueue {
+		t.Error("requeue must fail", ok, err)
+		return
+	}
+	q.setFailEnqueue(false)
+	if n, _ := j.CountDeadLetters(ctx, topic); n != 1 {
+		t.Error("dead letter must be kept", n)
+	}
+}
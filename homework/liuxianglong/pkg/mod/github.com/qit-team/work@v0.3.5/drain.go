@@ -0,0 +1,145 @@
+package work
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+//Job的运行状态：JobIdle -> JobRunning -> JobDraining -> JobStopped
+const (
+	//未启动
+	JobIdle = int32(iota)
+	//运行中
+	JobRunning
+	//停止拉取消息，等待处理中的任务完成
+	JobDraining
+	//已停止
+	JobStopped
+)
+
+//平滑关闭的结果
+type DrainReport struct {
+	//已拉取但未开始处理、成功放回队列的任务数
+	Requeued int `json:"requeued"`
+	//放回队列失败的任务，依赖Queue驱动的重新投递机制，否则会丢失
+	RequeueFailed []Task `json:"requeue_failed"`
+	//等待超时时仍在处理中的任务
+	Abandoned []Task `json:"abandoned"`
+	//等待耗时
+	Elapsed time.Duration `json:"elapsed"`
+	//是否等待超时
+	TimedOut bool `json:"timed_out"`
+}
+
+//Job当前的运行状态
+func (j *Job) State() int32 {
+	return atomic.LoadInt32(&j.state)
+}
+
+/**
+ * 平滑关闭Job：停止拉取消息，已拉取未处理的任务放回队列，等待处理中的任务完成
+ * @param timeout 等待处理中任务的超时时间，如果小于等于0则默认10秒
+ */
+func (j *Job) Shutdown(timeout time.Duration) DrainReport {
+	j.Stop()
+	return j.drain(timeout)
+}
+
+//等待处理中的任务完成，超时后取消处理中任务的ctx，并返回仍在处理中的任务
+func (j *Job) drain(timeout time.Duration) DrainReport {
+	if timeout <= 0 {
+		timeout = time.Second * 10
+	}
+
+	start := time.Now()
+	ch := make(chan struct{})
+	go func() {
+		j.wg.Wait()
+		close(ch)
+	}()
+	j.drainDone = ch
+
+	var report DrainReport
+	select {
+	case <-ch:
+	case <-time.After(timeout):
+		report.TimedOut = true
+	}
+	atomic.CompareAndSwapInt32(&j.state, JobDraining, JobStopped)
+
+	j.dLock.Lock()
+	report.Requeued = j.requeued
+	report.RequeueFailed = append([]Task{}, j.requeueFailed...)
+	for _, task := range j.inFlightTasks {
+		report.Abandoned = append(report.Abandoned, task)
+	}
+	j.dLock.Unlock()
+	report.Elapsed = time.Since(start)
+
+	//等待结束后才取消ctx，保证处理中的任务在超时前可以正常完成
+	if j.cancel != nil {
+		j.cancel()
+	}
+
+	for _, task := range report.Abandoned {
+		j.logAndPrintln(Warn, "drain_abandoned_task", task.Topic, task.Id)
+	}
+	for _, task := range report.RequeueFailed {
+		j.logAndPrintln(Warn, "drain_requeue_failed_task", task.Topic, task.Id)
+	}
+	j.println(Info, "drain finished", report.Requeued, len(report.RequeueFailed), len(report.Abandoned), report.Elapsed)
+	return report
+}
+
+//生成在Job开始停止(Stop)时即取消的ctx，用于等待令牌等尚未开始处理任务的场景
+func (j *Job) stopContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(j.runCtx)
+	stop := j.stopChan
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+//Job停止时将已拉取但未开始处理的任务重新入队，并ack原消息
+func (j *Job) requeueTask(q Queue, topic string, task Task) {
+	token := task.Token
+	task.Token = ""
+	_, err := j.EnqueueWithTask(j.ctx, topic, task)
+
+	j.dLock.Lock()
+	if err != nil {
+		j.requeueFailed = append(j.requeueFailed, task)
+	} else {
+		j.requeued++
+	}
+	j.dLock.Unlock()
+
+	if err != nil {
+		j.logAndPrintln(Error, "requeue_error", topic, task, err)
+		return
+	}
+	if token != "" {
+		if _, err := q.AckMsg(j.ctx, topic, token); err != nil {
+			j.logAndPrintln(Error, "ack_error", topic, task)
+		}
+	}
+}
+
+//记录处理中的任务，返回的函数用于处理完成后移除
+func (j *Job) trackTask(task Task) func() {
+	seq := atomic.AddInt64(&j.taskSeq, 1)
+	j.dLock.Lock()
+	j.inFlightTasks[seq] = task
+	j.dLock.Unlock()
+	return func() {
+		j.dLock.Lock()
+		delete(j.inFlightTasks, seq)
+		j.dLock.Unlock()
+	}
+}
@@ -0,0 +1,315 @@
+package work
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+//等待通道关闭，超时返回false
+func waitClosed(ch <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestShutdown_waitInFlight(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "drain:wait"
+	started := make(chan struct{})
+	j.AddContextFunc(topic, func(ctx context.Context, task Task) TaskResult {
+		close(started)
+		select {
+		case <-ctx.Done():
+			return TaskResult{Id: task.Id, State: StateFailed, Message: ctx.Err().Error()}
+		case <-time.After(100 * time.Millisecond):
+		}
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	}, 1)
+	j.Enqueue(context.TODO(), topic, "1")
+
+	if j.State() != JobIdle {
+		t.Error("job must be idle before start", j.State())
+		return
+	}
+	j.Start()
+	if j.State() != JobRunning {
+		t.Error("job must be running after start", j.State())
+		return
+	}
+	if !waitClosed(started, time.Second) {
+		t.Error("task is not started")
+		return
+	}
+
+	report := j.Shutdown(time.Second)
+	if report.TimedOut || len(report.Abandoned) != 0 {
+		t.Error("shutdown must wait for the in-flight task", report)
+		return
+	}
+	if j.State() != JobStopped {
+		t.Error("job must be stopped after shutdown", j.State())
+		return
+	}
+	//ctx在等待期间没有被取消，任务成功并ack
+	if q.ackedCount() != 1 {
+		t.Error("in-flight task must succeed while draining", q.ackedCount())
+	}
+}
+
+func TestStop_draining(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "drain:state"
+	release := make(chan struct{})
+	started := make(chan struct{})
+	j.AddFunc(topic, func(task Task) TaskResult {
+		close(started)
+		<-release
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	}, 1)
+	j.Enqueue(context.TODO(), topic, "1")
+
+	j.Start()
+	if !waitClosed(started, time.Second) {
+		t.Error("task is not started")
+		return
+	}
+	j.Stop()
+	if j.State() != JobDraining {
+		t.Error("job must be draining after stop", j.State())
+		return
+	}
+
+	close(release)
+	if err := j.WaitStop(time.Second); err != nil {
+		t.Error("wait stop error", err)
+		return
+	}
+	if j.State() != JobStopped {
+		t.Error("job must be stopped after wait stop", j.State())
+	}
+}
+
+func TestShutdown_timeout(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "drain:timeout"
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	j.AddContextFunc(topic, func(ctx context.Context, task Task) TaskResult {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return TaskResult{Id: task.Id, State: StateFailed, Message: ctx.Err().Error()}
+	}, 1)
+	j.Enqueue(context.TODO(), topic, "1")
+
+	j.Start()
+	if !waitClosed(started, time.Second) {
+		t.Error("task is not started")
+		return
+	}
+
+	report := j.Shutdown(50 * time.Millisecond)
+	if !report.TimedOut {
+		t.Error("shutdown must time out", report)
+		return
+	}
+	if len(report.Abandoned) != 1 || report.Abandoned[0].Message != "1" {
+		t.Error("abandoned tasks error", report.Abandoned)
+		return
+	}
+	//等待超时后取消处理中任务的ctx
+	if !waitClosed(cancelled, time.Second) {
+		t.Error("task ctx must be cancelled after the deadline")
+	}
+}
+
+func TestWaitStop_timeout(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "drain:wait_stop"
+	release := make(chan struct{})
+	started := make(chan struct{})
+	j.AddFunc(topic, func(task Task) TaskResult {
+		close(started)
+		<-release
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	}, 1)
+	j.Enqueue(context.TODO(), topic, "1")
+
+	j.Start()
+	if !waitClosed(started, time.Second) {
+		t.Error("task is not started")
+		return
+	}
+	j.Stop()
+	if err := j.WaitStop(50 * time.Millisecond); err != ErrTimeout {
+		t.Error("wait stop must return ErrTimeout", err)
+	}
+	close(release)
+}
+
+func TestStart_afterTimeout(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "drain:restart"
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	j.AddFunc(topic, func(task Task) TaskResult {
+		started <- struct{}{}
+		<-release
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	}, 1)
+	j.Enqueue(context.TODO(), topic, "1")
+
+	j.Start()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Error("task is not started")
+		return
+	}
+	if report := j.Shutdown(50 * time.Millisecond); !report.TimedOut {
+		t.Error("shutdown must time out", report)
+		return
+	}
+
+	//上一次停止时的任务未完成，不能重新启动
+	j.Start()
+	if j.State() != JobStopped {
+		t.Error("job must not restart before the abandoned task finishes", j.State())
+		return
+	}
+
+	close(release)
+	if !waitClosed(j.drainDone, time.Second) {
+		t.Error("drain is not done after the abandoned task finishes")
+		return
+	}
+	j.Start()
+	if j.State() != JobRunning {
+		t.Error("job must restart after the last drain is done", j.State())
+		return
+	}
+	if report := j.Shutdown(time.Second); report.TimedOut {
+		t.Error("shutdown error", report)
+	}
+}
+
+func TestPullTask_requeueOnStop(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "drain:requeue"
+	j.AddFunc(topic, func(task Task) TaskResult {
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	}, 1)
+	task := GenTask(topic, "1")
+	j.EnqueueWithTask(context.TODO(), topic, task)
+
+	//已拉取的任务没有worker接收时Job停止，任务放回队列并ack原消息
+	j.initWorkers()
+	j.initQueueMap()
+	<-j.concurrency[topic]
+	stop := make(chan struct{})
+	close(stop)
+	j.wg.Add(1)
+	j.pullTask(q, topic, stop)
+
+	report := j.drain(time.Second)
+	if report.Requeued != 1 || len(report.RequeueFailed) != 0 {
+		t.Error("requeue report error", report)
+		return
+	}
+	if q.ackedCount() != 1 {
+		t.Error("original message must be acked", q.ackedCount())
+		return
+	}
+	messages := q.messages(topic)
+	if len(messages) != 1 {
+		t.Error("task must be requeued", messages)
+		return
+	}
+	requeued, err := DecodeStringTask(messages[0].message)
+	if err != nil || requeued.Id != task.Id || requeued.Token != "" {
+		t.Error("requeued task error", requeued, err)
+		return
+	}
+	if len(j.concurrency[topic]) != 1 {
+		t.Error("concurrency token must be returned", len(j.concurrency[topic]))
+	}
+}
+
+func TestPullTask_requeueFailed(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "drain:requeue_failed"
+	j.AddFunc(topic, func(task Task) TaskResult {
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	}, 1)
+	j.Enqueue(context.TODO(), topic, "1")
+
+	j.initWorkers()
+	j.initQueueMap()
+	<-j.concurrency[topic]
+	stop := make(chan struct{})
+	close(stop)
+	q.setFailEnqueue(true)
+	j.wg.Add(1)
+	j.pullTask(q, topic, stop)
+
+	report := j.drain(time.Second)
+	if report.Requeued != 0 || len(report.RequeueFailed) != 1 || report.RequeueFailed[0].Message != "1" {
+		t.Error("requeue failed report error", report)
+		return
+	}
+	//放回失败时不ack，依赖Queue驱动重新投递
+	if q.ackedCount() != 0 {
+		t.Error("original message must not be acked", q.ackedCount())
+	}
+}
+
+//一直阻塞到ctx取消的限流器
+type blockingLimiter struct {
+	once    sync.Once
+	waiting chan struct{}
+}
+
+func (l *blockingLimiter) Wait(ctx context.Context) error {
+	l.once.Do(func() { close(l.waiting) })
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestShutdown_requeueWaitingLimiter(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "drain:limiter"
+	limiter := &blockingLimiter{waiting: make(chan struct{})}
+	j.AddFunc(topic, func(task Task) TaskResult {
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	}, 1, limiter)
+	j.Enqueue(context.TODO(), topic, "1")
+
+	j.Start()
+	if !waitClosed(limiter.waiting, time.Second) {
+		t.Error("task is not waiting for the limiter")
+		return
+	}
+
+	//等待令牌的任务还未开始处理，Job停止时立即放回队列
+	report := j.Shutdown(time.Second)
+	if report.TimedOut || report.Requeued != 1 {
+		t.Error("task waiting for the limiter must be requeued", report)
+		return
+	}
+	if len(q.messages(topic)) != 1 || q.ackedCount() != 1 {
+		t.Error("requeue error", q.messages(topic), q.ackedCount())
+	}
+}
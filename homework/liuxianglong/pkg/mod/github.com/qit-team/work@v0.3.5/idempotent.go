@@ -0,0 +1,96 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//入队去重key的前缀，完整key为 <prefix><topic>:<key>
+	uniqueKeyPrefix = "work:unique:"
+	//已处理任务标记的前缀，完整key为 <prefix><topic>:<task_id>
+	processedKeyPrefix = "work:processed:"
+)
+
+var (
+	ErrDuplicateTask         = errors.New("duplicate task")
+	ErrIdempotentStoreNotSet = errors.New("idempotent store is not set")
+)
+
+/**
+ * 幂等存储接口，入队去重和已处理任务标记依赖此接口，可以使用redis等实现
+ */
+type IdempotentStore interface {
+	//key不存在时写入并返回true，ttl后过期
+	SetNX(ctx context.Context, key string, ttl time.Duration) (ok bool, err error)
+	//key是否存在
+	Exists(ctx context.Context, key string) (ok bool, err error)
+	//删除key
+	Delete(ctx context.Context, key string) (err error)
+}
+
+//worker已处理任务标记的保留时长，作为AddFunc的可选参数使用，保留期内重复投递的任务会被直接ack
+type IdempotentTTL time.Duration
+
+//设置幂等存储
+func (j *Job) SetIdempotentStore(s IdempotentStore) {
+	j.idempotentStore = s
+}
+
+/**
+ * 带幂等key的消息入队，ttl时间内相同topic和key的任务只会入队一次
+ * 重复入队时返回ErrDuplicateTask
+ */
+func (j *Job) EnqueueUnique(ctx context.Context, topic string, task Task, key string, ttl time.Duration, args ...interface{}) (bool, error) {
+	if j.idempotentStore == nil {
+		return false, ErrIdempotentStoreNotSet
+	}
+
+	uniqueKey := uniqueKeyPrefix + topic + ":" + key
+	ok, err := j.idempotentStore.SetNX(ctx, uniqueKey, ttl)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		atomic.AddInt64(&j.counter(topic).duplicate, 1)
+		return false, ErrDuplicateTask
+	}
+
+	ok, err = j.EnqueueWithTask(ctx, topic, task, args...)
+	if err != nil || !ok {
+		//入队失败时释放幂等key，允许调用方重试
+		j.idempotentStore.Delete(ctx, uniqueKey)
+	}
+	return ok, err
+}
+
+//已处理任务的标记key
+func processedKey(topic string, id string) string {
+	return processedKeyPrefix + topic + ":" + id
+}
+
+//任务是否已经处理过，worker未开启幂等或者查询失败时返回false
+func (j *Job) isProcessed(w *Worker, topic string, task Task) bool {
+	if w.Idempotent <= 0 || j.idempotentStore == nil || task.Id == "" {
+		return false
+	}
+	ok, err := j.idempotentStore.Exists(j.ctx, processedKey(topic, task.Id))
+	if err != nil {
+		j.logAndPrintln(Warn, "idempotent_exists_error", topic, task.Id, err)
+		return false
+	}
+	return ok
+}
+
+//记录任务已处理
+func (j *Job) markProcessed(w *Worker, topic string, task Task) {
+	if w.Idempotent <= 0 || j.idempotentStore == nil || task.Id == "" {
+		return
+	}
+	_, err := j.idempotentStore.SetNX(j.ctx, processedKey(topic, task.Id), w.Idempotent)
+	if err != nil {
+		j.logAndPrintln(Warn, "idempotent_mark_error", topic, task.Id, err)
+	}
+}
@@ -0,0 +1,226 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errStore = errors.New("store error")
+
+//进程内的幂等存储，记录各key的ttl，不会过期
+type testIdempotentStore struct {
+	lock sync.Mutex
+	keys map[string]time.Duration
+	//为true时全部操作返回错误
+	fail bool
+}
+
+func newTestIdempotentStore() *testIdempotentStore {
+	return &testIdempotentStore{keys: make(map[string]time.Duration)}
+}
+
+func (s *testIdempotentStore) SetNX(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.fail {
+		return false, errStore
+	}
+	if _, ok := s.keys[key]; ok {
+		return false, nil
+	}
+	s.keys[key] = ttl
+	return true, nil
+}
+
+func (s *testIdempotentStore) Exists(ctx context.Context, key string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.fail {
+		return false, errStore
+	}
+	_, ok := s.keys[key]
+	return ok, nil
+}
+
+func (s *testIdempotentStore) Delete(ctx context.Context, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.fail {
+		return errStore
+	}
+	delete(s.keys, key)
+	return nil
+}
+
+func (s *testIdempotentStore) ttl(key string) (time.Duration, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ttl, ok := s.keys[key]
+	return ttl, ok
+}
+
+func (s *testIdempotentStore) setFail(fail bool) {
+	s.lock.Lock()
+	s.fail = fail
+	s.lock.Unlock()
+}
+
+//生成注册了topic的worker和幂等存储的Job
+func newIdempotentJob(topic string, f func(task Task) TaskResult, args ...interface{}) (*Job, *testQueue, *testIdempotentStore) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	s := newTestIdempotentStore()
+	j.SetIdempotentStore(s)
+	j.AddFunc(topic, f, args...)
+	j.initWorkers()
+	j.initQueueMap()
+	return j, q, s
+}
+
+func TestEnqueueUnique(t *testing.T) {
+	ctx := context.TODO()
+	topic := "unique:enqueue"
+	j, q, s := newIdempotentJob(topic, succeedTask)
+
+	ok, err := j.EnqueueUnique(ctx, topic, GenTask(topic, "1"), "order-1", time.Minute)
+	if !ok || err != nil {
+		t.Error("enqueue unique error", ok, err)
+		return
+	}
+	if ttl, _ := s.ttl(uniqueKeyPrefix + topic + ":order-1"); ttl != time.Minute {
+		t.Error("unique key ttl error", ttl)
+		return
+	}
+
+	//ttl内相同key的任务不会重复入队
+	ok, err = j.EnqueueUnique(ctx, topic, GenTask(topic, "2"), "order-1", time.Minute)
+	if ok || err != ErrDuplicateTask {
+		t.Error("duplicate task must be rejected", ok, err)
+		return
+	}
+	if len(q.messages(topic)) != 1 || j.TopicStats(topic).Duplicate != 1 {
+		t.Error("duplicate task must not be enqueued", q.messages(topic), j.TopicStats(topic).Duplicate)
+		return
+	}
+
+	//key按topic区分
+	j.AddFunc("unique:other", succeedTask)
+	j.initQueueMap()
+	if ok, err := j.EnqueueUnique(ctx, "unique:other", GenTask("unique:other", "1"), "order-1", time.Minute); !ok || err != nil {
+		t.Error("same key of another topic must be enqueued", ok, err)
+	}
+}
+
+func TestEnqueueUnique_releaseOnError(t *testing.T) {
+	ctx := context.TODO()
+	topic := "unique:release"
+	j, q, s := newIdempotentJob(topic, succeedTask)
+
+	//入队失败时释放幂等key，调用方可以重试
+	q.setFailEnqueue(true)
+	if ok, err := j.EnqueueUnique(ctx, topic, GenTask(topic, "1"), "order-1", time.Minute); ok || err != errEnqueue {
+		t.Error("enqueue error must be returned", ok, err)
+		return
+	}
+	if _, ok := s.ttl(uniqueKeyPrefix + topic + ":order-1"); ok {
+		t.Error("unique key must be released on enqueue error")
+		return
+	}
+	q.setFailEnqueue(false)
+	if ok, err := j.EnqueueUnique(ctx, topic, GenTask(topic, "1"), "order-1", time.Minute); !ok || err != nil {
+		t.Error("retry must be enqueued", ok, err)
+		return
+	}
+
+	//幂等存储出错时不入队
+	s.setFail(true)
+	if ok, err := j.EnqueueUnique(ctx, topic, GenTask(topic, "2"), "order-2", time.Minute); ok || err != errStore {
+		t.Error("store error must be returned", ok, err)
+		return
+	}
+	if len(q.messages(topic)) != 1 {
+		t.Error("task must not be enqueued on store error", q.messages(topic))
+	}
+}
+
+func TestEnqueueUnique_storeNotSet(t *testing.T) {
+	topic := "unique:not_set"
+	j := newTestJob(newTestQueue())
+	j.AddFunc(topic, succeedTask)
+	if ok, err := j.EnqueueUnique(context.TODO(), topic, GenTask(topic, "1"), "1", time.Minute); ok || err != ErrIdempotentStoreNotSet {
+		t.Error("idempotent store must be required", ok, err)
+	}
+}
+
+func TestIsProcessed(t *testing.T) {
+	topic := "unique:processed"
+	j, _, s := newIdempotentJob(topic, succeedTask, IdempotentTTL(time.Hour))
+	w := j.getWorker(topic)
+	task := GenTask(topic, "1")
+
+	if j.isProcessed(w, topic, task) {
+		t.Error("task must not be processed before mark")
+		return
+	}
+	j.markProcessed(w, topic, task)
+	if !j.isProcessed(w, topic, task) {
+		t.Error("task must be processed after mark")
+		return
+	}
+	if ttl, _ := s.ttl(processedKey(topic, task.Id)); ttl != time.Hour {
+		t.Error("processed key ttl error", ttl)
+		return
+	}
+
+	//未开启幂等的worker和没有id的任务不检查
+	if j.isProcessed(&Worker{}, topic, task) {
+		t.Error("worker without idempotent ttl must not check")
+		return
+	}
+	task.Id = ""
+	if j.isProcessed(w, topic, task) {
+		t.Error("task without id must not check")
+		return
+	}
+
+	//查询出错时按未处理执行
+	s.setFail(true)
+	task = GenTask(topic, "2")
+	if j.isProcessed(w, topic, task) {
+		t.Error("store error must be treated as not processed")
+	}
+}
+
+func TestProcessTask_skipProcessed(t *testing.T) {
+	ctx := context.TODO()
+	topic := "unique:skip"
+	handled := 0
+	j, q, _ := newIdempotentJob(topic, func(task Task) TaskResult {
+		handled++
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	}, IdempotentTTL(time.Hour))
+
+	//同一任务投递两次，第二次直接ack，不调用处理函数
+	task := GenTask(topic, "1")
+	j.EnqueueWithTask(ctx, topic, task)
+	j.EnqueueWithTask(ctx, topic, task)
+	for i := 0; i < 2; i++ {
+		message, token, _ := q.Dequeue(ctx, topic)
+		got, _ := DecodeStringTask(message)
+		got.Token = token
+		<-j.concurrency[topic]
+		j.wg.Add(1)
+		j.processTask(topic, got)
+	}
+
+	if handled != 1 {
+		t.Error("processed task must be skipped", handled)
+		return
+	}
+	if q.ackedCount() != 2 || j.TopicStats(topic).Skip != 1 {
+		t.Error("skipped task must be acked", q.ackedCount(), j.TopicStats(topic).Skip)
+	}
+}
@@ -37,6 +37,9 @@ type queueManger struct {
 type Job struct {
 	//上下文
 	ctx context.Context
+	//任务处理函数的上下文，Job平滑关闭等待超时时取消
+	runCtx context.Context
+	cancel context.CancelFunc
 
 	//workers及map锁
 	workers map[string]*Worker
@@ -55,14 +58,33 @@ type Job struct {
 
 	//work并发处理的等待暂停
 	wg sync.WaitGroup
-	//启动状态
-	running bool
+	//运行状态 JobIdle|JobRunning|JobDraining|JobStopped
+	state int32
+	//Job开始停止时关闭
+	stopChan chan struct{}
+
+	//平滑关闭相关：处理中的任务、放回队列的任务数和放回失败的任务
+	inFlightTasks map[int64]Task
+	taskSeq       int64
+	requeued      int
+	requeueFailed []Task
+	dLock         sync.Mutex
+	//上一次停止时等待的任务全部完成后关闭
+	drainDone chan struct{}
 	//异常状态时需要sleep时间
 	sleepy time.Duration
 	//通道定时器超时时间
 	timer time.Duration
 	//默认的worker并发数
 	con int
+	//各优先级的拉取权重
+	priorityWeights map[int]int
+	//topic的payload编码器
+	codecs map[string]Codec
+	//幂等存储 - 依赖外部注入
+	idempotentStore IdempotentStore
+	//任务组存储 - 依赖外部注入
+	groupStore GroupStore
 
 	//Queue服务 - 依赖外部注入
 	queueMangers []queueManger
@@ -94,6 +116,12 @@ type Job struct {
 	handleCount      int64
 	handleErrCount   int64
 	handlePanicCount int64
+	retryCount       int64
+	retryErrCount    int64
+	deadLetterCount  int64
+	//topic维度的统计
+	counters map[string]*topicCounter
+	sLock    sync.RWMutex
 
 	//回调函数
 	//任务返回失败回调函数
@@ -104,6 +132,8 @@ type Job struct {
 	taskBeforeCallback func(task Task)
 	//任务处理后回调
 	taskAfterCallback func(task Task, result TaskResult)
+	//任务ctx的回调
+	taskContextCallback func(ctx context.Context, task Task) context.Context
 }
 
 //topic是否开启 备注：空的时候默认启用全部
@@ -130,6 +160,15 @@ func (j *Job) initWorkers() {
 		if w.MaxConcurrency <= 0 {
 			w.MaxConcurrency = j.con
 		}
+		//批量worker每个任务占用一个并发数，并发数不能小于批量大小
+		if w.MaxConcurrency < w.BatchSize {
+			w.MaxConcurrency = w.BatchSize
+		}
+
+		//重新启动时沿用原有通道，上次停止超时仍在处理的任务完成后会归还并发数
+		if _, ok := j.concurrency[topic]; ok {
+			continue
+		}
 
 		//用来控制workers的并发数
 		j.concurrency[topic] = make(chan struct{}, w.MaxConcurrency)
@@ -187,35 +226,41 @@ func (j *Job) initQueueMap() {
 }
 
 //启动拉取队列数据服务
-func (j *Job) runQueues() {
+func (j *Job) runQueues(stop <-chan struct{}) {
 	for topic, queue := range j.queueMap {
 		if !j.isTopicEnable(topic) {
 			continue
 		}
-		go j.watchQueueTopic(queue, topic)
+		j.wg.Add(1)
+		go j.watchQueueTopic(queue, topic, stop)
 	}
 }
 
-//监听队列某个topic
-func (j *Job) watchQueueTopic(q Queue, topic string) {
+//监听队列某个topic，Job停止后退出
+func (j *Job) watchQueueTopic(q Queue, topic string, stop <-chan struct{}) {
+	defer j.wg.Done()
+
 	j.println(Info, "watch queue topic", topic)
 	j.cLock.RLock()
 	conChan := j.concurrency[topic]
 	j.cLock.RUnlock()
 
-	timer := time.NewTimer(j.timer)
 	for {
-		if !j.running {
+		//优先响应停止信号
+		select {
+		case <-stop:
 			j.println(Info, "stop watch queue topic", topic)
 			return
+		default:
 		}
 
 		select {
 		case <-conChan:
-			go j.pullTask(q, topic)
-		case <-timer.C:
-			timer.Reset(j.timer)
-			continue
+			j.wg.Add(1)
+			go j.pullTask(q, topic, stop)
+		case <-stop:
+			j.println(Info, "stop watch queue topic", topic)
+			return
 		}
 	}
 }
@@ -228,10 +273,9 @@ func (j *Job) setQueueMap(q Queue, topic string) {
 }
 
 //拉取队列消息
-func (j *Job) pullTask(q Queue, topic string) {
+func (j *Job) pullTask(q Queue, topic string, stop <-chan struct{}) {
 	var taskEnqueue bool
 
-	j.wg.Add(1)
 	defer func() {
 		j.wg.Done()
 
@@ -241,10 +285,13 @@ func (j *Job) pullTask(q Queue, topic string) {
 		}
 	}()
 
-	message, token, err := q.Dequeue(j.ctx, topic)
+	c := j.counter(topic)
+	message, token, err := j.dequeue(q, topic)
 	atomic.AddInt64(&j.pullCount, 1)
+	atomic.AddInt64(&c.pull, 1)
 	if err != nil && err != ErrNil {
 		atomic.AddInt64(&j.pullErrCount, 1)
+		atomic.AddInt64(&c.pullErr, 1)
 		j.logAndPrintln(Error, "dequeue_error", err, message)
 		time.Sleep(j.sleepy)
 		return
@@ -254,15 +301,24 @@ func (j *Job) pullTask(q Queue, topic string) {
 	if err == ErrNil || message == "" {
 		j.println(Trace, "return nil message", topic)
 		atomic.AddInt64(&j.pullEmptyCount, 1)
+		atomic.AddInt64(&c.pullEmpty, 1)
 		time.Sleep(j.sleepy)
 		return
 	}
 	atomic.AddInt64(&j.taskCount, 1)
+	atomic.AddInt64(&c.task, 1)
 
 	task, err := DecodeStringTask(message)
 	if err != nil {
 		atomic.AddInt64(&j.taskErrCount, 1)
+		atomic.AddInt64(&c.taskErr, 1)
 		j.logAndPrintln(Error, "decode_task_error", err, message)
+		//无法解析的消息放入死信队列，避免被反复投递
+		if j.deadLetter(q, topic, message, DeadReasonDecodeError, 0, err.Error()) && token != "" {
+			if _, err := q.AckMsg(j.ctx, topic, token); err != nil {
+				j.logAndPrintln(Error, "ack_error", topic, message)
+			}
+		}
 		time.Sleep(j.sleepy)
 		return
 	} else if task.Topic != "" {
@@ -280,6 +336,10 @@ func (j *Job) pullTask(q Queue, topic string) {
 			taskEnqueue = true
 			j.println(Debug, "taskChan push after", task, time.Now())
 			return
+		case <-stop:
+			//Job停止时还未开始处理的任务放回队列
+			j.requeueTask(q, topic, task)
+			return
 		case <-timer.C:
 			timer.Reset(j.timer)
 			continue
@@ -287,42 +347,66 @@ func (j *Job) pullTask(q Queue, topic string) {
 	}
 }
 
-func (j *Job) processJob() {
+func (j *Job) processJob(stop <-chan struct{}) {
 	for topic, taskChan := range j.tasksChan {
-		go j.processWork(topic, taskChan)
+		j.wg.Add(1)
+		go j.processWork(topic, taskChan, stop)
 	}
 }
 
-//读取通道数据分发到各个topic对应的worker进行处理
-func (j *Job) processWork(topic string, taskChan <-chan Task) {
+//读取通道数据分发到各个topic对应的worker进行处理，Job停止后退出
+func (j *Job) processWork(topic string, taskChan <-chan Task, stop <-chan struct{}) {
 	defer func() {
+		j.wg.Done()
 		if e := recover(); e != nil {
 			j.logAndPrintln(Error, "process_task_panic", e)
 		}
 	}()
 
-	timer := time.NewTimer(j.timer)
 	for {
+		//优先响应停止信号，停止后不再开始新任务
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
 		select {
 		case task := <-taskChan:
+			if w := j.getWorker(topic); w.BatchSize > 1 {
+				//批量worker凑满一批或者等待超时后再分发
+				tasks, ok := j.collectBatch(w, topic, task, taskChan, stop)
+				if !ok {
+					return
+				}
+				j.wg.Add(1)
+				go j.processBatch(topic, tasks)
+				continue
+			}
+			j.wg.Add(1)
 			go j.processTask(topic, task)
-		case <-timer.C:
-			timer.Reset(j.timer)
-			continue
+		case <-stop:
+			return
 		}
 	}
 }
 
 //处理task任务
 func (j *Job) processTask(topic string, task Task) TaskResult {
-	j.wg.Add(1)
+	c := j.counter(topic)
+	start := time.Now()
+	untrack := j.trackTask(task)
+	atomic.AddInt64(&c.inFlight, 1)
 	defer func() {
+		atomic.AddInt64(&c.inFlight, -1)
+		untrack()
 		j.wg.Done()
 		j.concurrency[topic] <- struct{}{}
 
 		//任务panic回调函数
 		if e := recover(); e != nil {
 			atomic.AddInt64(&j.handlePanicCount, 1)
+			atomic.AddInt64(&c.handlePanic, 1)
 			if j.taskPanicCallback != nil {
 				j.taskPanicCallback(task, e)
 			} else {
@@ -331,45 +415,125 @@ func (j *Job) processTask(topic string, task Task) TaskResult {
 		}
 	}()
 
-	j.wLock.RLock()
-	w := j.workers[topic]
-	j.wLock.RUnlock()
+	w := j.getWorker(topic)
+
+	//已处理过的重复投递任务直接ack
+	if j.isProcessed(w, topic, task) {
+		atomic.AddInt64(&c.skip, 1)
+		j.logAndPrintln(Info, "skip_processed_task", topic, task.Id)
+		j.ackTask(topic, task)
+		return TaskResult{Id: task.Id, State: StateSucceed, Message: "processed"}
+	}
+
+	//按限流器获取令牌，等待期间Job停止时任务放回队列
+	if !j.waitLimiter(w, c) {
+		j.requeueTask(j.GetQueueByTopic(topic), topic, task)
+		return TaskResult{Id: task.Id, State: StateFailed, Message: "job stopped"}
+	}
 
 	//任务处理前回调函数
 	if j.taskBeforeCallback != nil {
 		j.taskBeforeCallback(task)
 	}
 
-	result := w.Call.Run(task)
+	ctx, cancel := j.taskContext(w, task)
+	defer cancel()
+
+	var result TaskResult
+	if cw, ok := w.Call.(ContextWorkerFunc); ok {
+		result = cw.RunContext(ctx, task)
+	} else {
+		result = w.Call.Run(task)
+	}
 
 	//多线程安全加减
 	atomic.AddInt64(&j.handleCount, 1)
+	atomic.AddInt64(&c.handle, 1)
+	c.observe(time.Since(start))
+
+	j.handleResult(w, topic, task, result)
+	return result
+}
 
+//根据处理结果统计、重试、ack，并执行任务处理后回调
+func (j *Job) handleResult(w *Worker, topic string, task Task, result TaskResult) {
+	c := j.counter(topic)
 	var (
 		isAck     bool
 	)
 	switch result.State {
 	case StateSucceed:
-		isAck = true
+		//推进后续流程，失败时不ack，依赖Queue驱动重新投递
+		isAck = j.advanceFlow(topic, task) == nil
 	case StateFailedWithAck:
 		isAck = true
 		atomic.AddInt64(&j.handleErrCount, 1)
+		atomic.AddInt64(&c.handleErr, 1)
 	case StateFailed:
 		atomic.AddInt64(&j.handleErrCount, 1)
+		atomic.AddInt64(&c.handleErr, 1)
+		//配置了重试策略时由框架重新入队，原消息需要ack
+		if w.Retry != nil {
+			isAck = j.retryTask(topic, task, result, w.Retry)
+		}
+	}
+
+	if (result.State == StateSucceed && isAck) || result.State == StateFailedWithAck {
+		j.markProcessed(w, topic, task)
 	}
 
 	//消息ACK
-	if isAck && task.Token != "" {
-		_, err := j.GetQueueByTopic(topic).AckMsg(j.ctx, topic, task.Token)
-		if err != nil {
-			j.logAndPrintln(Error, "ack_error", topic, task)
-		}
+	if isAck {
+		j.ackTask(topic, task)
 	}
 
 	//任务处理后回调函数
 	if j.taskAfterCallback != nil {
 		j.taskAfterCallback(task, result)
 	}
+}
+
+//获取topic对应的worker
+func (j *Job) getWorker(topic string) *Worker {
+	j.wLock.RLock()
+	defer j.wLock.RUnlock()
+	return j.workers[topic]
+}
+
+//确认消息
+func (j *Job) ackTask(topic string, task Task) {
+	if task.Token == "" {
+		return
+	}
+	_, err := j.GetQueueByTopic(topic).AckMsg(j.ctx, topic, task.Token)
+	if err != nil {
+		j.logAndPrintln(Error, "ack_error", topic, task)
+	}
+}
 
-	return result
+/**
+ * 按重试策略将失败的任务延迟重新入队，达到最大执行次数后放入死信队列
+ * @return 原消息是否需要ack：重新入队或者放入死信队列成功时返回true
+ */
+func (j *Job) retryTask(topic string, task Task, result TaskResult, policy *RetryPolicy) bool {
+	attempt := task.Attempt + 1
+	task.Token = ""
+	if !policy.CanRetry(attempt) {
+		s, _ := JsonEncode(task)
+		return j.deadLetter(j.GetQueueByTopic(topic), topic, s, DeadReasonRetryExhausted, attempt, result.Message)
+	}
+
+	delay := policy.NextDelay(attempt)
+	task.Attempt = attempt
+	_, err := j.EnqueueWithTaskAfter(j.ctx, topic, task, delay)
+	if err != nil {
+		atomic.AddInt64(&j.retryErrCount, 1)
+		atomic.AddInt64(&j.counter(topic).retryErr, 1)
+		j.logAndPrintln(Error, "retry_enqueue_error", topic, task, err)
+		return false
+	}
+	atomic.AddInt64(&j.retryCount, 1)
+	atomic.AddInt64(&j.counter(topic).retry, 1)
+	j.println(Debug, "retry task", topic, task, delay)
+	return true
 }
@@ -3,14 +3,19 @@ package work
 import (
 	"time"
 	"context"
+	"sync/atomic"
 )
 
 func New() *Job {
 	j := new(Job)
 	j.ctx = context.Background()
+	j.runCtx = j.ctx
 	j.workers = make(map[string]*Worker)
 	j.concurrency = make(map[string]chan struct{})
 	j.tasksChan = make(map[string]chan Task)
+	j.counters = make(map[string]*topicCounter)
+	j.codecs = make(map[string]Codec)
+	j.inFlightTasks = make(map[int64]Task)
 	j.queueMap = make(map[string]Queue)
 	j.level = Info
 	j.consoleLevel = Info
@@ -20,66 +25,75 @@ func New() *Job {
 	return j
 }
 
+/**
+ * 启动Job
+ * 重新启动需要先调用WaitStop或Shutdown，且上一次停止时处理中的任务已全部完成
+ */
 func (j *Job) Start() {
-	if j.running {
+	state := j.State()
+	if state == JobRunning || state == JobDraining {
 		return
 	}
+	if j.drainDone != nil {
+		select {
+		case <-j.drainDone:
+		default:
+			j.logAndPrintln(Warn, "start_error", "tasks of the last run are still in process")
+			return
+		}
+	}
 
 	j.isInit = true
-	j.running = true
+	atomic.StoreInt32(&j.state, JobRunning)
+	j.stopChan = make(chan struct{})
+	j.requeued = 0
+	j.requeueFailed = nil
+	j.runCtx, j.cancel = context.WithCancel(j.ctx)
 	j.initWorkers()
 	j.initQueueMap()
-	j.runQueues()
-	j.processJob()
+	j.checkVisibilityTimeout()
+	j.runQueues(j.stopChan)
+	j.processJob(j.stopChan)
 }
 
 /**
- * 暂停Job
+ * 暂停Job：进入JobDraining状态，停止拉取消息
+ * 处理中任务的ctx不会被取消，需要调用WaitStop或Shutdown等待完成，等待超时后才会取消
  */
 func (j *Job) Stop() {
-	if !j.running {
+	if !atomic.CompareAndSwapInt32(&j.state, JobRunning, JobDraining) {
 		return
 	}
-	j.running = false
+	close(j.stopChan)
 }
 
 /**
  * 等待队列任务消费完成，可设置超时时间返回
+ * 需要完整的关闭结果时使用Shutdown
  * @param timeout 如果小于0则默认10秒
  */
 func (j *Job) WaitStop(timeout time.Duration) error {
-	ch := make(chan struct{})
-
-	time.Sleep(j.sleepy * 2)
-	if timeout <= 0 {
-		timeout = time.Second * 10
-	}
-
-	go func() {
-		j.wg.Wait()
-		close(ch)
-	}()
-
-	select {
-	case <-ch:
-		return nil
-	case <-time.After(timeout):
+	report := j.drain(timeout)
+	if report.TimedOut {
 		return ErrTimeout
 	}
-
 	return nil
 }
 
+/**
+ * 注册worker的任务投递回调函数
+ * args可选参数按类型识别：int为worker并发数，*RetryPolicy为失败重试策略
+ */
 func (j *Job) AddFunc(topic string, f func(task Task) (TaskResult), args ...interface{}) error {
-	//worker并发数
-	var concurrency int
-	if len(args) > 0 {
-		if c, ok := args[0].(int); ok {
-			concurrency = c
-		}
-	}
-	w := &Worker{Call: MyWorkerFunc(f), MaxConcurrency: concurrency}
-	return j.AddWorker(topic, w)
+	return j.AddWorker(topic, newWorker(MyWorkerFunc(f), args...))
+}
+
+/**
+ * 注册支持上下文的worker任务投递回调函数
+ * args可选参数按类型识别：int为worker并发数，*RetryPolicy为失败重试策略，time.Duration为单个任务的超时时间
+ */
+func (j *Job) AddContextFunc(topic string, f func(ctx context.Context, task Task) TaskResult, args ...interface{}) error {
+	return j.AddWorker(topic, newWorker(MyContextWorkerFunc(f), args...))
 }
 
 func (j *Job) AddWorker(topic string, w *Worker) error {
@@ -91,6 +105,7 @@ func (j *Job) AddWorker(topic string, w *Worker) error {
 	}
 
 	j.workers[topic] = w
+	j.counter(topic)
 
 	j.printf(Info, "topic(%s) concurrency %d\n", topic, w.MaxConcurrency)
 	return nil
@@ -107,6 +122,9 @@ func (j *Job) Stats() map[string]int64 {
 		"handle":       j.handleCount,
 		"handle_err":   j.handleErrCount,
 		"handle_panic": j.handlePanicCount,
+		"retry":        j.retryCount,
+		"retry_err":    j.retryErrCount,
+		"dead_letter":  j.deadLetterCount,
 	}
 }
 
@@ -148,6 +166,11 @@ func (j *Job) SetEnableTopics(topics ...string) {
 	j.enabledTopics = topics
 }
 
+//设置任务ctx的回调函数，可以往处理函数的ctx中注入trace_id等信息
+func (j *Job) RegisterTaskContextCallback(f func(ctx context.Context, task Task) context.Context) {
+	j.taskContextCallback = f
+}
+
 //设置任务处理前回调函数
 func (j *Job) RegisterTaskBeforeCallback(f func(task Task)) {
 	j.taskBeforeCallback = f
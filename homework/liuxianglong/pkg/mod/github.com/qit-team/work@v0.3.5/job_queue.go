@@ -1,6 +1,9 @@
 package work
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 //获取topic对应的queue服务
 func (j *Job) GetQueueByTopic(topic string) Queue {
@@ -45,11 +48,9 @@ func (j *Job) EnqueueWithTask(ctx context.Context, topic string, task Task, args
 		return false, ErrQueueNotExist
 	}
 
-	if task.Topic == "" {
-		task.Topic = topic
-	}
+	task = fillTask(topic, task)
 	s, _ := JsonEncode(task)
-	return q.Enqueue(ctx, topic, s, args...)
+	return j.enqueue(ctx, q, topic, s, task.Priority, args...)
 }
 
 //消息入队 -- 原始message
@@ -71,13 +72,30 @@ func (j *Job) BatchEnqueueWithTask(ctx context.Context, topic string, tasks []Ta
 		return false, ErrQueueNotExist
 	}
 
-	arr := make([]string, len(tasks))
+	arr := make([]Task, len(tasks))
 	for k, task := range tasks {
-		if task.Topic == "" {
-			task.Topic = topic
-		}
-		s, _ := JsonEncode(task)
-		arr[k] = s
+		arr[k] = fillTask(topic, task)
 	}
-	return q.BatchEnqueue(ctx, topic, arr, args...)
-}
\ No newline at end of file
+	return j.batchEnqueue(ctx, q, topic, arr, args...)
+}
+
+//延迟消息入队 -- 原始message，delay时长后才会被消费
+func (j *Job) EnqueueAfter(ctx context.Context, topic string, message string, delay time.Duration) (bool, error) {
+	task := GenTask(topic, message)
+	return j.EnqueueWithTaskAfter(ctx, topic, task, delay)
+}
+
+//定时消息入队 -- 原始message，at时间点后才会被消费
+func (j *Job) EnqueueAt(ctx context.Context, topic string, message string, at time.Time) (bool, error) {
+	return j.EnqueueAfter(ctx, topic, message, time.Until(at))
+}
+
+//延迟消息入队 -- Task数据结构
+func (j *Job) EnqueueWithTaskAfter(ctx context.Context, topic string, task Task, delay time.Duration) (bool, error) {
+	return j.EnqueueWithTask(ctx, topic, task, DelaySeconds(delay))
+}
+
+//定时消息入队 -- Task数据结构
+func (j *Job) EnqueueWithTaskAt(ctx context.Context, topic string, task Task, at time.Time) (bool, error) {
+	return j.EnqueueWithTaskAfter(ctx, topic, task, time.Until(at))
+}
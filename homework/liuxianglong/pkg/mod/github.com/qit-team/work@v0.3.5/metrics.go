@@ -0,0 +1,119 @@
+package work
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//指标名的前缀
+const metricsNamespace = "work"
+
+//计数器类型的指标
+var counterMetrics = []struct {
+	name  string
+	help  string
+	value func(s TopicStats) int64
+}{
+	{"pull_total", "Number of dequeue calls.", func(s TopicStats) int64 { return s.Pull }},
+	{"pull_errors_total", "Number of failed dequeue calls.", func(s TopicStats) int64 { return s.PullErr }},
+	{"pull_empty_total", "Number of dequeue calls without message.", func(s TopicStats) int64 { return s.PullEmpty }},
+	{"tasks_total", "Number of dequeued messages.", func(s TopicStats) int64 { return s.Task }},
+	{"task_errors_total", "Number of messages that could not be decoded.", func(s TopicStats) int64 { return s.TaskErr }},
+	{"handle_total", "Number of handled tasks.", func(s TopicStats) int64 { return s.Handle }},
+	{"handle_errors_total", "Number of tasks handled with a failed state.", func(s TopicStats) int64 { return s.HandleErr }},
+	{"handle_panics_total", "Number of tasks whose handler panicked.", func(s TopicStats) int64 { return s.HandlePanic }},
+	{"retry_total", "Number of tasks enqueued for retry.", func(s TopicStats) int64 { return s.Retry }},
+	{"retry_errors_total", "Number of tasks failed to enqueue for retry.", func(s TopicStats) int64 { return s.RetryErr }},
+	{"dead_letter_total", "Number of tasks moved to the dead letter queue.", func(s TopicStats) int64 { return s.DeadLetter }},
+	{"duplicate_total", "Number of tasks dropped on enqueue by the idempotency key.", func(s TopicStats) int64 { return s.Duplicate }},
+	{"skip_total", "Number of redelivered tasks skipped because they were processed.", func(s TopicStats) int64 { return s.Skip }},
+	{"throttled_total", "Number of tasks delayed by the rate limiter.", func(s TopicStats) int64 { return s.Throttled }},
+}
+
+/**
+ * 以Prometheus文本格式输出全部topic的统计指标
+ * Queue驱动实现了work.BrowsableQueue接口时会输出队列堆积数
+ */
+func (j *Job) WriteMetrics(ctx context.Context, w io.Writer) error {
+	stats := j.StatsByTopic()
+	bw := bufio.NewWriter(w)
+
+	for _, m := range counterMetrics {
+		writeMetricHeader(bw, m.name, m.help, "counter")
+		for _, s := range stats {
+			writeMetric(bw, m.name, s.Topic, "", strconv.FormatInt(m.value(s), 10))
+		}
+	}
+
+	writeMetricHeader(bw, "throttled_seconds_total", "Time spent waiting for the rate limiter.", "counter")
+	for _, s := range stats {
+		writeMetric(bw, "throttled_seconds_total", s.Topic, "", strconv.FormatFloat(s.ThrottledSeconds, 'g', -1, 64))
+	}
+
+	writeMetricHeader(bw, "in_flight", "Number of tasks being handled.", "gauge")
+	for _, s := range stats {
+		writeMetric(bw, "in_flight", s.Topic, "", strconv.FormatInt(s.InFlight, 10))
+	}
+
+	writeMetricHeader(bw, "concurrency", "Max concurrency of the worker.", "gauge")
+	for _, s := range stats {
+		writeMetric(bw, "concurrency", s.Topic, "", strconv.Itoa(s.Concurrency))
+	}
+
+	writeMetricHeader(bw, "queue_length", "Number of messages waiting in the queue.", "gauge")
+	for _, s := range stats {
+		n, err := j.QueueLen(ctx, s.Topic)
+		if err != nil {
+			continue
+		}
+		writeMetric(bw, "queue_length", s.Topic, "", strconv.FormatInt(n, 10))
+	}
+
+	writeMetricHeader(bw, "handle_duration_seconds", "Latency of the task handler.", "histogram")
+	for _, s := range stats {
+		for i, count := range s.Latency.Counts {
+			le := "+Inf"
+			if i < len(s.Latency.Buckets) {
+				le = strconv.FormatFloat(s.Latency.Buckets[i], 'g', -1, 64)
+			}
+			writeMetric(bw, "handle_duration_seconds_bucket", s.Topic, le, strconv.FormatInt(count, 10))
+		}
+		writeMetric(bw, "handle_duration_seconds_sum", s.Topic, "", strconv.FormatFloat(s.Latency.Sum, 'g', -1, 64))
+		writeMetric(bw, "handle_duration_seconds_count", s.Topic, "", strconv.FormatInt(s.Latency.Count, 10))
+	}
+
+	return bw.Flush()
+}
+
+//Prometheus文本格式的http接口，可以挂到job进程的管理端口上
+func (j *Job) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := j.WriteMetrics(r.Context(), w); err != nil {
+			j.logAndPrintln(Error, "write_metrics_error", err)
+		}
+	})
+}
+
+func writeMetricHeader(w io.Writer, name string, help string, typ string) {
+	fmt.Fprintf(w, "# HELP %s_%s %s\n", metricsNamespace, name, help)
+	fmt.Fprintf(w, "# TYPE %s_%s %s\n", metricsNamespace, name, typ)
+}
+
+func writeMetric(w io.Writer, name string, topic string, le string, value string) {
+	labels := `topic="` + escapeLabel(topic) + `"`
+	if le != "" {
+		labels += `,le="` + le + `"`
+	}
+	fmt.Fprintf(w, "%s_%s{%s} %s\n", metricsNamespace, name, labels, value)
+}
+
+//转义标签值中的反斜杠、双引号和换行
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,73 @@
+package work
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEscapeLabel(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"order", "order"},
+		{`a\b`, `a\\b`},
+		{`a"b"`, `a\"b\"`},
+		{"a\nb", `a\nb`},
+		{"\\\"\n", `\\\"\n`},
+	}
+	for _, c := range cases {
+		if got := escapeLabel(c.in); got != c.want {
+			t.Error("escape label error", c.in, got, c.want)
+		}
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "metrics:\"order\"\n"
+	j.AddFunc(topic, func(task Task) TaskResult {
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	}, 2)
+	j.Enqueue(context.TODO(), topic, "1")
+	c := j.counter(topic)
+	c.observe(5 * time.Millisecond)
+	c.observe(time.Minute)
+	c.handle = 2
+
+	var buf bytes.Buffer
+	if err := j.WriteMetrics(context.TODO(), &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	out := buf.String()
+	label := `topic="metrics:\"order\"\n"`
+	for _, line := range []string{
+		"# TYPE work_handle_total counter",
+		"work_handle_total{" + label + "} 2",
+		"work_concurrency{" + label + "} 2",
+		"work_queue_length{" + label + "} 1",
+		"# TYPE work_handle_duration_seconds histogram",
+		"work_handle_duration_seconds_bucket{" + label + `,le="0.005"} 1`,
+		"work_handle_duration_seconds_bucket{" + label + `,le="10"} 1`,
+		"work_handle_duration_seconds_bucket{" + label + `,le="+Inf"} 2`,
+		"work_handle_duration_seconds_sum{" + label + "} 60.005",
+		"work_handle_duration_seconds_count{" + label + "} 2",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Error("metrics must contain", line, out)
+			return
+		}
+	}
+	//标签值中的换行被转义，每一行都是完整的样本
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.HasPrefix(line, "# ") && !strings.HasPrefix(line, "work_") {
+			t.Error("broken metrics line", line)
+			return
+		}
+	}
+}
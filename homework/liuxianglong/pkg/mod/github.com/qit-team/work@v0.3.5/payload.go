@@ -0,0 +1,142 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+)
+
+var (
+	ErrInvalidPayloadFunc = errors.New("payload func must be func(ctx context.Context, task work.Task, payload T) work.TaskResult")
+	ErrCodecNotRegistered = errors.New("codec is not registered")
+)
+
+var (
+	contextType    = reflect.TypeOf((*context.Context)(nil)).Elem()
+	taskType       = reflect.TypeOf(Task{})
+	taskResultType = reflect.TypeOf(TaskResult{})
+)
+
+//设置topic的payload编码器，未设置时使用JSONCodec
+func (j *Job) SetTopicCodec(topic string, c Codec) {
+	j.wLock.Lock()
+	j.codecs[topic] = c
+	j.wLock.Unlock()
+}
+
+//topic的payload编码器
+func (j *Job) topicCodec(topic string) Codec {
+	j.wLock.RLock()
+	defer j.wLock.RUnlock()
+	if c, ok := j.codecs[topic]; ok {
+		return c
+	}
+	return JSONCodec
+}
+
+/**
+ * 按topic的编码器将payload编码为任务，编码器名称记录在任务的header中
+ * 需要设置优先级、header等信息时，可以修改返回的任务后再调用EnqueueWithTask
+ */
+func (j *Job) PayloadTask(topic string, payload interface{}) (Task, error) {
+	c := j.topicCodec(topic)
+	message, err := encodePayload(c, payload)
+	if err != nil {
+		return Task{}, err
+	}
+	task := GenTask(topic, message)
+	task.SetHeader(HeaderCodec, c.Name())
+	return task, nil
+}
+
+//将payload编码后入队 args约定同Enqueue
+func (j *Job) EnqueuePayload(ctx context.Context, topic string, payload interface{}, args ...interface{}) (bool, error) {
+	task, err := j.PayloadTask(topic, payload)
+	if err != nil {
+		return false, err
+	}
+	return j.EnqueueWithTask(ctx, topic, task, args...)
+}
+
+/**
+ * 将任务消息解码到v，v需要为指针
+ * 优先使用任务header中记录的编码器，没有记录时使用topic的编码器
+ */
+func (j *Job) DecodePayload(task Task, v interface{}) error {
+	c := j.topicCodec(task.Topic)
+	if name := task.GetHeader(HeaderCodec); name != "" {
+		var ok bool
+		if c, ok = GetCodec(name); !ok {
+			return ErrCodecNotRegistered
+		}
+	}
+	return decodePayload(c, task.Message, v)
+}
+
+/**
+ * 注册类型化的worker，处理函数的签名为 func(ctx context.Context, task work.Task, payload T) work.TaskResult
+ * T可以是结构体或者结构体指针，任务消息按编码器解码为T后传入；解码失败的任务放入死信队列，不会调用处理函数
+ * args可选参数同AddContextFunc，另外可以传入Codec设置topic的编码器
+ */
+func (j *Job) AddPayloadFunc(topic string, f interface{}, args ...interface{}) error {
+	fn := reflect.ValueOf(f)
+	t := fn.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 3 || t.NumOut() != 1 ||
+		t.In(0) != contextType || t.In(1) != taskType || t.Out(0) != taskResultType {
+		return ErrInvalidPayloadFunc
+	}
+
+	for _, arg := range args {
+		if c, ok := arg.(Codec); ok {
+			j.SetTopicCodec(topic, c)
+		}
+	}
+
+	pw := &payloadWorker{job: j, topic: topic, fn: fn, typ: t.In(2)}
+	return j.AddWorker(topic, newWorker(pw, args...))
+}
+
+//类型化的worker，调用处理函数前将任务消息解码为payload
+type payloadWorker struct {
+	job   *Job
+	topic string
+	fn    reflect.Value
+	typ   reflect.Type
+}
+
+func (w *payloadWorker) Run(task Task) TaskResult {
+	return w.RunContext(WithTask(context.Background(), task), task)
+}
+
+func (w *payloadWorker) RunContext(ctx context.Context, task Task) TaskResult {
+	var payload reflect.Value
+	if w.typ.Kind() == reflect.Ptr {
+		payload = reflect.New(w.typ.Elem())
+	} else {
+		payload = reflect.New(w.typ)
+	}
+
+	if err := w.job.DecodePayload(task, payload.Interface()); err != nil {
+		return w.job.payloadDecodeFailed(w.topic, task, err)
+	}
+
+	if w.typ.Kind() != reflect.Ptr {
+		payload = payload.Elem()
+	}
+	out := w.fn.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(task), payload})
+	return out[0].Interface().(TaskResult)
+}
+
+//payload解码失败的任务放入死信队列，放入成功时ack原消息，否则依赖Queue驱动重新投递
+func (j *Job) payloadDecodeFailed(topic string, task Task, err error) TaskResult {
+	atomic.AddInt64(&j.taskErrCount, 1)
+	atomic.AddInt64(&j.counter(topic).taskErr, 1)
+
+	task.Token = ""
+	s, _ := JsonEncode(task)
+	if j.deadLetter(j.GetQueueByTopic(topic), topic, s, DeadReasonPayloadDecodeError, task.Attempt, err.Error()) {
+		return TaskResult{Id: task.Id, State: StateFailedWithAck, Message: err.Error()}
+	}
+	return TaskResult{Id: task.Id, State: StateFailed, Message: err.Error()}
+}
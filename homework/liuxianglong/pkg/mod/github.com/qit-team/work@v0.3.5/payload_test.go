@@ -0,0 +1,159 @@
+package work
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+type testPayload struct {
+	OrderNo string `json:"order_no"`
+	Amount  int    `json:"amount"`
+}
+
+//json之外的编码器，消息按base64投递
+type testCodec struct{}
+
+func (testCodec) Name() string {
+	return "test"
+}
+
+func (testCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (testCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+//生成注册了payload worker的Job，返回payload worker
+func newPayloadJob(topic string, f interface{}, args ...interface{}) (*Job, *testQueue, ContextWorkerFunc, error) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	if err := j.AddPayloadFunc(topic, f, args...); err != nil {
+		return nil, nil, nil, err
+	}
+	j.initWorkers()
+	j.initQueueMap()
+	return j, q, j.getWorker(topic).Call.(ContextWorkerFunc), nil
+}
+
+func TestAddPayloadFunc_invalid(t *testing.T) {
+	j := newTestJob(newTestQueue())
+	invalid := []interface{}{
+		"not a func",
+		func(ctx context.Context, task Task) TaskResult { return TaskResult{} },
+		func(task Task, ctx context.Context, p testPayload) TaskResult { return TaskResult{} },
+		func(ctx context.Context, task *Task, p testPayload) TaskResult { return TaskResult{} },
+		func(ctx context.Context, task Task, p testPayload) error { return nil },
+		func(ctx context.Context, task Task, p testPayload) (TaskResult, error) { return TaskResult{}, nil },
+	}
+	for k, f := range invalid {
+		if err := j.AddPayloadFunc("payload:invalid", f); err != ErrInvalidPayloadFunc {
+			t.Error("invalid payload func must be rejected", k, err)
+			return
+		}
+	}
+}
+
+func TestAddPayloadFunc_struct(t *testing.T) {
+	topic := "payload:struct"
+	var got testPayload
+	j, _, w, err := newPayloadJob(topic, func(ctx context.Context, task Task, p testPayload) TaskResult {
+		got = p
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	})
+	if err != nil {
+		t.Error("add payload func error", err)
+		return
+	}
+
+	task, err := j.PayloadTask(topic, testPayload{OrderNo: "1", Amount: 100})
+	if err != nil || task.GetHeader(HeaderCodec) != JSONCodec.Name() {
+		t.Error("payload task error", task, err)
+		return
+	}
+	//json编码的消息原样投递
+	if task.Message != `{"order_no":"1","amount":100}` {
+		t.Error("json payload must be kept as is", task.Message)
+		return
+	}
+	if r := w.RunContext(context.TODO(), task); r.State != StateSucceed || got.OrderNo != "1" || got.Amount != 100 {
+		t.Error("payload must be decoded into struct", r, got)
+	}
+}
+
+func TestAddPayloadFunc_pointer(t *testing.T) {
+	RegisterCodec(testCodec{})
+	topic := "payload:pointer"
+	var got *testPayload
+	j, _, w, err := newPayloadJob(topic, func(ctx context.Context, task Task, p *testPayload) TaskResult {
+		got = p
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	}, testCodec{})
+	if err != nil {
+		t.Error("add payload func error", err)
+		return
+	}
+
+	//传入的Codec作为topic的编码器
+	task, err := j.PayloadTask(topic, &testPayload{OrderNo: "2"})
+	if err != nil || task.GetHeader(HeaderCodec) != "test" || task.Message == `{"order_no":"2","amount":0}` {
+		t.Error("payload must be encoded by topic codec", task, err)
+		return
+	}
+	if r := w.Run(task); r.State != StateSucceed || got == nil || got.OrderNo != "2" {
+		t.Error("payload must be decoded into pointer", r, got)
+	}
+}
+
+func TestAddPayloadFunc_decodeError(t *testing.T) {
+	topic := "payload:decode"
+	called := false
+	j, q, w, err := newPayloadJob(topic, func(ctx context.Context, task Task, p testPayload) TaskResult {
+		called = true
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	})
+	if err != nil {
+		t.Error("add payload func error", err)
+		return
+	}
+
+	//解码失败的任务放入死信队列并ack，不调用处理函数
+	task := GenTask(topic, "not json")
+	task.Token = "token"
+	r := w.RunContext(context.TODO(), task)
+	if called || r.State != StateFailedWithAck {
+		t.Error("undecodable task must not be handled", called, r)
+		return
+	}
+	letters := q.messages(j.DeadLetterTopic(topic))
+	if len(letters) != 1 {
+		t.Error("undecodable task must be dead lettered", letters)
+		return
+	}
+	d, _ := DecodeStringDeadLetter(letters[0].message)
+	dead, _ := DecodeStringTask(d.Message)
+	if d.Reason != DeadReasonPayloadDecodeError || dead.Id != task.Id || dead.Token != "" {
+		t.Error("dead letter error", d)
+		return
+	}
+	if j.TopicStats(topic).TaskErr != 1 {
+		t.Error("decode error must be counted", j.TopicStats(topic).TaskErr)
+		return
+	}
+
+	//任务header中的编码器未注册时同样放入死信队列
+	task = GenTask(topic, "{}")
+	task.SetHeader(HeaderCodec, "unknown")
+	if r := w.RunContext(context.TODO(), task); called || r.State != StateFailedWithAck || r.Message != ErrCodecNotRegistered.Error() {
+		t.Error("unknown codec must be dead lettered", called, r)
+		return
+	}
+
+	//死信队列投递失败时不ack，依赖Queue驱动重新投递
+	q.setFailEnqueue(true)
+	if r := w.RunContext(context.TODO(), GenTask(topic, "not json")); r.State != StateFailed {
+		t.Error("task must not be acked when dead letter fails", r)
+	}
+}
@@ -0,0 +1,153 @@
+package work
+
+import (
+	"context"
+	"math/rand"
+)
+
+//任务优先级
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+//从高到低的全部优先级
+var priorities = []int{PriorityHigh, PriorityNormal, PriorityLow}
+
+//默认的优先级权重，各优先级队列都有消息时，按权重比例优先拉取
+var defaultPriorityWeights = map[int]int{
+	PriorityHigh:   6,
+	PriorityNormal: 3,
+	PriorityLow:    1,
+}
+
+/**
+ * 可选接口：支持优先级的Queue驱动
+ * 未实现此接口的驱动会忽略任务的优先级
+ */
+type PriorityQueue interface {
+	//按优先级入队 args约定同Queue.Enqueue
+	EnqueuePriority(ctx context.Context, key string, message string, priority int, args ...interface{}) (isOk bool, err error)
+	//按优先级批量入队 args约定同Queue.BatchEnqueue
+	BatchEnqueuePriority(ctx context.Context, key string, messages []string, priority int, args ...interface{}) (isOk bool, err error)
+	//按priorities的顺序依次尝试出队，返回第一条消息
+	DequeuePriority(ctx context.Context, key string, priorities []int) (message string, token string, err error)
+}
+
+//规范化优先级，超出范围的按最高或最低处理
+func normalizePriority(priority int) int {
+	if priority > PriorityHigh {
+		return PriorityHigh
+	}
+	if priority < PriorityLow {
+		return PriorityLow
+	}
+	return priority
+}
+
+/**
+ * 设置各优先级的拉取权重，小于0的按0处理
+ * 各优先级都有消息时，按权重比例决定先拉取哪个优先级，低优先级的任务不会被饿死
+ */
+func (j *Job) SetPriorityWeights(high int, normal int, low int) {
+	j.priorityWeights = map[int]int{
+		PriorityHigh:   high,
+		PriorityNormal: normal,
+		PriorityLow:    low,
+	}
+}
+
+//本次拉取的优先级顺序：按权重随机选出首选优先级，其余按从高到低排列
+func (j *Job) priorityOrder() []int {
+	weights := j.priorityWeights
+	if weights == nil {
+		weights = defaultPriorityWeights
+	}
+
+	total := 0
+	for _, p := range priorities {
+		if weights[p] > 0 {
+			total += weights[p]
+		}
+	}
+
+	first := PriorityHigh
+	if total > 0 {
+		n := rand.Intn(total)
+		for _, p := range priorities {
+			if weights[p] <= 0 {
+				continue
+			}
+			if n < weights[p] {
+				first = p
+				break
+			}
+			n -= weights[p]
+		}
+	}
+
+	order := make([]int, 0, len(priorities))
+	order = append(order, first)
+	for _, p := range priorities {
+		if p != first {
+			order = append(order, p)
+		}
+	}
+	return order
+}
+
+//拉取消息，驱动支持优先级时按优先级顺序拉取
+func (j *Job) dequeue(q Queue, topic string) (string, string, error) {
+	if pq, ok := q.(PriorityQueue); ok {
+		return pq.DequeuePriority(j.ctx, topic, j.priorityOrder())
+	}
+	return q.Dequeue(j.ctx, topic)
+}
+
+//消息入队，非默认优先级且驱动支持优先级时按优先级入队
+func (j *Job) enqueue(ctx context.Context, q Queue, topic string, message string, priority int, args ...interface{}) (bool, error) {
+	priority = normalizePriority(priority)
+	if pq, ok := q.(PriorityQueue); ok && priority != PriorityNormal {
+		return pq.EnqueuePriority(ctx, topic, message, priority, args...)
+	}
+	return q.Enqueue(ctx, topic, message, args...)
+}
+
+//批量入队，按优先级分组后入队
+func (j *Job) batchEnqueue(ctx context.Context, q Queue, topic string, tasks []Task, args ...interface{}) (bool, error) {
+	pq, ok := q.(PriorityQueue)
+	if !ok || len(tasks) == 0 {
+		arr := make([]string, len(tasks))
+		for k, task := range tasks {
+			arr[k], _ = JsonEncode(task)
+		}
+		return q.BatchEnqueue(ctx, topic, arr, args...)
+	}
+
+	groups := make(map[int][]string)
+	for _, task := range tasks {
+		p := normalizePriority(task.Priority)
+		s, _ := JsonEncode(task)
+		groups[p] = append(groups[p], s)
+	}
+	for _, p := range priorities {
+		arr, ok := groups[p]
+		if !ok {
+			continue
+		}
+		var (
+			isOk bool
+			err  error
+		)
+		if p == PriorityNormal {
+			isOk, err = q.BatchEnqueue(ctx, topic, arr, args...)
+		} else {
+			isOk, err = pq.BatchEnqueuePriority(ctx, topic, arr, p, args...)
+		}
+		if err != nil || !isOk {
+			return isOk, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,126 @@
+package work
+
+import (
+	"context"
+	"testing"
+)
+
+//统计n次拉取中各优先级被首选的次数
+func firstPriorityCount(j *Job, n int) map[int]int {
+	count := make(map[int]int)
+	for i := 0; i < n; i++ {
+		order := j.priorityOrder()
+		if len(order) != len(priorities) {
+			return nil
+		}
+		count[order[0]]++
+	}
+	return count
+}
+
+func TestPriorityOrder_weights(t *testing.T) {
+	j := newTestJob(newTestQueue())
+	n := 10000
+	count := firstPriorityCount(j, n)
+	if count == nil {
+		t.Error("priority order must contain every priority")
+		return
+	}
+	//默认权重6:3:1，允许5%的误差
+	expected := map[int]int{PriorityHigh: 6000, PriorityNormal: 3000, PriorityLow: 1000}
+	for p, e := range expected {
+		if d := count[p] - e; d > n/20 || d < -n/20 {
+			t.Error("priority weights error", p, count)
+			return
+		}
+	}
+
+	//权重为0的优先级不会被首选，但仍在拉取顺序中
+	j.SetPriorityWeights(0, 0, 1)
+	if count := firstPriorityCount(j, 100); count[PriorityLow] != 100 {
+		t.Error("only low priority must be preferred", count)
+		return
+	}
+	if order := j.priorityOrder(); order[1] != PriorityHigh || order[2] != PriorityNormal {
+		t.Error("other priorities must follow from high to low", order)
+		return
+	}
+
+	//权重全部为0时按从高到低拉取
+	j.SetPriorityWeights(0, -1, 0)
+	if count := firstPriorityCount(j, 100); count[PriorityHigh] != 100 {
+		t.Error("high priority must be preferred without weights", count)
+	}
+}
+
+func TestNormalizePriority(t *testing.T) {
+	if normalizePriority(5) != PriorityHigh || normalizePriority(-5) != PriorityLow || normalizePriority(PriorityNormal) != PriorityNormal {
+		t.Error("priority must be normalized into range")
+	}
+}
+
+func TestEnqueue_priority(t *testing.T) {
+	ctx := context.TODO()
+	topic := "priority:enqueue"
+	q := newTestPriorityQueue()
+	j := newTestJob(q)
+	j.AddFunc(topic, succeedTask)
+
+	for _, p := range []int{PriorityLow, PriorityNormal, PriorityHigh, 3} {
+		task := GenTask(topic, "message")
+		task.Priority = p
+		j.EnqueueWithTask(ctx, topic, task)
+	}
+	//超出范围的优先级按最高处理，普通优先级使用Enqueue
+	if len(q.messages(testPriorityKey(topic, PriorityHigh))) != 2 ||
+		len(q.messages(topic)) != 1 || len(q.messages(testPriorityKey(topic, PriorityLow))) != 1 {
+		t.Error("tasks must be enqueued by priority", q.queues)
+		return
+	}
+
+	//按拉取顺序出队
+	j.SetPriorityWeights(0, 0, 1)
+	message, _, _ := j.dequeue(q, topic)
+	if task, _ := DecodeStringTask(message); task.Priority != PriorityLow {
+		t.Error("preferred priority must be dequeued first", task)
+	}
+}
+
+func TestBatchEnqueue_priority(t *testing.T) {
+	ctx := context.TODO()
+	topic := "priority:batch"
+	q := newTestPriorityQueue()
+	j := newTestJob(q)
+	j.AddFunc(topic, succeedTask)
+
+	tasks := make([]Task, 0, 5)
+	for _, p := range []int{PriorityHigh, PriorityNormal, PriorityLow, PriorityHigh, PriorityNormal} {
+		task := GenTask(topic, "message")
+		task.Priority = p
+		tasks = append(tasks, task)
+	}
+	if ok, err := j.BatchEnqueueWithTask(ctx, topic, tasks); !ok || err != nil {
+		t.Error("batch enqueue error", ok, err)
+		return
+	}
+	if len(q.messages(testPriorityKey(topic, PriorityHigh))) != 2 ||
+		len(q.messages(topic)) != 2 || len(q.messages(testPriorityKey(topic, PriorityLow))) != 1 {
+		t.Error("tasks must be grouped by priority", q.queues)
+	}
+}
+
+func TestEnqueue_priorityNotSupported(t *testing.T) {
+	ctx := context.TODO()
+	topic := "priority:unsupported"
+	q := newTestQueue()
+	j := newTestJob(q)
+	j.AddFunc(topic, succeedTask)
+
+	//驱动不支持优先级时忽略任务的优先级
+	task := GenTask(topic, "message")
+	task.Priority = PriorityHigh
+	j.EnqueueWithTask(ctx, topic, task)
+	if len(q.messages(topic)) != 1 {
+		t.Error("priority must be ignored", q.queues)
+	}
+}
@@ -0,0 +1,119 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+//订阅topic中topic与订阅组的分隔符，订阅组的topic为 <topic>#<group>
+const SubscriptionSeparator = "#"
+
+var ErrPubSubNotSupported = errors.New("queue does not support publish/subscribe")
+
+/**
+ * 可选接口：支持发布订阅的Queue驱动
+ * 发布到topic的消息会投递给topic的每个订阅组，订阅组以SubscriptionTopic(topic, group)为key出队、ack和重试，互不影响
+ */
+type PubSubQueue interface {
+	//发布消息 args约定同Queue.Enqueue
+	Publish(ctx context.Context, topic string, message string, args ...interface{}) (isOk bool, err error)
+	//批量发布消息 args约定同Queue.BatchEnqueue
+	BatchPublish(ctx context.Context, topic string, messages []string, args ...interface{}) (isOk bool, err error)
+}
+
+//订阅组的topic
+func SubscriptionTopic(topic string, group string) string {
+	return topic + SubscriptionSeparator + group
+}
+
+//解析订阅组的topic，不是订阅组的topic时ok为false
+func ParseSubscriptionTopic(s string) (topic string, group string, ok bool) {
+	i := strings.Index(s, SubscriptionSeparator)
+	if i <= 0 || i == len(s)-1 {
+		return s, "", false
+	}
+	return s[:i], s[i+1:], true
+}
+
+/**
+ * 订阅topic，同一个订阅组的多个进程竞争消费，不同订阅组各自收到全部消息
+ * 订阅组的worker以SubscriptionTopic(topic, group)注册，args约定同AddFunc；需要类型化的回调时可以直接使用AddPayloadFunc注册订阅组的topic
+ */
+func (j *Job) Subscribe(topic string, group string, f func(task Task) TaskResult, args ...interface{}) error {
+	return j.AddFunc(SubscriptionTopic(topic, group), f, args...)
+}
+
+//发布消息 -- 原始message
+func (j *Job) Publish(ctx context.Context, topic string, message string, args ...interface{}) (bool, error) {
+	return j.PublishWithTask(ctx, topic, GenTask(topic, message), args...)
+}
+
+//发布消息 -- Task数据结构
+func (j *Job) PublishWithTask(ctx context.Context, topic string, task Task, args ...interface{}) (bool, error) {
+	q, err := j.getPubSubQueue(topic)
+	if err != nil {
+		return false, err
+	}
+	task = fillTask(topic, task)
+	s, _ := JsonEncode(task)
+	return q.Publish(ctx, topic, s, args...)
+}
+
+//批量发布消息 -- Task数据结构
+func (j *Job) BatchPublishWithTask(ctx context.Context, topic string, tasks []Task, args ...interface{}) (bool, error) {
+	q, err := j.getPubSubQueue(topic)
+	if err != nil {
+		return false, err
+	}
+	arr := make([]string, len(tasks))
+	for k, task := range tasks {
+		arr[k], _ = JsonEncode(fillTask(topic, task))
+	}
+	return q.BatchPublish(ctx, topic, arr, args...)
+}
+
+/**
+ * 获取topic发布使用的Queue服务
+ * 依次查找：订阅组topic映射的queue、AddQueue时指定了该topic的queue、默认queue
+ */
+func (j *Job) getPubSubQueue(topic string) (PubSubQueue, error) {
+	if !j.isQueueMapInit {
+		j.initQueueMap()
+	}
+
+	var q Queue
+	prefix := topic + SubscriptionSeparator
+	j.qLock.RLock()
+	for t, tq := range j.queueMap {
+		if t == topic || strings.HasPrefix(t, prefix) {
+			q = tq
+			break
+		}
+	}
+	j.qLock.RUnlock()
+
+	for _, qm := range j.queueMangers {
+		if q != nil {
+			break
+		}
+		for _, t := range qm.topics {
+			if t == topic {
+				q = qm.queue
+				break
+			}
+		}
+	}
+	if q == nil {
+		q = j.defaultQueue
+	}
+	if q == nil {
+		return nil, ErrQueueNotExist
+	}
+
+	pq, ok := q.(PubSubQueue)
+	if !ok {
+		return nil, ErrPubSubNotSupported
+	}
+	return pq, nil
+}
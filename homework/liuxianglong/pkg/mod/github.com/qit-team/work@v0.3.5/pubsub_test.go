@@ -0,0 +1,139 @@
+package work
+
+import (
+	"context"
+	"testing"
+)
+
+//支持发布订阅的testQueue，发布的消息入队到各订阅组的topic
+type testPubSubQueue struct {
+	*testQueue
+	groups []string
+}
+
+func newTestPubSubQueue(groups ...string) *testPubSubQueue {
+	return &testPubSubQueue{testQueue: newTestQueue(), groups: groups}
+}
+
+func (q *testPubSubQueue) Publish(ctx context.Context, topic string, message string, args ...interface{}) (bool, error) {
+	return q.BatchPublish(ctx, topic, []string{message}, args...)
+}
+
+func (q *testPubSubQueue) BatchPublish(ctx context.Context, topic string, messages []string, args ...interface{}) (bool, error) {
+	for _, group := range q.groups {
+		if ok, err := q.BatchEnqueue(ctx, SubscriptionTopic(topic, group), messages, args...); !ok || err != nil {
+			return ok, err
+		}
+	}
+	return true, nil
+}
+
+func TestParseSubscriptionTopic(t *testing.T) {
+	s := SubscriptionTopic("user.login", "notify")
+	if s != "user.login"+SubscriptionSeparator+"notify" {
+		t.Error("subscription topic error", s)
+		return
+	}
+	if topic, group, ok := ParseSubscriptionTopic(s); !ok || topic != "user.login" || group != "notify" {
+		t.Error("parse subscription topic error", topic, group, ok)
+		return
+	}
+	//缺少topic或订阅组时不是订阅组的topic
+	for _, s := range []string{"user.login", "#notify", "user.login#"} {
+		if topic, _, ok := ParseSubscriptionTopic(s); ok || topic != s {
+			t.Error("invalid subscription topic must not be parsed", s)
+			return
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	j := newTestJob(newTestPubSubQueue())
+	f := func(task Task) TaskResult {
+		return TaskResult{Id: task.Id, State: StateSucceed}
+	}
+	if err := j.Subscribe("pubsub:sub", "notify", f, 2); err != nil {
+		t.Error("subscribe error", err)
+		return
+	}
+	//订阅组的worker以订阅组的topic注册
+	w := j.getWorker(SubscriptionTopic("pubsub:sub", "notify"))
+	if w == nil || w.MaxConcurrency != 2 {
+		t.Error("subscription worker error", w)
+		return
+	}
+	if err := j.Subscribe("pubsub:sub", "notify", f); err != ErrTopicRegistered {
+		t.Error("group must be subscribed once", err)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.TODO()
+	topic := "pubsub:publish"
+	q := newTestPubSubQueue("notify", "stats")
+	j := newTestJob(newTestQueue())
+	//发布订阅的queue通过订阅组的topic映射
+	j.AddQueue(q, topic, SubscriptionTopic(topic, "notify"), SubscriptionTopic(topic, "stats"))
+	j.Subscribe(topic, "notify", succeedTask)
+	j.Subscribe(topic, "stats", succeedTask)
+
+	if ok, err := j.Publish(ctx, topic, "login"); !ok || err != nil {
+		t.Error("publish error", ok, err)
+		return
+	}
+	task := GenTask(topic, "logout")
+	task.Topic = ""
+	if ok, err := j.BatchPublishWithTask(ctx, topic, []Task{task}); !ok || err != nil {
+		t.Error("batch publish error", ok, err)
+		return
+	}
+
+	//每个订阅组都收到全部消息
+	for _, group := range q.groups {
+		messages := q.messages(SubscriptionTopic(topic, group))
+		if len(messages) != 2 {
+			t.Error("every group must receive all messages", group, messages)
+			return
+		}
+		first, _ := DecodeStringTask(messages[0].message)
+		second, _ := DecodeStringTask(messages[1].message)
+		if first.Message != "login" || second.Message != "logout" || second.Topic != topic {
+			t.Error("published task error", first, second)
+			return
+		}
+	}
+}
+
+func TestPublish_defaultQueue(t *testing.T) {
+	ctx := context.TODO()
+	topic := "pubsub:default"
+	q := newTestPubSubQueue("notify")
+	j := newTestJob(q)
+
+	//没有注册订阅组时使用默认queue发布
+	if ok, err := j.Publish(ctx, topic, "login"); !ok || err != nil {
+		t.Error("publish error", ok, err)
+		return
+	}
+	if len(q.messages(SubscriptionTopic(topic, "notify"))) != 1 {
+		t.Error("message must be published by default queue", q.queues)
+	}
+}
+
+func TestPublish_notSupported(t *testing.T) {
+	ctx := context.TODO()
+	topic := "pubsub:unsupported"
+
+	j := newTestJob(newTestQueue())
+	j.Subscribe(topic, "notify", succeedTask)
+	if ok, err := j.Publish(ctx, topic, "login"); ok || err != ErrPubSubNotSupported {
+		t.Error("queue without publish must be rejected", ok, err)
+		return
+	}
+
+	j = New()
+	j.SetConsoleLevel(None)
+	if ok, err := j.Publish(ctx, topic, "login"); ok || err != ErrQueueNotExist {
+		t.Error("queue must be required", ok, err)
+	}
+}
@@ -3,15 +3,74 @@ package work
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 var (
 	ErrNil = errors.New("return nil")
 )
 
+/**
+ * 队列驱动接口
+ * 入队的可选参数args约定：args[0]为int64类型的延迟秒数，驱动不支持延迟时可忽略
+ */
 type Queue interface {
 	Enqueue(ctx context.Context, key string, message string, args ...interface{}) (isOk bool, err error)
 	Dequeue(ctx context.Context, key string) (message string, token string, err error)
 	AckMsg(ctx context.Context, key string, token string) (ok bool, err error)
 	BatchEnqueue(ctx context.Context, key string, messages []string, args ...interface{}) (isOk bool, err error)
 }
+
+/**
+ * 可选接口：支持查看和管理队列内消息的Queue驱动
+ * 死信队列的查询、重放和清理依赖此接口
+ */
+type BrowsableQueue interface {
+	//队列消息数
+	Len(ctx context.Context, key string) (n int64, err error)
+	//按位置查看消息，start和stop从0开始且包含stop
+	Range(ctx context.Context, key string, start int64, stop int64) (messages []string, err error)
+	//移除一条消息
+	Remove(ctx context.Context, key string, message string) (ok bool, err error)
+	//清空队列
+	Purge(ctx context.Context, key string) (ok bool, err error)
+}
+
+/**
+ * 可选接口：出队后有可见性超时的Queue驱动
+ * 超过可见性超时仍未ack的消息会被重新投递，worker的任务超时时间需要小于可见性超时
+ */
+type VisibilityQueue interface {
+	//可见性超时时间
+	VisibilityTimeout() time.Duration
+}
+
+/**
+ * 检查worker的任务超时时间是否小于queue的可见性超时，不小于时处理中的任务会被重复投递，记录警告
+ * 批量worker的任务在凑批期间已经出队，按任务超时时间加凑批等待时间检查
+ * @return 需要调整超时时间的topic
+ */
+func (j *Job) checkVisibilityTimeout() []string {
+	j.wLock.RLock()
+	defer j.wLock.RUnlock()
+
+	topics := make([]string, 0)
+	for topic, w := range j.workers {
+		if !j.isTopicEnable(topic) || w.Timeout <= 0 {
+			continue
+		}
+		vq, ok := j.GetQueueByTopic(topic).(VisibilityQueue)
+		if !ok {
+			continue
+		}
+		timeout := w.Timeout
+		if w.BatchSize > 1 {
+			timeout += w.BatchWait
+		}
+		if vt := vq.VisibilityTimeout(); timeout >= vt {
+			j.logfAndPrintf(Warn, "visibility_timeout_warning topic(%s) worker timeout %s is not less than visibility timeout %s\n", topic, timeout, vt)
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
@@ -0,0 +1,223 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errEnqueue = errors.New("enqueue error")
+
+//入队的一条消息及其延迟秒数
+type testMessage struct {
+	message string
+	delay   int64
+}
+
+//进程内的Queue驱动，用于测试Job的拉取、ack和重新入队，延迟消息会被立即投递
+type testQueue struct {
+	lock sync.Mutex
+	//各key待出队的消息
+	queues map[string][]testMessage
+	//已出队未ack的消息，key为token
+	pending map[string]string
+	//已ack的消息
+	acked []string
+	seq   int
+	//为true时入队返回错误
+	failEnqueue bool
+}
+
+func newTestQueue() *testQueue {
+	return &testQueue{
+		queues:  make(map[string][]testMessage),
+		pending: make(map[string]string),
+	}
+}
+
+func (q *testQueue) Enqueue(ctx context.Context, key string, message string, args ...interface{}) (bool, error) {
+	return q.BatchEnqueue(ctx, key, []string{message}, args...)
+}
+
+func (q *testQueue) BatchEnqueue(ctx context.Context, key string, messages []string, args ...interface{}) (bool, error) {
+	var delay int64
+	if len(args) > 0 {
+		delay, _ = args[0].(int64)
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.failEnqueue {
+		return false, errEnqueue
+	}
+	for _, message := range messages {
+		q.queues[key] = append(q.queues[key], testMessage{message: message, delay: delay})
+	}
+	return true, nil
+}
+
+func (q *testQueue) Dequeue(ctx context.Context, key string) (string, string, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.queues[key]) == 0 {
+		return "", "", nil
+	}
+	m := q.queues[key][0]
+	q.queues[key] = q.queues[key][1:]
+	q.seq++
+	token := strconv.Itoa(q.seq)
+	q.pending[token] = m.message
+	return m.message, token, nil
+}
+
+func (q *testQueue) AckMsg(ctx context.Context, key string, token string) (bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	message, ok := q.pending[token]
+	if !ok {
+		return false, nil
+	}
+	delete(q.pending, token)
+	q.acked = append(q.acked, message)
+	return true, nil
+}
+
+func (q *testQueue) Len(ctx context.Context, key string) (int64, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return int64(len(q.queues[key])), nil
+}
+
+func (q *testQueue) Range(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	arr := make([]string, 0)
+	for i, m := range q.queues[key] {
+		if int64(i) >= start && int64(i) <= stop {
+			arr = append(arr, m.message)
+		}
+	}
+	return arr, nil
+}
+
+func (q *testQueue) Remove(ctx context.Context, key string, message string) (bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for i, m := range q.queues[key] {
+		if m.message == message {
+			q.queues[key] = append(q.queues[key][:i], q.queues[key][i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (q *testQueue) Purge(ctx context.Context, key string) (bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	delete(q.queues, key)
+	return true, nil
+}
+
+//key中待出队的消息
+func (q *testQueue) messages(key string) []testMessage {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return append([]testMessage{}, q.queues[key]...)
+}
+
+//已ack的消息数
+func (q *testQueue) ackedCount() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.acked)
+}
+
+func (q *testQueue) setFailEnqueue(fail bool) {
+	q.lock.Lock()
+	q.failEnqueue = fail
+	q.lock.Unlock()
+}
+
+//支持优先级的testQueue，非默认优先级的消息存放在 <key>:<priority>
+type testPriorityQueue struct {
+	*testQueue
+}
+
+func newTestPriorityQueue() *testPriorityQueue {
+	return &testPriorityQueue{newTestQueue()}
+}
+
+func testPriorityKey(key string, priority int) string {
+	if priority == PriorityNormal {
+		return key
+	}
+	return key + ":" + strconv.Itoa(priority)
+}
+
+func (q *testPriorityQueue) EnqueuePriority(ctx context.Context, key string, message string, priority int, args ...interface{}) (bool, error) {
+	return q.Enqueue(ctx, testPriorityKey(key, priority), message, args...)
+}
+
+func (q *testPriorityQueue) BatchEnqueuePriority(ctx context.Context, key string, messages []string, priority int, args ...interface{}) (bool, error) {
+	return q.BatchEnqueue(ctx, testPriorityKey(key, priority), messages, args...)
+}
+
+func (q *testPriorityQueue) DequeuePriority(ctx context.Context, key string, priorities []int) (string, string, error) {
+	for _, p := range priorities {
+		message, token, err := q.Dequeue(ctx, testPriorityKey(key, p))
+		if err != nil || message != "" {
+			return message, token, err
+		}
+	}
+	return "", "", nil
+}
+
+//处理成功的worker回调
+func succeedTask(task Task) TaskResult {
+	return TaskResult{Id: task.Id, State: StateSucceed}
+}
+
+//生成使用testQueue、不输出日志的Job
+func newTestJob(q Queue) *Job {
+	j := New()
+	j.SetConsoleLevel(None)
+	j.SetSleepy(time.Millisecond)
+	j.AddQueue(q)
+	return j
+}
+
+//有可见性超时的testQueue
+type testVisibilityQueue struct {
+	*testQueue
+	timeout time.Duration
+}
+
+func (q *testVisibilityQueue) VisibilityTimeout() time.Duration {
+	return q.timeout
+}
+
+func TestCheckVisibilityTimeout(t *testing.T) {
+	q := &testVisibilityQueue{testQueue: newTestQueue(), timeout: 30 * time.Second}
+	j := newTestJob(newTestQueue())
+	j.AddQueue(q, "visibility:long", "visibility:short", "visibility:none", "visibility:batch")
+	j.AddContextFunc("visibility:long", nil, 30*time.Second)
+	j.AddContextFunc("visibility:short", nil, 10*time.Second)
+	j.AddContextFunc("visibility:none", nil)
+	j.AddBatchFunc("visibility:batch", nil, 10, 15*time.Second, 20*time.Second)
+	//没有可见性超时的queue不检查
+	j.AddContextFunc("visibility:plain", nil, time.Minute)
+	j.initWorkers()
+	j.initQueueMap()
+
+	//任务超时时间不小于可见性超时的worker需要警告，批量worker计入凑批等待时间
+	topics := j.checkVisibilityTimeout()
+	sort.Strings(topics)
+	if len(topics) != 2 || topics[0] != "visibility:batch" || topics[1] != "visibility:long" {
+		t.Error("visibility timeout check error", topics)
+	}
+}
@@ -0,0 +1,118 @@
+package work
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 限流器接口，任务分发给worker处理前会先获取令牌
+ * 可以使用本地令牌桶NewTokenBucket，或者基于redis等实现多进程共享的限流
+ */
+type Limiter interface {
+	//阻塞直到获取到令牌，ctx取消时返回错误
+	Wait(ctx context.Context) error
+}
+
+//本地令牌桶限流器
+type TokenBucket struct {
+	//每秒生成的令牌数
+	rate float64
+	//桶容量，即允许的突发数
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+/**
+ * 生成令牌桶限流器
+ * @param rate 每秒允许的任务数
+ * @param burst 允许的突发任务数，小于1时按1处理
+ */
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+//预占一个令牌，返回需要等待的时间，0表示立即可用
+func (b *TokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+//获取令牌，令牌不足时等待
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	if b.rate <= 0 {
+		return nil
+	}
+	wait := b.reserve()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		//归还预占的令牌
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+/**
+ * 任务处理前按worker的限流器获取令牌，并记录被限流的次数和时长
+ * @return 是否获取到令牌，Job停止时返回false
+ */
+func (j *Job) waitLimiter(w *Worker, c *topicCounter) bool {
+	if w.Limiter == nil {
+		return true
+	}
+
+	ctx, cancel := j.stopContext()
+	defer cancel()
+
+	start := time.Now()
+	err := w.Limiter.Wait(ctx)
+	if d := time.Since(start); d > time.Millisecond {
+		atomic.AddInt64(&c.throttled, 1)
+		atomic.AddInt64(&c.throttledTime, int64(d))
+	}
+	if err == nil {
+		return true
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	//限流器异常(如redis不可用)时不阻塞任务处理
+	j.logAndPrintln(Warn, "limiter_error", err)
+	return true
+}
@@ -0,0 +1,133 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_reserve(t *testing.T) {
+	b := NewTokenBucket(10, 3)
+
+	//桶满时可以立即获取burst个令牌
+	for i := 0; i < 3; i++ {
+		if wait := b.reserve(); wait != 0 {
+			t.Error("burst tokens must be available", i, wait)
+			return
+		}
+	}
+	//令牌不足时按生成速率等待
+	if wait := b.reserve(); wait < 90*time.Millisecond || wait > 100*time.Millisecond {
+		t.Error("reserve must wait for the next token", wait)
+		return
+	}
+
+	//空闲时按速率补充令牌，不超过桶容量
+	b.mu.Lock()
+	b.last = b.last.Add(-time.Hour)
+	b.mu.Unlock()
+	b.reserve()
+	b.mu.Lock()
+	tokens := b.tokens
+	b.mu.Unlock()
+	if tokens != 2 {
+		t.Error("tokens must be capped by burst", tokens)
+	}
+}
+
+func TestTokenBucket_burst(t *testing.T) {
+	//burst小于1时按1处理
+	b := NewTokenBucket(10, 0)
+	if b.reserve() != 0 || b.reserve() == 0 {
+		t.Error("burst must be at least 1")
+	}
+}
+
+func TestTokenBucket_Wait(t *testing.T) {
+	ctx := context.TODO()
+	b := NewTokenBucket(20, 1)
+	if err := b.Wait(ctx); err != nil {
+		t.Error("wait error", err)
+		return
+	}
+
+	start := time.Now()
+	if err := b.Wait(ctx); err != nil {
+		t.Error("wait error", err)
+		return
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Error("wait must block until the next token", d)
+		return
+	}
+
+	//rate不大于0时不限流
+	unlimited := NewTokenBucket(0, 1)
+	for i := 0; i < 10; i++ {
+		if err := unlimited.Wait(ctx); err != nil {
+			t.Error("unlimited bucket must not wait", err)
+			return
+		}
+	}
+}
+
+func TestTokenBucket_WaitCancel(t *testing.T) {
+	b := NewTokenBucket(1, 1)
+	b.Wait(context.TODO())
+
+	//等待期间ctx取消时返回错误并归还预占的令牌
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); err != context.DeadlineExceeded {
+		t.Error("wait must return ctx error", err)
+		return
+	}
+	b.mu.Lock()
+	tokens := b.tokens
+	b.mu.Unlock()
+	if tokens < -0.1 || tokens > 0.1 {
+		t.Error("reserved token must be refunded", tokens)
+		return
+	}
+	//归还后下一次只需等待一个令牌的时间
+	if wait := b.reserve(); wait > time.Second {
+		t.Error("refunded token must not delay the next reserve", wait)
+	}
+}
+
+type errLimiter struct{}
+
+func (errLimiter) Wait(ctx context.Context) error {
+	return errors.New("limiter error")
+}
+
+func TestWaitLimiter(t *testing.T) {
+	topic := "ratelimit:wait"
+	j := newTestJob(newTestQueue())
+	c := j.counter(topic)
+
+	if !j.waitLimiter(&Worker{}, c) {
+		t.Error("worker without limiter must not wait")
+		return
+	}
+
+	//限流器异常时不阻塞任务处理
+	if !j.waitLimiter(&Worker{Limiter: errLimiter{}}, c) {
+		t.Error("limiter error must not block the task")
+		return
+	}
+
+	//被限流的次数和时长计入统计
+	b := NewTokenBucket(50, 1)
+	w := &Worker{Limiter: b}
+	j.waitLimiter(w, c)
+	if !j.waitLimiter(w, c) {
+		t.Error("wait limiter error")
+		return
+	}
+	s := j.TopicStats(topic)
+	if s.Throttled != 1 || s.ThrottledSeconds <= 0 {
+		t.Error("throttled stats error", s.Throttled, s.ThrottledSeconds)
+	}
+}
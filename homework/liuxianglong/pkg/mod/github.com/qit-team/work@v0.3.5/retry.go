@@ -0,0 +1,71 @@
+package work
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	//固定间隔重试
+	BackoffFixed = iota
+	//指数退避重试，间隔按Delay*2^(n-1)增长
+	BackoffExponential
+)
+
+//指数退避的最大位移，防止间隔溢出
+const maxBackoffShift = 30
+
+//任务失败(StateFailed)时的重试策略
+type RetryPolicy struct {
+	//最大执行次数(包含首次执行)，小于等于1表示不重试
+	MaxAttempts int
+	//退避方式 BackoffFixed|BackoffExponential
+	Backoff int
+	//首次重试的间隔
+	Delay time.Duration
+	//重试间隔上限，0表示不限制
+	MaxDelay time.Duration
+	//抖动系数，取值[0,1]，实际间隔在 delay*(1-Jitter) ~ delay*(1+Jitter) 之间随机
+	Jitter float64
+}
+
+//固定间隔的重试策略
+func NewFixedRetry(maxAttempts int, delay time.Duration) *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: maxAttempts, Backoff: BackoffFixed, Delay: delay}
+}
+
+//指数退避的重试策略
+func NewExponentialRetry(maxAttempts int, delay time.Duration, maxDelay time.Duration) *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: maxAttempts, Backoff: BackoffExponential, Delay: delay, MaxDelay: maxDelay}
+}
+
+//已执行attempt次后是否还可以重试
+func (p *RetryPolicy) CanRetry(attempt int) bool {
+	return attempt < p.MaxAttempts
+}
+
+//第attempt次重试前的等待间隔，attempt从1开始
+func (p *RetryPolicy) NextDelay(attempt int) time.Duration {
+	delay := p.Delay
+	if p.Backoff == BackoffExponential && attempt > 1 {
+		shift := attempt - 1
+		if shift > maxBackoffShift {
+			shift = maxBackoffShift
+		}
+		delay = p.Delay << uint(shift)
+	}
+
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay < 0) {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 && delay > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		delta := float64(delay) * jitter
+		delay = time.Duration(float64(delay) - delta + rand.Float64()*2*delta)
+	}
+	return delay
+}
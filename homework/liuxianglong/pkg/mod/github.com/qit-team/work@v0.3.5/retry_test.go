@@ -0,0 +1,158 @@
+package work
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCanRetry(t *testing.T) {
+	cases := []struct {
+		maxAttempts int
+		attempt     int
+		want        bool
+	}{
+		{0, 1, false},
+		{1, 1, false},
+		{3, 1, true},
+		{3, 2, true},
+		{3, 3, false},
+		{3, 4, false},
+	}
+	for _, c := range cases {
+		p := &RetryPolicy{MaxAttempts: c.maxAttempts}
+		if got := p.CanRetry(c.attempt); got != c.want {
+			t.Error("can retry error", c.maxAttempts, c.attempt, got)
+		}
+	}
+}
+
+func TestNextDelay(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  *RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"fixed", NewFixedRetry(5, time.Second), 1, time.Second},
+		{"fixed ignores attempt", NewFixedRetry(5, time.Second), 4, time.Second},
+		{"exponential first", NewExponentialRetry(5, time.Second, 0), 1, time.Second},
+		{"exponential second", NewExponentialRetry(5, time.Second, 0), 2, 2 * time.Second},
+		{"exponential fourth", NewExponentialRetry(5, time.Second, 0), 4, 8 * time.Second},
+		{"exponential zero attempt", NewExponentialRetry(5, time.Second, 0), 0, time.Second},
+		//位移最多maxBackoffShift位
+		{"shift cap", NewExponentialRetry(100, time.Nanosecond, 0), 100, time.Nanosecond << maxBackoffShift},
+		{"shift cap boundary", NewExponentialRetry(100, time.Nanosecond, 0), maxBackoffShift + 1, time.Nanosecond << maxBackoffShift},
+		{"max delay", NewExponentialRetry(10, time.Second, 5*time.Second), 4, 5 * time.Second},
+		{"below max delay", NewExponentialRetry(10, time.Second, 5*time.Second), 3, 4 * time.Second},
+		{"fixed max delay", &RetryPolicy{Backoff: BackoffFixed, Delay: time.Minute, MaxDelay: time.Second}, 1, time.Second},
+		//溢出后按MaxDelay处理
+		{"overflow", NewExponentialRetry(100, time.Hour, time.Minute), 100, time.Minute},
+	}
+	for _, c := range cases {
+		if got := c.policy.NextDelay(c.attempt); got != c.want {
+			t.Error("next delay error", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNextDelay_jitter(t *testing.T) {
+	cases := []struct {
+		jitter float64
+		min    time.Duration
+		max    time.Duration
+	}{
+		{0.2, 8 * time.Second, 12 * time.Second},
+		{0.5, 5 * time.Second, 15 * time.Second},
+		//抖动系数大于1时按1处理
+		{2, 0, 20 * time.Second},
+	}
+	for _, c := range cases {
+		p := &RetryPolicy{Backoff: BackoffFixed, Delay: 10 * time.Second, Jitter: c.jitter}
+		for i := 0; i < 1000; i++ {
+			if d := p.NextDelay(1); d < c.min || d > c.max {
+				t.Error("jitter out of bounds", c.jitter, d)
+				return
+			}
+		}
+	}
+
+	//间隔为0时不抖动
+	p := &RetryPolicy{Backoff: BackoffFixed, Jitter: 0.5}
+	if d := p.NextDelay(1); d != 0 {
+		t.Error("zero delay must not be jittered", d)
+	}
+}
+
+func TestRetryTask(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "retry:task"
+	policy := NewFixedRetry(3, 2*time.Second)
+	j.AddFunc(topic, func(task Task) TaskResult {
+		return TaskResult{Id: task.Id, State: StateFailed}
+	}, policy)
+
+	task := GenTask(topic, "1")
+	task.Token = "token"
+	if !j.retryTask(topic, task, TaskResult{Id: task.Id, State: StateFailed, Message: "boom"}, policy) {
+		t.Error("retry task must be enqueued")
+		return
+	}
+
+	//按Attempt+1和重试间隔重新入队，不携带原消息的token
+	messages := q.messages(topic)
+	if len(messages) != 1 || messages[0].delay != 2 {
+		t.Error("retry enqueue error", messages)
+		return
+	}
+	retried, err := DecodeStringTask(messages[0].message)
+	if err != nil || retried.Id != task.Id || retried.Attempt != 1 || retried.Token != "" {
+		t.Error("retried task error", retried, err)
+		return
+	}
+	if s := j.TopicStats(topic); s.Retry != 1 {
+		t.Error("retry stats error", s.Retry)
+		return
+	}
+
+	//达到最大执行次数后放入死信队列
+	retried.Attempt = 2
+	if !j.retryTask(topic, retried, TaskResult{Id: task.Id, State: StateFailed, Message: "boom"}, policy) {
+		t.Error("exhausted task must be moved to the dead letter queue")
+		return
+	}
+	if len(q.messages(topic)) != 1 {
+		t.Error("exhausted task must not be retried", q.messages(topic))
+		return
+	}
+	letters, err := j.ListDeadLetters(context.TODO(), topic, 0, 10)
+	if err != nil || len(letters) != 1 {
+		t.Error("dead letter error", letters, err)
+		return
+	}
+	if letters[0].Reason != DeadReasonRetryExhausted || letters[0].Attempt != 3 || letters[0].LastError != "boom" {
+		t.Error("dead letter error", letters[0])
+	}
+}
+
+func TestRetryTask_enqueueError(t *testing.T) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	topic := "retry:error"
+	policy := NewFixedRetry(3, time.Second)
+	j.AddFunc(topic, func(task Task) TaskResult {
+		return TaskResult{Id: task.Id, State: StateFailed}
+	}, policy)
+
+	q.setFailEnqueue(true)
+	task := GenTask(topic, "1")
+	//重新入队失败时原消息不能ack
+	if j.retryTask(topic, task, TaskResult{Id: task.Id, State: StateFailed}, policy) {
+		t.Error("retry task must fail when enqueue fails")
+		return
+	}
+	if s := j.TopicStats(topic); s.RetryErr != 1 || s.Retry != 0 {
+		t.Error("retry error stats error", s.RetryErr, s.Retry)
+	}
+}
@@ -0,0 +1,188 @@
+package work
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+//任务处理耗时直方图的默认分桶上限(秒)
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+//topic维度的统计计数器，均使用原子操作
+type topicCounter struct {
+	pull        int64
+	pullErr     int64
+	pullEmpty   int64
+	task        int64
+	taskErr     int64
+	handle      int64
+	handleErr   int64
+	handlePanic int64
+	retry       int64
+	retryErr    int64
+	deadLetter  int64
+	//入队时因幂等key重复被丢弃的任务数
+	duplicate int64
+	//已处理过而跳过的重复投递任务数
+	skip int64
+	//被限流的次数和等待时长(纳秒)
+	throttled     int64
+	throttledTime int64
+	//处理中的任务数
+	inFlight int64
+
+	//耗时直方图，buckets最后一个元素为+Inf
+	buckets      []int64
+	latencySum   int64
+	latencyCount int64
+}
+
+func newTopicCounter() *topicCounter {
+	return &topicCounter{buckets: make([]int64, len(DefaultLatencyBuckets)+1)}
+}
+
+//记录一次任务处理耗时
+func (c *topicCounter) observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(DefaultLatencyBuckets, seconds)
+	atomic.AddInt64(&c.buckets[i], 1)
+	atomic.AddInt64(&c.latencySum, int64(d))
+	atomic.AddInt64(&c.latencyCount, 1)
+}
+
+//耗时直方图
+type LatencyStats struct {
+	//分桶上限(秒)
+	Buckets []float64 `json:"buckets"`
+	//小于等于对应分桶上限的累计次数，比Buckets多一个+Inf分桶
+	Counts []int64 `json:"counts"`
+	//总耗时(秒)
+	Sum float64 `json:"sum"`
+	//总次数
+	Count int64 `json:"count"`
+}
+
+//topic维度的统计数据
+type TopicStats struct {
+	Topic            string       `json:"topic"`
+	Pull             int64        `json:"pull"`
+	PullErr          int64        `json:"pull_err"`
+	PullEmpty        int64        `json:"pull_empty"`
+	Task             int64        `json:"task"`
+	TaskErr          int64        `json:"task_err"`
+	Handle           int64        `json:"handle"`
+	HandleErr        int64        `json:"handle_err"`
+	HandlePanic      int64        `json:"handle_panic"`
+	Retry            int64        `json:"retry"`
+	RetryErr         int64        `json:"retry_err"`
+	DeadLetter       int64        `json:"dead_letter"`
+	Duplicate        int64        `json:"duplicate"`
+	Skip             int64        `json:"skip"`
+	Throttled        int64        `json:"throttled"`
+	ThrottledSeconds float64      `json:"throttled_seconds"`
+	InFlight         int64        `json:"in_flight"`
+	Concurrency      int          `json:"concurrency"`
+	Latency          LatencyStats `json:"latency"`
+}
+
+//获取topic的统计计数器，不存在时创建
+func (j *Job) counter(topic string) *topicCounter {
+	j.sLock.RLock()
+	c, ok := j.counters[topic]
+	j.sLock.RUnlock()
+	if ok {
+		return c
+	}
+
+	j.sLock.Lock()
+	defer j.sLock.Unlock()
+	if c, ok = j.counters[topic]; !ok {
+		c = newTopicCounter()
+		j.counters[topic] = c
+	}
+	return c
+}
+
+func (j *Job) topicStats(topic string, c *topicCounter) TopicStats {
+	s := TopicStats{
+		Topic:       topic,
+		Pull:        atomic.LoadInt64(&c.pull),
+		PullErr:     atomic.LoadInt64(&c.pullErr),
+		PullEmpty:   atomic.LoadInt64(&c.pullEmpty),
+		Task:        atomic.LoadInt64(&c.task),
+		TaskErr:     atomic.LoadInt64(&c.taskErr),
+		Handle:      atomic.LoadInt64(&c.handle),
+		HandleErr:   atomic.LoadInt64(&c.handleErr),
+		HandlePanic: atomic.LoadInt64(&c.handlePanic),
+		Retry:       atomic.LoadInt64(&c.retry),
+		RetryErr:    atomic.LoadInt64(&c.retryErr),
+		DeadLetter:  atomic.LoadInt64(&c.deadLetter),
+		Duplicate:   atomic.LoadInt64(&c.duplicate),
+		Skip:        atomic.LoadInt64(&c.skip),
+		Throttled:   atomic.LoadInt64(&c.throttled),
+		InFlight:    atomic.LoadInt64(&c.inFlight),
+	}
+
+	j.wLock.RLock()
+	if w, ok := j.workers[topic]; ok {
+		s.Concurrency = w.MaxConcurrency
+	}
+	j.wLock.RUnlock()
+
+	s.ThrottledSeconds = time.Duration(atomic.LoadInt64(&c.throttledTime)).Seconds()
+
+	s.Latency = LatencyStats{
+		Buckets: DefaultLatencyBuckets,
+		Counts:  make([]int64, len(c.buckets)),
+		Sum:     time.Duration(atomic.LoadInt64(&c.latencySum)).Seconds(),
+		Count:   atomic.LoadInt64(&c.latencyCount),
+	}
+	var total int64
+	for i := range c.buckets {
+		total += atomic.LoadInt64(&c.buckets[i])
+		s.Latency.Counts[i] = total
+	}
+	return s
+}
+
+//获取某个topic的统计数据
+func (j *Job) TopicStats(topic string) TopicStats {
+	j.sLock.RLock()
+	c, ok := j.counters[topic]
+	j.sLock.RUnlock()
+	if !ok {
+		c = newTopicCounter()
+	}
+	return j.topicStats(topic, c)
+}
+
+//获取全部topic的统计数据，按topic排序
+func (j *Job) StatsByTopic() []TopicStats {
+	j.sLock.RLock()
+	topics := make([]string, 0, len(j.counters))
+	for topic := range j.counters {
+		topics = append(topics, topic)
+	}
+	j.sLock.RUnlock()
+	sort.Strings(topics)
+
+	arr := make([]TopicStats, 0, len(topics))
+	for _, topic := range topics {
+		arr = append(arr, j.topicStats(topic, j.counter(topic)))
+	}
+	return arr
+}
+
+/**
+ * 获取topic的队列堆积数
+ * 需要Queue驱动实现work.BrowsableQueue接口
+ */
+func (j *Job) QueueLen(ctx context.Context, topic string) (int64, error) {
+	bq, err := j.getBrowsableQueue(topic)
+	if err != nil {
+		return 0, err
+	}
+	return bq.Len(ctx, topic)
+}
@@ -0,0 +1,71 @@
+package work
+
+import (
+	"testing"
+	"time"
+)
+
+func TestObserve_bucket(t *testing.T) {
+	cases := []struct {
+		d      time.Duration
+		bucket int
+	}{
+		{0, 0},
+		{time.Millisecond, 0},
+		//等于分桶上限时计入该分桶(le)
+		{5 * time.Millisecond, 0},
+		{5*time.Millisecond + 1, 1},
+		{10 * time.Millisecond, 1},
+		{time.Second, 7},
+		{10 * time.Second, len(DefaultLatencyBuckets) - 1},
+		//超过最大上限时计入+Inf分桶
+		{10*time.Second + 1, len(DefaultLatencyBuckets)},
+		{time.Hour, len(DefaultLatencyBuckets)},
+	}
+	for _, c := range cases {
+		counter := newTopicCounter()
+		counter.observe(c.d)
+		for i, n := range counter.buckets {
+			want := int64(0)
+			if i == c.bucket {
+				want = 1
+			}
+			if n != want {
+				t.Error("observe bucket error", c.d, i, n)
+				return
+			}
+		}
+	}
+}
+
+func TestTopicStats_latency(t *testing.T) {
+	j := New()
+	topic := "stats:latency"
+	c := j.counter(topic)
+	c.observe(time.Millisecond)
+	c.observe(5 * time.Millisecond)
+	c.observe(20 * time.Millisecond)
+	c.observe(time.Minute)
+
+	s := j.TopicStats(topic)
+	l := s.Latency
+	if len(l.Counts) != len(l.Buckets)+1 {
+		t.Error("counts must have a +Inf bucket", len(l.Counts), len(l.Buckets))
+		return
+	}
+	//分桶计数是累计值
+	want := []int64{2, 2, 3, 3, 3, 3, 3, 3, 3, 3, 3, 4}
+	for i := range want {
+		if l.Counts[i] != want[i] {
+			t.Error("cumulative counts error", l.Counts)
+			return
+		}
+	}
+	if l.Count != 4 || l.Counts[len(l.Counts)-1] != l.Count {
+		t.Error("+Inf bucket must equal the count", l.Count, l.Counts)
+		return
+	}
+	if sum := 60.026; l.Sum < sum-1e-9 || l.Sum > sum+1e-9 {
+		t.Error("latency sum error", l.Sum)
+	}
+}
@@ -2,6 +2,7 @@ package work
 
 import (
 	"encoding/json"
+	"time"
 )
 
 const (
@@ -17,7 +18,33 @@ type Task struct {
 	Id      string `json:"id"`
 	Topic   string `json:"topic"`
 	Message string `json:"message"`
-	Token   string
+	//已重试的次数，首次投递为0
+	Attempt int `json:"attempt,omitempty"`
+	//任务的元数据，如trace_id、客户端ip等，随消息一起投递
+	Headers map[string]string `json:"headers,omitempty"`
+	//首次入队的时间戳(秒)，重试时保持不变
+	EnqueuedAt int64 `json:"enqueued_at,omitempty"`
+	//优先级 PriorityHigh|PriorityNormal|PriorityLow，Queue驱动需要实现PriorityQueue接口
+	Priority int `json:"priority,omitempty"`
+	//任务处理成功后的后续流程，使用Chain、Then、Group生成
+	Flow  *Flow `json:"flow,omitempty"`
+	Token string
+}
+
+//获取任务的元数据
+func (t Task) GetHeader(key string) string {
+	return t.Headers[key]
+}
+
+//设置任务的元数据，value为空时忽略
+func (t *Task) SetHeader(key string, value string) {
+	if value == "" {
+		return
+	}
+	if t.Headers == nil {
+		t.Headers = make(map[string]string)
+	}
+	t.Headers[key] = value
 }
 
 func (t Task) String() string {
@@ -48,3 +75,14 @@ type TaskResult struct {
 func GenTask(topic string, message string) Task {
 	return Task{Id: GenUUID(), Topic: topic, Message: message}
 }
+
+//入队前补全任务的topic和入队时间
+func fillTask(topic string, task Task) Task {
+	if task.Topic == "" {
+		task.Topic = topic
+	}
+	if task.EnqueuedAt == 0 {
+		task.EnqueuedAt = time.Now().Unix()
+	}
+	return task
+}
@@ -3,6 +3,7 @@ package work
 import (
 	"encoding/json"
 	"github.com/google/uuid"
+	"time"
 )
 
 
@@ -18,3 +19,16 @@ func GenUUID() string {
 	u, _ := uuid.NewRandom()
 	return u.String()
 }
+
+
+//将延迟时长转换为队列驱动约定的延迟秒数，不足1秒的部分向上取整
+func DelaySeconds(delay time.Duration) int64 {
+	if delay <= 0 {
+		return 0
+	}
+	seconds := int64(delay / time.Second)
+	if delay%time.Second > 0 {
+		seconds++
+	}
+	return seconds
+}
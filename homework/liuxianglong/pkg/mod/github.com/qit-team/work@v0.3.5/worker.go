@@ -1,8 +1,27 @@
 package work
 
+import (
+	"context"
+	"time"
+)
+
 type Worker struct {
 	Call           WorkerFunc
 	MaxConcurrency int
+	//任务失败时的重试策略，为nil时不重试
+	Retry *RetryPolicy
+	//死信队列topic，为空时默认为 <topic>.dlq
+	DeadLetterTopic string
+	//单个任务的处理超时时间，超时后ctx会被取消，0表示不限制。仅对ContextWorkerFunc生效，需要小于Queue的可见性超时
+	Timeout time.Duration
+	//已处理任务标记的保留时长，大于0且Job设置了幂等存储时，保留期内重复投递的任务会被直接ack
+	Idempotent time.Duration
+	//限流器，任务分发给处理函数前需要获取令牌，为nil时不限流
+	Limiter Limiter
+	//批量worker每批最多处理的任务数，大于1时Call需要实现BatchWorkerFunc
+	BatchSize int
+	//批量worker凑批的最长等待时间，超时后按已拉取的任务处理
+	BatchWait time.Duration
 }
 
 type WorkerFunc interface {
@@ -14,3 +33,43 @@ type MyWorkerFunc func(task Task) (TaskResult)
 func (f MyWorkerFunc) Run(task Task) (TaskResult) {
 	return f(task)
 }
+
+/**
+ * 支持上下文的worker
+ * ctx携带了任务信息，在任务超时或者Job平滑关闭等待超时时会被取消
+ */
+type ContextWorkerFunc interface {
+	WorkerFunc
+	RunContext(ctx context.Context, task Task) TaskResult
+}
+
+type MyContextWorkerFunc func(ctx context.Context, task Task) TaskResult
+
+func (f MyContextWorkerFunc) Run(task Task) TaskResult {
+	return f(WithTask(context.Background(), task), task)
+}
+
+func (f MyContextWorkerFunc) RunContext(ctx context.Context, task Task) TaskResult {
+	return f(ctx, task)
+}
+
+//根据注册参数生成worker，args按类型识别：int为并发数，*RetryPolicy为失败重试策略，time.Duration为任务超时时间，
+//IdempotentTTL为已处理任务标记的保留时长，Limiter为限流器
+func newWorker(call WorkerFunc, args ...interface{}) *Worker {
+	w := &Worker{Call: call}
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case int:
+			w.MaxConcurrency = v
+		case *RetryPolicy:
+			w.Retry = v
+		case time.Duration:
+			w.Timeout = v
+		case IdempotentTTL:
+			w.Idempotent = time.Duration(v)
+		case Limiter:
+			w.Limiter = v
+		}
+	}
+	return w
+}
@@ -0,0 +1,178 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	//任务组完成情况的key前缀，完整key为 <prefix><group_id>
+	groupKeyPrefix = "work:group:"
+	//任务组完成情况的保留时长
+	defaultGroupTTL = time.Hour * 24
+	//回调任务header中记录任务组id的key
+	HeaderGroupId = "x-group-id"
+)
+
+var ErrGroupStoreNotSet = errors.New("group store is not set")
+
+/**
+ * 任务组存储接口，记录任务组中已完成的成员，可以使用redis等实现
+ */
+type GroupStore interface {
+	//记录成员已完成，本次记录使全部size个成员完成时返回true，同一成员重复记录不会重复返回true
+	AddGroupMember(ctx context.Context, key string, member string, size int, ttl time.Duration) (done bool, err error)
+	//移除已完成的成员，回调任务入队失败时使用，成员重新投递后可以再次触发
+	RemoveGroupMember(ctx context.Context, key string, member string) (err error)
+}
+
+//任务的后续流程，随任务一起投递
+type Flow struct {
+	//任务处理成功后入队的后续任务
+	Next []Task `json:"next,omitempty"`
+	//所属任务组的id和成员数
+	GroupId   string `json:"group_id,omitempty"`
+	GroupSize int    `json:"group_size,omitempty"`
+	//任务组全部成员处理成功后入队的回调任务
+	GroupCallback *Task `json:"group_callback,omitempty"`
+}
+
+//设置任务组存储
+func (j *Job) SetGroupStore(s GroupStore) {
+	j.groupStore = s
+}
+
+/**
+ * 串联任务，前一个任务处理成功后入队下一个任务，返回第一个任务
+ * 任务需要设置Topic
+ */
+func Chain(tasks ...Task) Task {
+	if len(tasks) == 0 {
+		return Task{}
+	}
+	for i := len(tasks) - 2; i >= 0; i-- {
+		tasks[i] = Then(tasks[i], tasks[i+1])
+	}
+	return tasks[0]
+}
+
+/**
+ * 任务处理成功后入队next中的全部任务
+ * 后续任务的id在此时生成并随任务一起投递，任务被重新投递时后续任务使用相同的id，可以通过IdempotentTTL去重
+ */
+func Then(task Task, next ...Task) Task {
+	flow := Flow{}
+	if task.Flow != nil {
+		flow = *task.Flow
+	}
+	flow.Next = append([]Task{}, flow.Next...)
+	for _, t := range next {
+		if t.Id == "" {
+			t.Id = GenUUID()
+		}
+		flow.Next = append(flow.Next, t)
+	}
+	task.Flow = &flow
+	return task
+}
+
+/**
+ * 生成任务组，全部成员处理成功后入队callback，返回设置了任务组信息的成员
+ * 需要通过Job.SetGroupStore设置任务组存储
+ */
+func Group(callback Task, members ...Task) []Task {
+	groupId := GenUUID()
+	if callback.Id == "" {
+		callback.Id = GenUUID()
+	}
+	tasks := make([]Task, len(members))
+	for k, task := range members {
+		if task.Id == "" {
+			task.Id = GenUUID()
+		}
+		flow := Flow{}
+		if task.Flow != nil {
+			flow = *task.Flow
+		}
+		flow.GroupId = groupId
+		flow.GroupSize = len(members)
+		flow.GroupCallback = &callback
+		task.Flow = &flow
+		tasks[k] = task
+	}
+	return tasks
+}
+
+/**
+ * 任务处理成功后推进流程：入队后续任务，任务组成员全部完成时入队回调任务
+ * 返回错误时原消息不会ack，依赖Queue驱动重新投递，后续任务可能会重复入队
+ */
+func (j *Job) advanceFlow(topic string, task Task) error {
+	if task.Flow == nil {
+		return nil
+	}
+
+	for _, next := range task.Flow.Next {
+		if err := j.enqueueSuccessor(task, next); err != nil {
+			j.logAndPrintln(Error, "flow_enqueue_error", topic, task.Id, next.Topic, err)
+			return err
+		}
+	}
+
+	flow := task.Flow
+	if flow.GroupId == "" || flow.GroupCallback == nil {
+		return nil
+	}
+	if j.groupStore == nil {
+		j.logAndPrintln(Error, "flow_group_error", topic, task.Id, ErrGroupStoreNotSet)
+		return ErrGroupStoreNotSet
+	}
+
+	key := groupKeyPrefix + flow.GroupId
+	done, err := j.groupStore.AddGroupMember(j.ctx, key, task.Id, flow.GroupSize, defaultGroupTTL)
+	if err != nil {
+		j.logAndPrintln(Error, "flow_group_error", topic, task.Id, err)
+		return err
+	}
+	if !done {
+		return nil
+	}
+
+	callback := *flow.GroupCallback
+	callback.SetHeader(HeaderGroupId, flow.GroupId)
+	if err := j.enqueueSuccessor(task, callback); err != nil {
+		j.logAndPrintln(Error, "flow_callback_error", topic, flow.GroupId, callback.Topic, err)
+		//移除完成记录，重新投递后可以再次触发回调
+		j.groupStore.RemoveGroupMember(j.ctx, key, task.Id)
+		return err
+	}
+	j.println(Debug, "flow group done", flow.GroupId, callback.Topic)
+	return nil
+}
+
+//入队后续任务，继承前序任务中后续任务未设置的header，如trace_id
+func (j *Job) enqueueSuccessor(prev Task, next Task) error {
+	//后续任务的id由Then和Group生成，直接设置Flow时未指定的id在此生成，重新投递时不保证相同
+	if next.Id == "" {
+		next.Id = GenUUID()
+	}
+	headers := make(map[string]string, len(prev.Headers)+len(next.Headers))
+	for k, v := range prev.Headers {
+		headers[k] = v
+	}
+	for k, v := range next.Headers {
+		headers[k] = v
+	}
+	delete(headers, HeaderCodec)
+	if v := next.GetHeader(HeaderCodec); v != "" {
+		headers[HeaderCodec] = v
+	}
+	next.Headers = headers
+
+	ok, err := j.EnqueueWithTask(j.ctx, next.Topic, next)
+	if err == nil && !ok {
+		err = errors.New("enqueue failed")
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package work
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+//进程内的任务组存储
+type testGroupStore struct {
+	lock    sync.Mutex
+	members map[string]map[string]bool
+}
+
+func newTestGroupStore() *testGroupStore {
+	return &testGroupStore{members: make(map[string]map[string]bool)}
+}
+
+func (s *testGroupStore) AddGroupMember(ctx context.Context, key string, member string, size int, ttl time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.members[key] == nil {
+		s.members[key] = make(map[string]bool)
+	}
+	if s.members[key][member] {
+		return false, nil
+	}
+	s.members[key][member] = true
+	return len(s.members[key]) == size, nil
+}
+
+func (s *testGroupStore) RemoveGroupMember(ctx context.Context, key string, member string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.members[key], member)
+	return nil
+}
+
+//生成注册了topics的worker和任务组存储的Job
+func newFlowJob(topics ...string) (*Job, *testQueue) {
+	q := newTestQueue()
+	j := newTestJob(q)
+	for _, topic := range topics {
+		j.AddFunc(topic, func(task Task) TaskResult {
+			return TaskResult{Id: task.Id, State: StateSucceed}
+		})
+	}
+	j.SetGroupStore(newTestGroupStore())
+	return j, q
+}
+
+//topic中待出队的任务
+func flowTasks(q *testQueue, topic string) []Task {
+	messages := q.messages(topic)
+	tasks := make([]Task, 0, len(messages))
+	for _, m := range messages {
+		task, _ := DecodeStringTask(m.message)
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+func TestThen_successorId(t *testing.T) {
+	task := Chain(GenTask("flow:a", "a"), GenTask("flow:b", "b"), GenTask("flow:c", "c"))
+	if task.Flow == nil || len(task.Flow.Next) != 1 {
+		t.Error("chain error", task.Flow)
+		return
+	}
+	next := task.Flow.Next[0]
+	if next.Id == "" || next.Topic != "flow:b" || next.Flow == nil || next.Flow.Next[0].Id == "" {
+		t.Error("successor ids must be assigned when the flow is built", next)
+		return
+	}
+
+	//已设置id的后续任务保留原id
+	preset := GenTask("flow:b", "b")
+	preset.Id = "preset"
+	if id := Then(GenTask("flow:a", "a"), preset).Flow.Next[0].Id; id != "preset" {
+		t.Error("preset successor id must be kept", id)
+	}
+}
+
+func TestAdvanceFlow_redelivery(t *testing.T) {
+	j, q := newFlowJob("flow:first", "flow:second")
+	task := Then(GenTask("flow:first", "first"), GenTask("flow:second", "second"))
+	task.SetHeader("trace_id", "trace")
+
+	//任务被重新投递时再次推进流程，后续任务使用相同的id
+	for i := 0; i < 2; i++ {
+		if err := j.advanceFlow("flow:first", task); err != nil {
+			t.Error("advance flow error", err)
+			return
+		}
+	}
+	tasks := flowTasks(q, "flow:second")
+	if len(tasks) != 2 {
+		t.Error("successor must be enqueued on every advance", tasks)
+		return
+	}
+	if tasks[0].Id != task.Flow.Next[0].Id || tasks[1].Id != tasks[0].Id {
+		t.Error("redelivered successor must keep its id", tasks[0].Id, tasks[1].Id)
+		return
+	}
+	if tasks[0].GetHeader("trace_id") != "trace" {
+		t.Error("successor must inherit headers", tasks[0].Headers)
+	}
+}
+
+func TestAdvanceFlow_group(t *testing.T) {
+	j, q := newFlowJob("flow:member", "flow:callback")
+	members := Group(GenTask("flow:callback", "done"), GenTask("flow:member", "1"), GenTask("flow:member", "2"), GenTask("flow:member", "3"))
+
+	for k, member := range members {
+		if err := j.advanceFlow("flow:member", member); err != nil {
+			t.Error("advance flow error", err)
+			return
+		}
+		//重复推进已完成的成员不会触发回调
+		j.advanceFlow("flow:member", member)
+		if n := len(q.messages("flow:callback")); k < len(members)-1 && n != 0 {
+			t.Error("callback must wait for all members", k, n)
+			return
+		}
+	}
+
+	tasks := flowTasks(q, "flow:callback")
+	if len(tasks) != 1 {
+		t.Error("callback must be enqueued once", tasks)
+		return
+	}
+	callback := members[0].Flow.GroupCallback
+	if tasks[0].Id != callback.Id || tasks[0].GetHeader(HeaderGroupId) != members[0].Flow.GroupId {
+		t.Error("callback task error", tasks[0])
+	}
+}
+
+func TestAdvanceFlow_callbackRollback(t *testing.T) {
+	j, q := newFlowJob("flow:member", "flow:callback")
+	members := Group(GenTask("flow:callback", "done"), GenTask("flow:member", "1"), GenTask("flow:member", "2"))
+
+	if err := j.advanceFlow("flow:member", members[0]); err != nil {
+		t.Error("advance flow error", err)
+		return
+	}
+	//回调任务入队失败时移除最后一个成员的完成记录
+	q.setFailEnqueue(true)
+	if err := j.advanceFlow("flow:member", members[1]); err != errEnqueue {
+		t.Error("callback enqueue error must be returned", err)
+		return
+	}
+	q.setFailEnqueue(false)
+
+	//成员重新投递后再次触发回调
+	if err := j.advanceFlow("flow:member", members[1]); err != nil {
+		t.Error("advance flow error", err)
+		return
+	}
+	tasks := flowTasks(q, "flow:callback")
+	if len(tasks) != 1 || tasks[0].Id != members[1].Flow.GroupCallback.Id {
+		t.Error("callback must be enqueued after redelivery", tasks)
+	}
+}
+
+func TestAdvanceFlow_groupStoreNotSet(t *testing.T) {
+	j, _ := newFlowJob("flow:member", "flow:callback")
+	j.SetGroupStore(nil)
+	members := Group(GenTask("flow:callback", "done"), GenTask("flow:member", "1"))
+	if err := j.advanceFlow("flow:member", members[0]); err != ErrGroupStoreNotSet {
+		t.Error("group store must be required", err)
+	}
+}
@@ -25,7 +25,7 @@ func GetInstance() *bannerListCache {
 		instance = new(bannerListCache)
 		instance.Prefix = prefix
 		//instance.DiName = redis.SingletonMain //设置缓存依赖的实例别名
-		//instance.DriverType = cache.DriverTypeRedis //设置缓存驱动的类型,默认redis
+		//instance.DriverType = cache.DriverTypeRedis //设置缓存驱动的类型,默认使用配置中Cache.Driver的驱动
 		//instance.SeTTL(86400) 设置默认缓存时间 默认86400
 	})
 	return instance
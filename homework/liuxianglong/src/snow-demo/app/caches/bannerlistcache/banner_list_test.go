@@ -8,6 +8,7 @@ import (
 	"testing"
 	"github.com/qit-team/snow-core/cache"
 	_ "github.com/qit-team/snow-core/cache/rediscache"
+	_ "github.com/qit-team/snow-core/cache/memorycache"
 )
 
 func init() {
@@ -15,8 +16,12 @@ func init() {
 	conf, err := config.Load("../../../.env")
 	if err != nil {
 		fmt.Println(err)
+		return
 	}
 
+	//缓存驱动跟随配置，Driver = "memory"时不依赖redis
+	cache.SetDefaultDriverType(conf.Cache.Driver)
+
 	//注册redis类
 	err = redis.Pr.Register(cache.DefaultDiName, conf.Redis)
 	if err != nil {
@@ -1,9 +1,118 @@
 package console
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/qit-team/snow-core/command"
+	"github.com/qit-team/snow-core/command/checkpoint"
+	"github.com/qit-team/snow-core/redis"
+	"snow-demo/app/services/orderservices"
+	"strconv"
+)
+
+//order命令的参数
+var orderVerbose bool
+
+//order_import命令的参数
+var (
+	importTotal   int
+	importBatch   int
+	importRestart bool
 )
 
 func RegisterCommand(c *command.Command) {
 	c.AddFunc("test", test)
+
+	//-a command -m order -- -verbose 1001
+	c.Add(&command.Cmd{
+		Name:        "order",
+		Description: "查询订单信息",
+		Usage:       "<order_id>",
+		MinArgs:     1,
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&orderVerbose, "verbose", false, "输出完整的订单信息")
+		},
+		Run: orderInfo,
+	})
+
+	//-a command -m order_import -- -total 100000 -batch 1000
+	//中断后重新执行时从上次保存的进度继续，-restart 从头开始
+	c.Add(&command.Cmd{
+		Name:        "order_import",
+		Description: "批量生成订单，支持断点续跑",
+		Flags: func(fs *flag.FlagSet) {
+			fs.IntVar(&importTotal, "total", 100000, "生成的订单数")
+			fs.IntVar(&importBatch, "batch", 1000, "每批写入的订单数")
+			fs.BoolVar(&importRestart, "restart", false, "忽略已保存的进度，从头开始")
+		},
+		Run: orderImport,
+	})
+
+	//-a command -m outbox_relay 常驻投递outbox表中的任务，也可以在cron中投递
+	c.Add(&command.Cmd{
+		Name:        "outbox_relay",
+		Description: "投递outbox表中待投递的任务",
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&relayDrain, "drain", false, "投递完当前的任务后退出")
+		},
+		Run: outboxRelay,
+	})
+}
+
+//查询订单信息，订单不存在时退出码为3
+func orderInfo(ctx context.Context, fs *flag.FlagSet) error {
+	id, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return command.Exit(command.ExitUsage, fmt.Errorf("invalid order_id %s", fs.Arg(0)))
+	}
+
+	order, err := orderservices.GetOrderInfoById(id)
+	if err != nil {
+		return err
+	}
+	if order == nil || order.Id == 0 {
+		return command.Exit(3, errors.New("order not found"))
+	}
+
+	if orderVerbose {
+		fmt.Printf("%+v\n", *order)
+	} else {
+		fmt.Println(order.OrderNo)
+	}
+	return nil
+}
+
+//批量生成订单，游标为已写入的订单数
+func orderImport(ctx context.Context, fs *flag.FlagSet) error {
+	if importTotal <= 0 || importBatch <= 0 {
+		return command.Exit(command.ExitUsage, errors.New("total and batch must be positive"))
+	}
+
+	store := checkpoint.GetRedisStore(redis.SingletonMain)
+	name := fmt.Sprintf("order_import:%d", importTotal)
+	return checkpoint.Run(ctx, store, name, func(ctx context.Context, cp *checkpoint.Checkpoint) error {
+		cp.SetTotal(int64(importTotal))
+		offset, _ := strconv.Atoi(cp.Cursor())
+		for offset < importTotal && ctx.Err() == nil {
+			end := offset + importBatch
+			if end > importTotal {
+				end = importTotal
+			}
+			orderNos := make([]string, 0, end-offset)
+			for i := offset; i < end; i++ {
+				orderNos = append(orderNos, fmt.Sprintf("IMP%010d", i+1))
+			}
+			if err := orderservices.SaveOrderNos(orderNos); err != nil {
+				return err
+			}
+
+			offset = end
+			if err := cp.Advance(ctx, strconv.Itoa(offset), int64(len(orderNos))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, checkpoint.Restart(importRestart))
 }
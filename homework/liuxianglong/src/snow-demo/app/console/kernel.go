@@ -1,7 +1,12 @@
 package console
 
 import (
+	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/snow-core/schedule"
 	"github.com/robfig/cron"
+	"snow-demo/app/constants/common"
+	"snow-demo/app/jobs/basejob"
+	"time"
 )
 
 /**
@@ -11,5 +16,17 @@ import (
 func RegisterSchedule(c *cron.Cron) {
 	//c.AddFunc("0 30 * * * *", test)
 	//c.AddFunc("@hourly", test)
-	c.AddFunc("@every 10s", test)
+	//注册的任务会recover panic并记录执行日志，可以通过schedule.History("test")查询最近的执行记录
+	//上一次执行未结束时跳过本次执行
+	schedule.AddFunc(c, "test", "@every 10s", cronTest, schedule.SkipIfRunning(true))
+	//多个cron实例只有一个实例执行，锁在50秒内不会被其他实例获取
+	schedule.AddLockedFunc(c, "@every 1m", "snow-demo:locked-test", 50*time.Second, lockedTest)
+
+	//定时投递任务到队列，由job进程消费；多个cron实例只有获取到leader锁的实例会投递
+	s := schedule.NewScheduler(c, basejob.GetJob(), redis.SingletonMain, "snow-demo")
+	s.AddTask("@every 1m", common.TopicOrder, scheduleOrderTask)
+
+	//投递outbox表中与业务数据同一事务写入的任务，也可以通过outbox_relay命令常驻投递
+	schedule.AddFunc(c, "outbox_relay", "@every 1s", cronOutboxRelay, schedule.SkipIfRunning(true))
+	schedule.AddFunc(c, "outbox_clean", "@daily", cronOutboxClean, schedule.SkipIfRunning(true))
 }
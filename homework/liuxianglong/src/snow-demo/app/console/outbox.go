@@ -0,0 +1,56 @@
+package console
+
+import (
+	"context"
+	"flag"
+	"github.com/qit-team/snow-core/log/logger"
+	"github.com/qit-team/snow-core/queue/outbox"
+	"snow-demo/app/jobs/basejob"
+	"snow-demo/config"
+	"sync"
+	"time"
+)
+
+//已投递的outbox任务保留时长
+const outboxRetention = 7 * 24 * time.Hour
+
+var (
+	relayOnce sync.Once
+	relay     *outbox.Relay
+)
+
+//outbox_relay命令的参数
+var relayDrain bool
+
+//outbox表和订单表在同一个数据库，首次使用时创建outbox表
+func getRelay() *outbox.Relay {
+	relayOnce.Do(func() {
+		if err := outbox.Sync(config.DB_SINGLETON_TESTQU); err != nil {
+			logger.Error(context.Background(), "outbox_table_sync_error", err.Error())
+		}
+		relay = outbox.NewRelay(basejob.GetJob(), config.DB_SINGLETON_TESTQU)
+	})
+	return relay
+}
+
+//cron任务，投递全部待投递的outbox任务
+func cronOutboxRelay(ctx context.Context) error {
+	return getRelay().Relay(ctx)
+}
+
+//cron任务，删除保留时长之前已投递的outbox任务
+func cronOutboxClean(ctx context.Context) error {
+	n, err := getRelay().Clean(ctx, time.Now().Add(-outboxRetention))
+	if err == nil {
+		logger.Info(ctx, "outbox_clean", n)
+	}
+	return err
+}
+
+//常驻投递outbox任务直到收到退出信号，-drain 投递完当前的任务后退出
+func outboxRelay(ctx context.Context, fs *flag.FlagSet) error {
+	if relayDrain {
+		return getRelay().Relay(ctx)
+	}
+	return getRelay().Run(ctx)
+}
@@ -1,7 +1,42 @@
 package console
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"github.com/qit-team/snow-core/log/logger"
+	"github.com/qit-team/snow-core/schedule"
+	"github.com/qit-team/work"
+	"snow-demo/app/constants/common"
+	"snow-demo/app/http/entities"
+	"snow-demo/app/jobs/basejob"
+	"strconv"
+	"time"
+)
 
 func test() {
 	fmt.Println("run test")
 }
+
+//cron任务，返回错误时记为执行失败
+func cronTest(ctx context.Context) error {
+	test()
+	return nil
+}
+
+//多个cron实例中只有获取到锁的实例执行
+func lockedTest(ctx context.Context) error {
+	token, _ := schedule.FencingToken(ctx)
+	fmt.Println("run locked test", token)
+	return nil
+}
+
+//定时投递的下单任务，payload按topic的编码器编码，由job进程的order处理
+func scheduleOrderTask() work.Task {
+	request := &entities.OrderValidatorRequest{OrderNo: "schedule-" + strconv.FormatInt(time.Now().UnixNano(), 10)}
+	task, err := basejob.PayloadTask(common.TopicOrder, request)
+	if err != nil {
+		//编码失败的任务无法解码，会被job进程放入死信队列
+		logger.Error(context.Background(), "schedule_order_task_error", err.Error())
+	}
+	return task
+}
@@ -1 +1,10 @@
 package common
+
+const (
+	//订单处理队列topic
+	TopicOrder = "topic-order"
+	//订单批量入库队列topic
+	TopicOrderBatch = "topic-order-batch"
+	//订单创建事件topic，发布后投递给每个订阅组
+	TopicOrderCreated = "topic-order-created"
+)
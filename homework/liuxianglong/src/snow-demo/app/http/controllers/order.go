@@ -8,10 +8,9 @@ import (
 	"snow-demo/app/constants/errorcode"
 	"snow-demo/app/jobs/basejob"
 	"github.com/qit-team/work"
-	"math/rand"
-	"encoding/json"
 	"fmt"
-	"context"
+	"snow-demo/app/constants/common"
+	"time"
 )
 
 // request和response的示例
@@ -54,19 +53,17 @@ func HandleOrder(c *gin.Context){
 		return
 	}
 
-	jsonBytes, err := json.Marshal(request)
+	task, err := basejob.PayloadTask(common.TopicOrder, request)
 	if err != nil {
 		fmt.Println(err);
 		Error(c, 500)
 		return
 	}
-	
-	task := work.Task{
-		Id:      strconv.Itoa(rand.Intn(100)),
-		Message: string(jsonBytes),
-	}
-	ok, err := basejob.EnqueueWithTask(context.TODO(), "", task)
-	if ok {
+	//下单任务优先于批量补数据等任务处理
+	task.Priority = work.PriorityHigh
+	//同一订单号10分钟内只入队一次，重复提交视为成功
+	ok, err := basejob.EnqueueUnique(c, common.TopicOrder, task, request.OrderNo, 10*time.Minute)
+	if ok || err == work.ErrDuplicateTask {
 		Success(c, nil)
 
 	} else {
@@ -2,8 +2,10 @@ package basejob
 
 import (
 	"github.com/qit-team/work"
+	"github.com/qit-team/snow-core/http/ctxkit"
 	"context"
 	"sync"
+	"time"
 )
 
 var (
@@ -40,26 +42,107 @@ func GetJob() *work.Job {
  * 消息入队 -- 原始message
  */
 func Enqueue(ctx context.Context, topic string, message string, args ...interface{}) (isOk bool, err error) {
-	return GetJob().Enqueue(ctx, topic, message, args...)
+	return EnqueueWithTask(ctx, topic, work.GenTask(topic, message), args...)
 }
 
 /**
  * 消息入队 -- Task数据结构
  */
 func EnqueueWithTask(ctx context.Context, topic string, task work.Task, args ...interface{}) (isOk bool, err error) {
-	return GetJob().EnqueueWithTask(ctx, topic, task, args...)
+	return GetJob().EnqueueWithTask(ctx, topic, withHeaders(ctx, task), args...)
+}
+
+/**
+ * 生成任务 -- payload按topic的编码器编码，处理函数使用AddPayloadFunc注册时会收到解码后的payload
+ */
+func PayloadTask(topic string, payload interface{}) (task work.Task, err error) {
+	return GetJob().PayloadTask(topic, payload)
+}
+
+/**
+ * 消息入队 -- payload按topic的编码器编码
+ */
+func EnqueuePayload(ctx context.Context, topic string, payload interface{}, args ...interface{}) (isOk bool, err error) {
+	task, err := PayloadTask(topic, payload)
+	if err != nil {
+		return false, err
+	}
+	return EnqueueWithTask(ctx, topic, task, args...)
+}
+
+/**
+ * 带幂等key的消息入队 -- Task数据结构，ttl时间内相同key的任务只会入队一次，重复时返回work.ErrDuplicateTask
+ */
+func EnqueueUnique(ctx context.Context, topic string, task work.Task, key string, ttl time.Duration, args ...interface{}) (isOk bool, err error) {
+	return GetJob().EnqueueUnique(ctx, topic, withHeaders(ctx, task), key, ttl, args...)
+}
+
+/**
+ * 延迟消息入队 -- Task数据结构，delay时长后才会被消费
+ */
+func EnqueueWithTaskAfter(ctx context.Context, topic string, task work.Task, delay time.Duration) (isOk bool, err error) {
+	return GetJob().EnqueueWithTaskAfter(ctx, topic, withHeaders(ctx, task), delay)
+}
+
+/**
+ * 定时消息入队 -- Task数据结构，at时间点后才会被消费
+ */
+func EnqueueWithTaskAt(ctx context.Context, topic string, task work.Task, at time.Time) (isOk bool, err error) {
+	return GetJob().EnqueueWithTaskAt(ctx, topic, withHeaders(ctx, task), at)
 }
 
 /**
  * 消息批量入队 -- 原始message
  */
 func BatchEnqueue(ctx context.Context, topic string, messages []string, args ...interface{}) (isOk bool, err error) {
-	return GetJob().BatchEnqueue(ctx, topic, messages, args...)
+	tasks := make([]work.Task, len(messages))
+	for k, message := range messages {
+		tasks[k] = work.GenTask(topic, message)
+	}
+	return BatchEnqueueWithTask(ctx, topic, tasks, args...)
 }
 
 /**
  * 消息批量入队 -- Task数据结构
  */
 func BatchEnqueueWithTask(ctx context.Context, topic string, tasks []work.Task, args ...interface{}) (isOk bool, err error) {
+	for k, task := range tasks {
+		tasks[k] = withHeaders(ctx, task)
+	}
 	return GetJob().BatchEnqueueWithTask(ctx, topic, tasks, args...)
 }
+
+/**
+ * 发布消息 -- 原始message，topic的每个订阅组都会收到，topic需要使用支持发布订阅的队列驱动
+ */
+func Publish(ctx context.Context, topic string, message string, args ...interface{}) (isOk bool, err error) {
+	return GetJob().PublishWithTask(ctx, topic, withHeaders(ctx, work.GenTask(topic, message)), args...)
+}
+
+/**
+ * 生成任务 -- 原始message，写入ctx中的trace_id、客户端ip，用于写入outbox等由其他进程投递的场景
+ */
+func GenTask(ctx context.Context, topic string, message string) work.Task {
+	return withHeaders(ctx, work.GenTask(topic, message))
+}
+
+/**
+ * 将入队请求ctx中的trace_id、客户端ip写入任务的元数据，任务处理时会还原到ctx中
+ */
+func withHeaders(ctx context.Context, task work.Task) work.Task {
+	if ctx == nil {
+		return task
+	}
+	headers := make(map[string]string, len(task.Headers)+2)
+	for k, v := range task.Headers {
+		headers[k] = v
+	}
+	task.Headers = headers
+	if task.GetHeader(ctxkit.TraceId) == "" {
+		task.SetHeader(ctxkit.TraceId, ctxkit.GetTraceId(ctx))
+	}
+	if task.GetHeader(ctxkit.ClientIp) == "" {
+		task.SetHeader(ctxkit.ClientIp, ctxkit.GetClientId(ctx))
+	}
+	return task
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"github.com/qit-team/work"
+)
+
+/**
+ * 不支持发布订阅的队列驱动(如db驱动)使用的发布订阅适配
+ * 发布时按注册的订阅组逐个入队到 <topic>#<group>，订阅组的出队、ack和重试仍由原队列处理
+ */
+type fanoutQueue struct {
+	work.Queue
+	groups map[string][]string
+}
+
+func newFanoutQueue(q work.Queue) *fanoutQueue {
+	return &fanoutQueue{Queue: q, groups: make(map[string][]string)}
+}
+
+//注册topic的订阅组，返回订阅组的topic，用于AddQueue
+func (f *fanoutQueue) subscribe(topic string, groups ...string) []string {
+	topics := make([]string, 0, len(groups)+1)
+	topics = append(topics, topic)
+	for _, group := range groups {
+		f.groups[topic] = append(f.groups[topic], group)
+		topics = append(topics, work.SubscriptionTopic(topic, group))
+	}
+	return topics
+}
+
+func (f *fanoutQueue) Publish(ctx context.Context, topic string, message string, args ...interface{}) (bool, error) {
+	return f.BatchPublish(ctx, topic, []string{message}, args...)
+}
+
+//逐个订阅组入队，部分订阅组失败时返回错误，重新发布可能使已成功的订阅组重复收到消息
+func (f *fanoutQueue) BatchPublish(ctx context.Context, topic string, messages []string, args ...interface{}) (bool, error) {
+	for _, group := range f.groups[topic] {
+		ok, err := f.Queue.BatchEnqueue(ctx, work.SubscriptionTopic(topic, group), messages, args...)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
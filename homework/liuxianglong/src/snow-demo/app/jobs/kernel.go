@@ -1,13 +1,22 @@
 package jobs
 
 import (
+	"context"
 	"github.com/qit-team/work"
+	"github.com/qit-team/snow-core/db"
 	"github.com/qit-team/snow-core/queue"
+	"github.com/qit-team/snow-core/queue/dbqueue"
+	"github.com/qit-team/snow-core/queue/memorystore"
+	"github.com/qit-team/snow-core/queue/outbox"
+	"github.com/qit-team/snow-core/queue/redisstore"
+	"github.com/qit-team/snow-core/queue/redislimiter"
 	"github.com/qit-team/snow-core/log/logger"
 	"github.com/qit-team/snow-core/redis"
 	"snow-demo/config"
 	"snow-demo/app/jobs/basejob"
 	"strings"
+	"snow-demo/app/constants/common"
+	"time"
 )
 
 /**
@@ -22,8 +31,18 @@ func RegisterWorker(job *work.Job) {
 	job.AddFunc("topic-test1", test, 2)
 	//使用worker结构进行注册
 	job.AddWorker("topic-test2", &work.Worker{Call: work.MyWorkerFunc(test), MaxConcurrency: 1})
+	//设置worker的限流器，多个job进程共享每秒100个任务的额度
+	job.AddFunc("topic-test3", test, 2, newLimiter("topic-test3", 100, 10))
 
-	job.AddFunc("topic-test", order)
+	//设置类型化的worker回调函数、并发数、失败重试策略、单个任务的超时时间和已处理任务标记的保留时长
+	job.AddPayloadFunc(common.TopicOrder, order, 2, work.NewExponentialRetry(5, time.Second, time.Minute), 10*time.Second,
+		work.IdempotentTTL(24*time.Hour))
+	//设置批量worker，每拉取到100个任务或者等待200毫秒后批量入库
+	job.AddBatchFunc(common.TopicOrderBatch, orderBatch, 100, 200*time.Millisecond, work.NewExponentialRetry(5, time.Second, time.Minute))
+
+	//订阅订单创建事件，notify和stats订阅组各自收到全部事件，失败重试互不影响
+	job.Subscribe(common.TopicOrderCreated, "notify", orderCreatedNotify, work.NewExponentialRetry(3, time.Second, time.Minute))
+	job.Subscribe(common.TopicOrderCreated, "stats", orderCreatedStats)
 
 	RegisterQueueDriver(job)
 	SetOptions(job)
@@ -33,10 +52,36 @@ func RegisterWorker(job *work.Job) {
  * 给topic注册对应的队列服务
  */
 func RegisterQueueDriver(job *work.Job) {
-	//设置队列服务，需要实现work.Queue接口的方法
-	q := queue.GetQueue(redis.SingletonMain, queue.DriverTypeRedis)
+	//设置队列服务，需要实现work.Queue接口的方法，驱动根据配置切换
+	driver := queueDriver()
+	q := queue.GetQueue(queueDiName(driver), driver)
+	if dq, ok := q.(*dbqueue.DbQueue); ok {
+		//db驱动使用queue_message表，表不存在时创建
+		if err := dq.Sync(); err != nil {
+			logger.Error(context.Background(), "queue_table_sync_error", err.Error())
+		}
+	}
+	//订单创建事件和订单在同一个事务写入outbox表，表不存在时创建
+	if err := outbox.Sync(config.DB_SINGLETON_TESTQU); err != nil {
+		logger.Error(context.Background(), "outbox_table_sync_error", err.Error())
+	}
 	//针对topic设置相关的queue
 	job.AddQueue(q, "topic-test1", "topic-test2")
+	//发布订阅的topic需要同时指定topic和各订阅组的topic
+	//redis驱动使用redis stream驱动；memory驱动自身支持发布订阅；db驱动不支持发布订阅，发布时按订阅组逐个入队
+	switch driver {
+	case queue.DriverTypeRedis:
+		job.AddQueue(queue.GetQueue(redis.SingletonMain, queue.DriverTypeRedisStream), common.TopicOrderCreated,
+			work.SubscriptionTopic(common.TopicOrderCreated, "notify"),
+			work.SubscriptionTopic(common.TopicOrderCreated, "stats"))
+	case queue.DriverTypeMemory:
+		job.AddQueue(q, common.TopicOrderCreated,
+			work.SubscriptionTopic(common.TopicOrderCreated, "notify"),
+			work.SubscriptionTopic(common.TopicOrderCreated, "stats"))
+	default:
+		fq := newFanoutQueue(q)
+		job.AddQueue(fq, fq.subscribe(common.TopicOrderCreated, "notify", "stats")...)
+	}
 	//设置默认的queue, 没有设置过的topic会使用默认的queue
 	job.AddQueue(q)
 }
@@ -48,9 +93,44 @@ func SetOptions(job *work.Job) {
 	//设置logger，需要实现work.Logger接口的方法
 	job.SetLogger(logger.GetLogger())
 
+	//设置幂等存储，入队去重和已处理任务标记依赖此存储
+	//设置任务组存储，work.Group的成员全部完成后触发回调任务
+	if queueDriver() != queue.DriverTypeRedis {
+		//memory和db驱动不依赖redis，存储使用进程内存，入队去重和任务组只在当前进程内生效
+		job.SetIdempotentStore(memorystore.GetMemoryStore(redis.SingletonMain))
+		job.SetGroupStore(memorystore.GetMemoryStore(redis.SingletonMain))
+	} else {
+		job.SetIdempotentStore(redisstore.GetRedisStore(redis.SingletonMain))
+		job.SetGroupStore(redisstore.GetRedisStore(redis.SingletonMain))
+	}
+
 	//设置启用的topic，未设置表示启用全部注册过topic
 	if config.GetOptions().Queue != "" {
 		topics := strings.Split(config.GetOptions().Queue, ",")
 		job.SetEnableTopics(topics...)
 	}
 }
+
+//配置的队列驱动，默认redis
+func queueDriver() string {
+	if conf := config.GetConf(); conf != nil && conf.Queue.Driver != "" {
+		return conf.Queue.Driver
+	}
+	return queue.DriverTypeRedis
+}
+
+//队列驱动依赖的实例别名
+func queueDiName(driver string) string {
+	if driver == queue.DriverTypeDb {
+		return db.SingletonMain
+	}
+	return redis.SingletonMain
+}
+
+//限流器，memory和db驱动时使用本地令牌桶，不依赖redis，额度按进程计算
+func newLimiter(key string, rate float64, burst int) work.Limiter {
+	if queueDriver() != queue.DriverTypeRedis {
+		return work.NewTokenBucket(rate, burst)
+	}
+	return redislimiter.NewRedisLimiter(redis.SingletonMain, key, rate, burst)
+}
@@ -1,41 +1,30 @@
 package jobs
 
 import (
+	"context"
 	"fmt"
 	"github.com/qit-team/work"
 	"time"
 	"snow-demo/app/http/entities"
-	"encoding/json"
-	"log"
 	"snow-demo/app/services/orderservices"
+	"github.com/qit-team/snow-core/log/logger"
 )
 
-func order(task work.Task) (work.TaskResult) {
+//ctx在任务超时或job停止时会被取消，trace_id为任务id
+//request由框架按topic的编码器解码，格式错误的消息会放入死信队列，不会进入处理函数
+func order(ctx context.Context, task work.Task, request *entities.OrderValidatorRequest) (work.TaskResult) {
 	time.Sleep(time.Millisecond * 5)
-	s, err := work.JsonEncode(task)
+	fmt.Println("do task", task.Id, request.OrderNo)
+
+	//订单和订单创建事件在同一个事务写入，事件由outbox_relay发布
+	err := orderservices.CreateOrder(ctx, request.OrderNo)
 	if err != nil {
-		//work.StateFailed 不会进行ack确认
-		//work.StateFailedWithAck 会进行actk确认
-		//return work.TaskResult{Id: task.Id, State: work.StateFailed}
-		return work.TaskResult{Id: task.Id, State: work.StateFailedWithAck}
-	} else {
-        //work.StateSucceed 会进行ack确认
-		fmt.Println("do task", s)
-		var t entities.OrderValidatorRequest
-		err := json.Unmarshal([]byte(task.Message), &t)
-		if err != nil {
-			fmt.Println(err)
-			log.Fatal(err)
-		}
-		fmt.Println("do task", t)
-		
-		err = orderservices.SaveOrderNo(t.OrderNo)
-		if err != nil {
-			fmt.Println(err)
-			log.Fatal(err)
-		}
-		fmt.Println("suc")
-		return work.TaskResult{Id: task.Id, State: work.StateSucceed}
+		//work.StateFailed 会按照worker的重试策略重新入队
+		logger.Error(ctx, "order_save_error", request.OrderNo, err.Error())
+		return work.TaskResult{Id: task.Id, State: work.StateFailed, Message: err.Error()}
 	}
+	fmt.Println("suc")
 
+	//work.StateSucceed 会进行ack确认
+	return work.TaskResult{Id: task.Id, State: work.StateSucceed}
 }
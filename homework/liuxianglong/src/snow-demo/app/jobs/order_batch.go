@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"context"
+	"github.com/qit-team/work"
+	"github.com/qit-team/snow-core/log/logger"
+	"snow-demo/app/http/entities"
+	"snow-demo/app/jobs/basejob"
+	"snow-demo/app/services/orderservices"
+)
+
+//批量保存订单，格式错误的消息单独ack，入库失败时整批按重试策略重新入队
+func orderBatch(ctx context.Context, tasks []work.Task) []work.TaskResult {
+	results := make([]work.TaskResult, len(tasks))
+	orderNos := make([]string, 0, len(tasks))
+	indexes := make([]int, 0, len(tasks))
+	for k, task := range tasks {
+		var t entities.OrderValidatorRequest
+		err := basejob.GetJob().DecodePayload(task, &t)
+		if err != nil {
+			//消息格式错误，重试也无法成功
+			logger.Error(ctx, "order_decode_error", task.Id, task.Message, err.Error())
+			results[k] = work.TaskResult{Id: task.Id, State: work.StateFailedWithAck, Message: err.Error()}
+			continue
+		}
+		orderNos = append(orderNos, t.OrderNo)
+		indexes = append(indexes, k)
+	}
+	if len(orderNos) == 0 {
+		return results
+	}
+
+	state, message := work.StateSucceed, ""
+	err := orderservices.SaveOrderNos(orderNos)
+	if err != nil {
+		logger.Error(ctx, "order_batch_save_error", len(orderNos), err.Error())
+		state, message = work.StateFailed, err.Error()
+	}
+	for _, k := range indexes {
+		results[k] = work.TaskResult{Id: tasks[k].Id, State: state, Message: message}
+	}
+	return results
+}
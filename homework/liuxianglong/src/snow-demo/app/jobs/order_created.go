@@ -0,0 +1,18 @@
+package jobs
+
+import (
+	"fmt"
+	"github.com/qit-team/work"
+)
+
+//订单创建事件的notify订阅组
+func orderCreatedNotify(task work.Task) work.TaskResult {
+	fmt.Println("notify order created", task.Message)
+	return work.TaskResult{Id: task.Id, State: work.StateSucceed}
+}
+
+//订单创建事件的stats订阅组
+func orderCreatedStats(task work.Task) work.TaskResult {
+	fmt.Println("count order created", task.Message)
+	return work.TaskResult{Id: task.Id, State: work.StateSucceed}
+}
@@ -1,6 +1,7 @@
 package ordermodel
 
 import (
+	"github.com/go-xorm/xorm"
 	"github.com/qit-team/snow-core/db"
 	"sync"
 )
@@ -57,6 +58,27 @@ func (m *bannerModel) SaveOrderNo(orderNo string) (err error) {
 	return err
 }
 
+//批量保存订单号，一条insert语句写入
+func (m *bannerModel) SaveOrderNos(orderNos []string) (err error) {
+	orders := make([]*Order, len(orderNos))
+	for k, orderNo := range orderNos {
+		orders[k] = &Order{OrderNo: orderNo}
+	}
+	_, err = m.Insert(orders)
+	return err
+}
+
+//在事务中保存订单号，f在同一个session中执行，返回错误时回滚
+func (m *bannerModel) SaveOrderNoTx(orderNo string, f func(session *xorm.Session) error) (err error) {
+	_, err = m.GetDb().Master().Transaction(func(session *xorm.Session) (interface{}, error) {
+		if _, err := session.Insert(&Order{OrderNo: orderNo}); err != nil {
+			return nil, err
+		}
+		return nil, f(session)
+	})
+	return err
+}
+
 //func (m *bannerModel) GetListByPid(pid int, limits ...int) (banners []*Banner, err error) {
 //	banners = make([]*Banner, 0)
 //	err = m.GetList(&banners, "pid = ?", []interface{}{pid}, limits)
@@ -1,6 +1,13 @@
 package orderservices
 
-import "snow-demo/app/models/ordermodel"
+import (
+	"context"
+	"github.com/go-xorm/xorm"
+	"github.com/qit-team/snow-core/queue/outbox"
+	"snow-demo/app/constants/common"
+	"snow-demo/app/jobs/basejob"
+	"snow-demo/app/models/ordermodel"
+)
 
 func GetOrderInfoById(id int) (order *ordermodel.Order, err error){
 	order, err = ordermodel.GetInstance().GetOrderInfoById(id)
@@ -12,3 +19,16 @@ func SaveOrderNo(orderNo string) (err error){
 	err = ordermodel.GetInstance().SaveOrderNo(orderNo)
 	return
 }
+
+func SaveOrderNos(orderNos []string) (err error){
+	err = ordermodel.GetInstance().SaveOrderNos(orderNos)
+	return
+}
+
+//保存订单号，订单创建事件与订单在同一个事务写入outbox表，由outbox_relay投递，队列不可用时事件不会丢失
+func CreateOrder(ctx context.Context, orderNo string) (err error) {
+	err = ordermodel.GetInstance().SaveOrderNoTx(orderNo, func(session *xorm.Session) error {
+		return outbox.Publish(session, common.TopicOrderCreated, basejob.GenTask(ctx, common.TopicOrderCreated, orderNo))
+	})
+	return
+}
@@ -5,6 +5,7 @@ import (
 	"snow-demo/app/jobs/basejob"
 	"snow-demo/app/jobs"
 	"github.com/qit-team/snow-core/redis"
+	"github.com/qit-team/snow-core/cache"
 	"github.com/qit-team/snow-core/db"
 	"github.com/qit-team/snow-core/kernel/container"
 	"github.com/qit-team/snow-core/kernel/close"
@@ -49,6 +50,9 @@ func Bootstrap(conf *config.Config) (err error) {
 	//	return
 	//}
 
+	//未指定驱动的缓存使用配置的驱动，默认redis
+	cache.SetDefaultDriverType(conf.Cache.Driver)
+
 	//注册日志类服务
 	err = logger.Pr.Register(logger.SingletonMain, conf.Log, true)
 	if err != nil {
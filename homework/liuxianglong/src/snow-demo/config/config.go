@@ -24,6 +24,10 @@ type Config struct {
 	Mns   config.MnsConfig   `toml:"AliMns"`
 	Db    config.DbConfig    `toml:"Db"`
 	Api   config.ApiConfig   `toml:"Api"`
+	Job   config.JobConfig   `toml:"Job"`
+	Console config.ConsoleConfig `toml:"Console"`
+	Cache config.CacheConfig   `toml:"Cache"`
+	Queue config.QueueConfig   `toml:"Queue"`
 	TestQu config.DbConfig `toml:"TestQu"`
 	ShowSql bool         `toml:"ShowSql"`
 }
@@ -16,6 +16,8 @@ type Options struct {
 	PidDir      string
 	Queue       string
 	Command     string
+	//命令的参数，启动参数之后通过 -- 传入，如 -a command -m name -- -flag value arg
+	Args []string
 }
 
 func parseOptions() *Options {
@@ -28,6 +30,7 @@ func parseOptions() *Options {
 	flag.StringVar(&opts.Queue, "queue", "", "topic of queue is enable")
 	flag.StringVar(&opts.Command, "m", "", "command name")
 	flag.Parse()
+	opts.Args = flag.Args()
 	return opts
 }
 
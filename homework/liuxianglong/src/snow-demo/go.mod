@@ -9,6 +9,7 @@ require (
 	github.com/go-playground/locales v0.13.0 // indirect
 	github.com/go-playground/universal-translator v0.16.0 // indirect
 	github.com/go-sql-driver/mysql v1.4.1
+	github.com/go-xorm/xorm v0.7.4
 	github.com/leodido/go-urn v1.2.0 // indirect
 	github.com/qit-team/snow-core v0.1.10
 	github.com/qit-team/work v0.3.5
@@ -11,10 +11,15 @@ import (
 	"os"
 	"errors"
 	"github.com/qit-team/snow-core/kernel/server"
+	"github.com/qit-team/snow-core/command"
 	//启用本程序需要的各驱动
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/qit-team/snow-core/cache/rediscache"
 	_ "github.com/qit-team/snow-core/queue/redisqueue"
+	_ "github.com/qit-team/snow-core/queue/redisstreamqueue"
+	_ "github.com/qit-team/snow-core/queue/dbqueue"
+	_ "github.com/qit-team/snow-core/cache/memorycache"
+	_ "github.com/qit-team/snow-core/queue/memoryqueue"
 	//_ "github.com/qit-team/snow-core/queue/alimnsqueue"
 )
 
@@ -70,6 +75,13 @@ func main() {
 	handleCmd(opts)
 
 	err := startServer(opts)
+	if opts.App == "command" {
+		//命令的错误转换为进程退出码，方便脚本判断执行结果
+		if err != nil {
+			fmt.Printf("command %s error, %s\n", opts.Command, err)
+		}
+		os.Exit(command.ExitCode(err))
+	}
 	if err != nil {
 		fmt.Printf("server start error, %s\n", err)
 		os.Exit(1)
@@ -110,11 +122,11 @@ func startServer(opts *config.Options) (err error) {
 	case "api":
 		err = server.StartHttp(pidFile, conf.Api, routes.RegisterRoute)
 	case "cron":
-		err = server.StartConsole(pidFile, console.RegisterSchedule)
+		err = server.StartConsole(pidFile, console.RegisterSchedule, conf.Console)
 	case "job":
-		err = server.StartJob(pidFile, jobs.RegisterWorker)
+		err = server.StartJob(pidFile, jobs.RegisterWorker, conf.Job)
 	case "command":
-		err = server.ExecuteCommand(opts.Command, console.RegisterCommand)
+		err = server.ExecuteCommand(opts.Command, console.RegisterCommand, opts.Args...)
 	default:
 		err = errors.New("no server start")
 	}